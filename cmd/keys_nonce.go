@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/sysprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/vault"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
+)
+
+const (
+	flagNonceAccount = "nonce_account"
+	flagCount        = "count"
+)
+
+func nonceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "nonce",
+		Short: "Manage durable nonce accounts of the fee payer, set them as NonceAccounts in the config",
+	}
+
+	cmd.AddCommand(
+		nonceCreateCmd(),
+		nonceShowCmd(),
+		nonceCloseCmd(),
+	)
+	return cmd
+}
+
+func nonceCreateCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create nonce accounts, the fee payer pays their rent and is their authority",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			count, err := cmd.Flags().GetInt(flagCount)
+			if err != nil {
+				return err
+			}
+			if count <= 0 {
+				return fmt.Errorf("specify --%s", flagCount)
+			}
+			txSender, feePayer, err := nonceTxSender(cmd)
+			if err != nil {
+				return err
+			}
+			endpoint, err := cmd.Flags().GetString(flagEndPoint)
+			if err != nil {
+				return err
+			}
+			rent, err := client.NewClient([]string{endpoint}).GetMinimumBalanceForRentExemption(context.Background(), sysprog.NonceAccountSize)
+			if err != nil {
+				return err
+			}
+
+			for i := 0; i < count; i++ {
+				// the nonce account only signs its creation, its key is not kept
+				nonceAccount := types.NewAccount()
+				result, err := txSender.Send(context.Background(), []types.Instruction{
+					sysprog.CreateAccount(feePayer.PublicKey, nonceAccount.PublicKey, common.SystemProgramID, rent, sysprog.NonceAccountSize),
+					sysprog.InitializeNonceAccount(nonceAccount.PublicKey, feePayer.PublicKey),
+				}, nonceAccount)
+				if err != nil {
+					return err
+				}
+				if err := result.Err(); err != nil {
+					return err
+				}
+				fmt.Println("nonce account:", nonceAccount.PublicKey.ToBase58())
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Int(flagCount, 1, "nonce accounts to create")
+	addNonceTxFlags(cmd)
+	return cmd
+}
+
+func nonceShowCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show",
+		Short: "Show the authority and nonce of a nonce account",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			endpoint, err := cmd.Flags().GetString(flagEndPoint)
+			if err != nil {
+				return err
+			}
+			nonceAccountAddr, err := cmd.Flags().GetString(flagNonceAccount)
+			if err != nil {
+				return err
+			}
+
+			nonceAccount, err := rpc.NewClient([]string{endpoint}).GetNonceAccount(context.Background(), nonceAccountAddr)
+			if err != nil {
+				return err
+			}
+			fmt.Println("nonce account:", nonceAccountAddr)
+			fmt.Println("authority:", nonceAccount.AuthorizedPubkey.ToBase58())
+			fmt.Println("nonce:", nonceAccount.Nonce.ToBase58())
+			fmt.Println("lamportsPerSignature:", nonceAccount.FeeCalculator.LamportsPerSignature)
+			return nil
+		},
+	}
+	cmd.Flags().String(flagEndPoint, "", "solana rpc endpoint")
+	cmd.Flags().String(flagNonceAccount, "", "nonce account")
+	return cmd
+}
+
+func nonceCloseCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "close",
+		Short: "Close a nonce account, its lamports are withdrawn to the fee payer",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nonceAccountAddr, err := cmd.Flags().GetString(flagNonceAccount)
+			if err != nil {
+				return err
+			}
+			txSender, feePayer, err := nonceTxSender(cmd)
+			if err != nil {
+				return err
+			}
+			endpoint, err := cmd.Flags().GetString(flagEndPoint)
+			if err != nil {
+				return err
+			}
+			lamports, err := client.NewClient([]string{endpoint}).GetBalance(context.Background(), nonceAccountAddr)
+			if err != nil {
+				return err
+			}
+
+			result, err := txSender.Send(context.Background(), []types.Instruction{
+				sysprog.WithdrawNonceAccount(common.PublicKeyFromString(nonceAccountAddr), feePayer.PublicKey, feePayer.PublicKey, lamports),
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Println("WithdrawNonceAccount txHash:", result.Signature)
+			return result.Err()
+		},
+	}
+	cmd.Flags().String(flagNonceAccount, "", "nonce account")
+	addNonceTxFlags(cmd)
+	return cmd
+}
+
+func addNonceTxFlags(cmd *cobra.Command) {
+	cmd.Flags().String(flagKeystorePath, defaultKeystorePath, "Wallet file that contains encrypted key material")
+	cmd.Flags().String(flagFeePayer, "", "fee payer, the authority of the nonce accounts")
+	cmd.Flags().String(flagEndPoint, "", "solana rpc endpoint")
+}
+
+// nonceTxSender opens the vault for the fee payer and returns a tx sender paid by it
+func nonceTxSender(cmd *cobra.Command) (*task.TxSender, types.Account, error) {
+	feePayerAddr, err := cmd.Flags().GetString(flagFeePayer)
+	if err != nil {
+		return nil, types.Account{}, err
+	}
+	endpoint, err := cmd.Flags().GetString(flagEndPoint)
+	if err != nil {
+		return nil, types.Account{}, err
+	}
+
+	v, _ := vault.MustGetWallet(cmd, false)
+	var feePayer *types.Account
+	for _, privKey := range v.KeyBag {
+		if privKey.PublicKey().String() == feePayerAddr {
+			account := types.AccountFromPrivateKeyBytes(privKey)
+			feePayer = &account
+		}
+	}
+	if feePayer == nil {
+		return nil, types.Account{}, fmt.Errorf("fee payer not exit in vault")
+	}
+
+	endpoints := []string{endpoint}
+	txSender, err := task.NewTxSender(client.NewClient(endpoints), rpc.NewClient(endpoints), *feePayer, config.FeeConfig{})
+	if err != nil {
+		return nil, types.Account{}, err
+	}
+	return txSender, *feePayer, nil
+}
@@ -19,6 +19,7 @@ const (
 	flagEndPoint     = "endpoint"
 	flagLsdProgramID = "lsd_program_id"
 	flagKeystorePath = "keystore_path"
+	flagDryRun       = "dry-run"
 
 	defaultKeystorePath = "./keys/solana_keys.json"
 	defaultConfigPath   = "./config.toml"
@@ -58,6 +59,7 @@ func keysCmd() *cobra.Command {
 		vaultGenCmd(),
 		vaultExportCmd(),
 		vaultListCmd(),
+		nonceCmd(),
 	)
 	return cmd
 }
@@ -72,6 +74,9 @@ func stakeManagerCmd() *cobra.Command {
 		stakeManagerInitCmd(),
 		nextStakeManagerCmd(),
 		stakeManagerDetailCmd(),
+		stakeManagerStatusCmd(),
+		stakeManagerValidatorsCmd(),
+		stakeManagerRebalancePlanCmd(),
 		stakeManagerSetRateLimitCmd(),
 		stakeManagerSetUnbondingDurationCmd(),
 		stakeManagerAddValidator(),
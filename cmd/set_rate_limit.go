@@ -10,7 +10,9 @@ import (
 	"github.com/stafiprotocol/solana-go-sdk/rsolprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/vault"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
 )
 
 func stakeManagerSetRateLimitCmd() *cobra.Command {
@@ -52,13 +54,6 @@ func stakeManagerSetRateLimitCmd() *cobra.Command {
 
 			c := client.NewClient(cfg.EndpointList)
 
-			res, err := c.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-				Commitment: client.CommitmentConfirmed,
-			})
-			if err != nil {
-				fmt.Printf("get recent block hash error, err: %v\n", err)
-			}
-
 			lsdProgramID := common.PublicKeyFromString(cfg.LsdProgramID)
 			stakeManagerPubkey := common.PublicKeyFromString(cfg.StakeManagerAddress)
 
@@ -91,28 +86,29 @@ func stakeManagerSetRateLimitCmd() *cobra.Command {
 				}
 			}
 
-			rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-				Instructions: []types.Instruction{
-					rsolprog.SetRateChangeLimit(
-						lsdProgramID,
-						stakeManagerPubkey,
-						adminAccount.PublicKey,
-						cfg.RateChangeLimit,
-					),
-				},
-				Signers:         []types.Account{feePayerAccount, adminAccount},
-				FeePayer:        feePayerAccount.PublicKey,
-				RecentBlockHash: res.Blockhash,
-			})
+			txSender, err := task.NewTxSender(c, rpc.NewClient(cfg.EndpointList), feePayerAccount, cfg.Fee)
 			if err != nil {
-				fmt.Printf("generate tx error, err: %v\n", err)
+				return err
 			}
-			txHash, err := c.SendRawTransaction(context.Background(), rawTx)
+			if err := txSender.UseNonceAccounts(context.Background(), cfg.NonceAccounts); err != nil {
+				return err
+			}
+			result, err := txSender.Send(context.Background(), []types.Instruction{
+				rsolprog.SetRateChangeLimit(
+					lsdProgramID,
+					stakeManagerPubkey,
+					adminAccount.PublicKey,
+					cfg.RateChangeLimit,
+				),
+			}, adminAccount)
 			if err != nil {
-				fmt.Printf("send tx error, err: %v\n", err)
+				return err
 			}
 
-			fmt.Println("SetRateChangeLimit txHash:", txHash)
+			fmt.Println("SetRateChangeLimit txHash:", result.Signature)
+			if err := result.Err(); err != nil {
+				return err
+			}
 
 			return nil
 		},
@@ -3,7 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stafiprotocol/solana-go-sdk/client"
@@ -11,7 +10,9 @@ import (
 	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/vault"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
 )
 
 func stackInitCmd() *cobra.Command {
@@ -86,52 +87,28 @@ func stackInitCmd() *cobra.Command {
 				}
 			}
 
-			res, err := c.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-				Commitment: client.CommitmentConfirmed,
-			})
+			txSender, err := task.NewTxSender(c, rpc.NewClient(cfg.EndpointList), feePayerAccount, cfg.Fee)
 			if err != nil {
-				fmt.Printf("get recent block hash error, err: %v\n", err)
+				return err
 			}
-
-			rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-				Instructions: []types.Instruction{
-					lsdprog.InitializeStack(
-						lsdProgramID,
-						stackAccount.PublicKey,
-						feePayerAccount.PublicKey,
-						adminAccount.PublicKey,
-					),
-				},
-				Signers:         []types.Account{feePayerAccount, adminAccount, stackAccount},
-				FeePayer:        feePayerAccount.PublicKey,
-				RecentBlockHash: res.Blockhash,
-			})
-			if err != nil {
-				fmt.Printf("generate tx error, err: %v\n", err)
+			if err := txSender.UseNonceAccounts(context.Background(), cfg.NonceAccounts); err != nil {
+				return err
 			}
-			txHash, err := c.SendRawTransaction(context.Background(), rawTx)
+			result, err := txSender.Send(context.Background(), []types.Instruction{
+				lsdprog.InitializeStack(
+					lsdProgramID,
+					stackAccount.PublicKey,
+					feePayerAccount.PublicKey,
+					adminAccount.PublicKey,
+				),
+			}, adminAccount, stackAccount)
 			if err != nil {
-				fmt.Printf("send tx error, err: %v\n", err)
+				return err
 			}
 
-			fmt.Println("initializeStackAccount txHash:", txHash)
-
-			retry := 0
-			for {
-				if retry > 60 {
-					return fmt.Errorf("tx %s failed", txHash)
-				}
-				_, err := c.GetAccountInfo(context.Background(), stackAccount.PublicKey.ToBase58(), client.GetAccountInfoConfig{
-					Encoding:  client.GetAccountInfoConfigEncodingBase64,
-					DataSlice: client.GetAccountInfoConfigDataSlice{},
-				})
-				if err != nil {
-					retry++
-					time.Sleep(time.Second)
-					continue
-				}
-
-				break
+			fmt.Println("initializeStackAccount txHash:", result.Signature)
+			if err := result.Err(); err != nil {
+				return err
 			}
 
 			return nil
@@ -3,7 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stafiprotocol/solana-go-sdk/client"
@@ -12,7 +11,9 @@ import (
 	"github.com/stafiprotocol/solana-go-sdk/sysprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/vault"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
 )
 
 var stakePoolSeed = []byte("pool_seed")
@@ -57,13 +58,6 @@ func stakeManagerInitCmd() *cobra.Command {
 
 			c := client.NewClient(cfg.EndpointList)
 
-			res, err := c.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-				Commitment: client.CommitmentConfirmed,
-			})
-			if err != nil {
-				fmt.Printf("get recent block hash error, err: %v\n", err)
-			}
-
 			lsdTokenMintPubkey := common.PublicKeyFromString(cfg.LsdTokenMintAddress)
 			lsdProgramID := common.PublicKeyFromString(cfg.LsdProgramID)
 			validatorPubkey := common.PublicKeyFromString(cfg.ValidatorAddress)
@@ -144,64 +138,47 @@ func stakeManagerInitCmd() *cobra.Command {
 				}
 			}
 
-			rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-				Instructions: []types.Instruction{
-					sysprog.Transfer(
-						feePayerAccount.PublicKey,
-						stakePool,
-						stakePoolRent,
-					),
-					sysprog.CreateAccountWithSeed(
-						feePayerAccount.PublicKey,
-						stakeManagerPubkey,
-						feePayerAccount.PublicKey,
-						lsdProgramID,
-						seed,
-						stakeManagerRent,
-						lsdprog.StakeManagerAccountLengthDefault,
-					),
-					lsdprog.InitializeStakeManager(
-						lsdProgramID,
-						stakeManagerPubkey,
-						stackPubkey,
-						stakePool,
-						stackFeeAccountPubkey,
-						lsdTokenMintPubkey,
-						validatorPubkey,
-						feePayerAccount.PublicKey,
-						adminAccount.PublicKey,
-					),
-				},
-				Signers:         []types.Account{feePayerAccount, adminAccount},
-				FeePayer:        feePayerAccount.PublicKey,
-				RecentBlockHash: res.Blockhash,
-			})
+			txSender, err := task.NewTxSender(c, rpc.NewClient(cfg.EndpointList), feePayerAccount, cfg.Fee)
 			if err != nil {
-				fmt.Printf("generate tx error, err: %v\n", err)
+				return err
 			}
-			txHash, err := c.SendRawTransaction(context.Background(), rawTx)
+			if err := txSender.UseNonceAccounts(context.Background(), cfg.NonceAccounts); err != nil {
+				return err
+			}
+			result, err := txSender.Send(context.Background(), []types.Instruction{
+				sysprog.Transfer(
+					feePayerAccount.PublicKey,
+					stakePool,
+					stakePoolRent,
+				),
+				sysprog.CreateAccountWithSeed(
+					feePayerAccount.PublicKey,
+					stakeManagerPubkey,
+					feePayerAccount.PublicKey,
+					lsdProgramID,
+					seed,
+					stakeManagerRent,
+					lsdprog.StakeManagerAccountLengthDefault,
+				),
+				lsdprog.InitializeStakeManager(
+					lsdProgramID,
+					stakeManagerPubkey,
+					stackPubkey,
+					stakePool,
+					stackFeeAccountPubkey,
+					lsdTokenMintPubkey,
+					validatorPubkey,
+					feePayerAccount.PublicKey,
+					adminAccount.PublicKey,
+				),
+			}, adminAccount)
 			if err != nil {
-				fmt.Printf("send tx error, err: %v\n", err)
+				return err
 			}
 
-			fmt.Println("initializeStakeManager txHash:", txHash)
-
-			retry := 0
-			for {
-				if retry > 60 {
-					return fmt.Errorf("tx %s failed", txHash)
-				}
-				_, err = c.GetAccountInfo(context.Background(), stakeManagerPubkey.ToBase58(), client.GetAccountInfoConfig{
-					Encoding:  client.GetAccountInfoConfigEncodingBase64,
-					DataSlice: client.GetAccountInfoConfigDataSlice{},
-				})
-				if err != nil {
-					retry++
-					time.Sleep(time.Second)
-					continue
-				}
-
-				break
+			fmt.Println("initializeStakeManager txHash:", result.Signature)
+			if err := result.Err(); err != nil {
+				return err
 			}
 
 			return nil
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
+)
+
+type rebalanceMoveOutput struct {
+	StakeAccount string `json:"stakeAccount"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	Amount       uint64 `json:"amount"`
+}
+
+func stakeManagerRebalancePlanCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "rebalance-plan",
+		Short: "Print the moves rebalancing a stake manager towards the target distribution of the start config, without sending them",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, err := cmd.Flags().GetString(flagConfigPath)
+			if err != nil {
+				return err
+			}
+			stakeManagerStr, err := cmd.Flags().GetString(flagStakeManager)
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString(flagOutput)
+			if err != nil {
+				return err
+			}
+			if output != outputText && output != outputJson {
+				return fmt.Errorf("unknown output: %s", output)
+			}
+
+			cfg, err := config.LoadStartConfig(configPath)
+			if err != nil {
+				return err
+			}
+			if len(stakeManagerStr) == 0 {
+				stakeManagerStr = cfg.StakeManagerAddress
+			}
+			if len(stakeManagerStr) == 0 {
+				return fmt.Errorf("stake manager not set")
+			}
+
+			c := client.NewClient(cfg.EndpointList)
+			stakeManager, err := c.GetLsdStakeManager(context.Background(), stakeManagerStr)
+			if err != nil {
+				return err
+			}
+			limits := task.RebalanceLimits{
+				MaxAmount: cfg.Rebalance.MaxAmountPerEra,
+				MaxMoves:  cfg.Rebalance.MaxMovesPerEra,
+				MinMove:   cfg.Rebalance.MinMove,
+			}
+			validators, err := task.EligibleValidators(rpc.NewClient(cfg.EndpointList), stakeManager.Validators, cfg.Score)
+			if err != nil {
+				return err
+			}
+			moves, err := task.PlanRebalance(c, stakeManager, validators, cfg.ValidatorWeights, limits)
+			if err != nil {
+				return err
+			}
+
+			outputs := make([]rebalanceMoveOutput, 0, len(moves))
+			for _, move := range moves {
+				outputs = append(outputs, rebalanceMoveOutput{
+					StakeAccount: move.StakeAccount.ToBase58(),
+					From:         move.From.ToBase58(),
+					To:           move.To.ToBase58(),
+					Amount:       move.Amount,
+				})
+			}
+			if output == outputJson {
+				jsonBts, err := json.MarshalIndent(outputs, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsonBts))
+				return nil
+			}
+
+			fmt.Printf("stakeManager: %s, latestEra: %d\n", common.PublicKeyFromString(stakeManagerStr).ToBase58(), stakeManager.LatestEra)
+			if len(outputs) == 0 {
+				fmt.Println("no moves, stake distribution within the limits of the target")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STAKE ACCOUNT\tFROM\tTO\tAMOUNT")
+			for _, move := range outputs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", move.StakeAccount, move.From, move.To, formatDecimals9(move.Amount))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().String(flagConfigPath, defaultConfigPath, "start config file path")
+	cmd.Flags().String(flagStakeManager, "", "stake manager, StakeManagerAddress of the config if empty")
+	cmd.Flags().String(flagOutput, outputText, "output format: text or json")
+	return cmd
+}
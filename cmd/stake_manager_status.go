@@ -0,0 +1,310 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
+)
+
+const (
+	flagOutput = "output"
+
+	outputText = "text"
+	outputJson = "json"
+)
+
+type stakeManagerStatus struct {
+	StakeManager     string                  `json:"stakeManager"`
+	StakePool        string                  `json:"stakePool"`
+	Epoch            uint64                  `json:"epoch"`
+	LatestEra        uint64                  `json:"latestEra"`
+	Rate             string                  `json:"rate"`
+	Active           uint64                  `json:"active"`
+	EraBond          uint64                  `json:"eraBond"`
+	EraUnbond        uint64                  `json:"eraUnbond"`
+	MinDelegation    uint64                  `json:"minDelegation"`
+	SkipBondExpected bool                    `json:"skipBondExpected"` // the next era's bond is below the min delegation
+	EraState         task.EraState           `json:"eraState"`
+	NextActions      []statusAction          `json:"nextActions"`
+	Validators       []validatorDistribution `json:"validators"`
+	StakeAccounts    []stakeAccountStatus    `json:"stakeAccounts"`
+	SplitAccounts    []stakeAccountStatus    `json:"splitAccounts"`
+}
+
+type statusAction struct {
+	Handler string `json:"handler"`
+	Reason  string `json:"reason"`
+}
+
+type validatorDistribution struct {
+	Validator string  `json:"validator"`
+	Stake     uint64  `json:"stake"`
+	Share     float64 `json:"share"` // percent of the stake of all stake accounts
+}
+
+type stakeAccountStatus struct {
+	Address         string                      `json:"address"`
+	Validator       string                      `json:"validator"`
+	Stake           uint64                      `json:"stake"`
+	State           client.StakeActivationState `json:"state"`
+	CreditsObserved uint64                      `json:"creditsObserved"`
+}
+
+func stakeManagerStatusCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show era phase, next actions and stake distribution of a stake manager",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stakeManager, err := cmd.Flags().GetString(flagStakeManager)
+			if err != nil {
+				return err
+			}
+			endpoint, err := cmd.Flags().GetString(flagEndPoint)
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString(flagOutput)
+			if err != nil {
+				return err
+			}
+			if output != outputText && output != outputJson {
+				return fmt.Errorf("unknown output: %s", output)
+			}
+
+			status, err := getStakeManagerStatus(client.NewClient([]string{endpoint}), common.PublicKeyFromString(stakeManager))
+			if err != nil {
+				return err
+			}
+
+			if output == outputJson {
+				jsonBts, err := json.MarshalIndent(status, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsonBts))
+				return nil
+			}
+			printStakeManagerStatus(status)
+			return nil
+		},
+	}
+	cmd.Flags().String(flagStakeManager, "", "stake manager")
+	cmd.Flags().String(flagEndPoint, "", "solana rpc endpoint")
+	cmd.Flags().String(flagOutput, outputText, "output format: text or json")
+	return cmd
+}
+
+func getStakeManagerStatus(c *client.Client, stakeManagerPubkey common.PublicKey) (*stakeManagerStatus, error) {
+	ctx := context.Background()
+	accountInfo, err := c.GetAccountInfo(ctx, stakeManagerPubkey.ToBase58(), client.GetAccountInfoConfig{
+		Encoding:  client.GetAccountInfoConfigEncodingBase64,
+		DataSlice: client.GetAccountInfoConfigDataSlice{Offset: 0, Length: 8},
+	})
+	if err != nil {
+		return nil, err
+	}
+	stakeManager, err := c.GetLsdStakeManager(ctx, stakeManagerPubkey.ToBase58())
+	if err != nil {
+		return nil, err
+	}
+	epochInfo, err := c.GetEpochInfo(ctx, client.CommitmentFinalized)
+	if err != nil {
+		return nil, err
+	}
+	minDelegation, err := c.GetMinDelegationAmount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stakePool, _, err := common.FindProgramAddress([][]byte{stakeManagerPubkey.Bytes(), stakePoolSeed}, common.PublicKeyFromString(accountInfo.Owner))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &stakeManagerStatus{
+		StakeManager:  stakeManagerPubkey.ToBase58(),
+		StakePool:     stakePool.ToBase58(),
+		Epoch:         uint64(epochInfo.Epoch),
+		LatestEra:     stakeManager.LatestEra,
+		Rate:          formatDecimals9(stakeManager.Rate),
+		Active:        stakeManager.Active,
+		EraBond:       stakeManager.EraBond,
+		EraUnbond:     stakeManager.EraUnbond,
+		MinDelegation: minDelegation,
+		EraState:      task.NewEraState(stakeManager, uint64(epochInfo.Epoch), minDelegation),
+	}
+	status.SkipBondExpected = stakeManager.EraBond > stakeManager.EraUnbond && stakeManager.EraBond-stakeManager.EraUnbond < minDelegation
+
+	if status.StakeAccounts, err = getStakeAccountStatuses(c, stakeManager.StakeAccounts); err != nil {
+		return nil, err
+	}
+	if status.SplitAccounts, err = getStakeAccountStatuses(c, stakeManager.SplitAccounts); err != nil {
+		return nil, err
+	}
+	status.Validators = validatorDistributions(stakeManager, status.StakeAccounts)
+	status.NextActions = nextActions(status)
+	return status, nil
+}
+
+func getStakeAccountStatuses(c *client.Client, stakeAccounts []common.PublicKey) ([]stakeAccountStatus, error) {
+	statuses := make([]stakeAccountStatus, 0, len(stakeAccounts))
+	for _, stakeAccount := range stakeAccounts {
+		activation, err := c.GetStakeActivation(context.Background(), stakeAccount.ToBase58(), client.GetStakeActivationConfig{})
+		if err != nil {
+			return nil, err
+		}
+		accountInfo, err := c.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		stake := accountInfo.StakeAccount.Info.Stake
+		statuses = append(statuses, stakeAccountStatus{
+			Address:         stakeAccount.ToBase58(),
+			Validator:       stake.Delegation.Voter.ToBase58(),
+			Stake:           uint64(stake.Delegation.Stake),
+			State:           activation.State,
+			CreditsObserved: stake.CreditsObserved,
+		})
+	}
+	return statuses, nil
+}
+
+// validatorDistributions lists the stake manager's validators first, then validators only stake accounts are left on
+func validatorDistributions(stakeManager *lsdprog.StakeManager, stakeAccounts []stakeAccountStatus) []validatorDistribution {
+	stakes := make(map[string]uint64)
+	total := uint64(0)
+	for _, stakeAccount := range stakeAccounts {
+		stakes[stakeAccount.Validator] += stakeAccount.Stake
+		total += stakeAccount.Stake
+	}
+
+	validators := make([]string, 0, len(stakes))
+	listed := make(map[string]bool)
+	for _, validator := range stakeManager.Validators {
+		validators = append(validators, validator.ToBase58())
+		listed[validator.ToBase58()] = true
+	}
+	unlisted := make([]string, 0)
+	for validator := range stakes {
+		if !listed[validator] {
+			unlisted = append(unlisted, validator)
+		}
+	}
+	sort.Strings(unlisted)
+
+	distributions := make([]validatorDistribution, 0, len(validators)+len(unlisted))
+	for _, validator := range append(validators, unlisted...) {
+		distribution := validatorDistribution{Validator: validator, Stake: stakes[validator]}
+		if total > 0 {
+			distribution.Share = float64(stakes[validator]) * 100 / float64(total)
+		}
+		distributions = append(distributions, distribution)
+	}
+	return distributions
+}
+
+// nextActions lists what the relay would do on its next pass: the era action, or once the era is idle,
+// merging active stake accounts of the same validator and credits, and withdrawing inactive split accounts.
+func nextActions(status *stakeManagerStatus) []statusAction {
+	state := status.EraState
+	switch state.Phase {
+	case task.EraPhaseIllegal:
+		return []statusAction{{Handler: "none", Reason: "illegal era state: " + state.Reason}}
+	case task.EraPhaseIdle:
+	default:
+		return []statusAction{{Handler: state.Handler, Reason: state.Reason}}
+	}
+
+	actions := make([]statusAction, 0)
+	mergeable := make(map[string]int)
+	for _, stakeAccount := range status.StakeAccounts {
+		if stakeAccount.State == client.StakeActivationStateActive {
+			mergeable[fmt.Sprintf("%s/%d", stakeAccount.Validator, stakeAccount.CreditsObserved)]++
+		}
+	}
+	merges := 0
+	for _, count := range mergeable {
+		if count > 1 {
+			merges += count - 1
+		}
+	}
+	if merges > 0 {
+		actions = append(actions, statusAction{Handler: "EraMerge", Reason: fmt.Sprintf("%d active stake accounts to merge", merges)})
+	}
+
+	withdrawable := 0
+	for _, splitAccount := range status.SplitAccounts {
+		if splitAccount.State == client.StakeActivationStateInactive {
+			withdrawable++
+		}
+	}
+	if withdrawable > 0 {
+		actions = append(actions, statusAction{Handler: "EraWithdraw", Reason: fmt.Sprintf("%d split accounts inactive", withdrawable)})
+	}
+
+	if len(actions) == 0 {
+		actions = append(actions, statusAction{Handler: "none", Reason: fmt.Sprintf("era %d processed, next era at epoch %d", state.Era, state.Era+1)})
+	}
+	return actions
+}
+
+func printStakeManagerStatus(status *stakeManagerStatus) {
+	state := status.EraState
+	fmt.Printf("stakeManager:   %s\n", status.StakeManager)
+	fmt.Printf("stakePool:      %s\n", status.StakePool)
+	fmt.Printf("epoch:          %d\n", status.Epoch)
+	fmt.Printf("latestEra:      %d\n", status.LatestEra)
+	fmt.Printf("rate:           %s\n", status.Rate)
+	fmt.Printf("active:         %d\n", status.Active)
+	fmt.Printf("eraBond:        %d\n", status.EraBond)
+	fmt.Printf("eraUnbond:      %d\n", status.EraUnbond)
+	fmt.Printf("minDelegation:  %d\n", status.MinDelegation)
+	if status.SkipBondExpected {
+		fmt.Printf("                next era will skip bond: %d below min delegation\n", status.EraBond-status.EraUnbond)
+	}
+	fmt.Printf("eraPhase:       %s (%s)\n", state.Phase, state.Reason)
+	if state.Phase != task.EraPhaseIdle && state.Phase != task.EraPhaseNew {
+		fmt.Printf("eraProcessData: needBond %d, needUnbond %d, oldActive %d, newActive %d, pendingStakeAccounts %d\n",
+			state.NeedBond, state.NeedUnbond, state.OldActive, state.NewActive, state.PendingStakeAccounts)
+	}
+
+	fmt.Println("\nnext actions:")
+	for _, action := range status.NextActions {
+		fmt.Printf("  %s: %s\n", action.Handler, action.Reason)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\nvalidators:")
+	fmt.Fprintln(w, "  VALIDATOR\tSTAKE\tSHARE")
+	for _, validator := range status.Validators {
+		fmt.Fprintf(w, "  %s\t%d\t%.2f%%\n", validator.Validator, validator.Stake, validator.Share)
+	}
+	printStakeAccountStatuses(w, "stake accounts", status.StakeAccounts)
+	printStakeAccountStatuses(w, "split accounts", status.SplitAccounts)
+	w.Flush()
+}
+
+func printStakeAccountStatuses(w *tabwriter.Writer, title string, statuses []stakeAccountStatus) {
+	fmt.Fprintf(w, "\n%s:\n", title)
+	if len(statuses) == 0 {
+		fmt.Fprintln(w, "  none")
+		return
+	}
+	fmt.Fprintln(w, "  ADDRESS\tVALIDATOR\tSTAKE\tSTATE")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "  %s\t%s\t%d\t%s\n", status.Address, status.Validator, status.Stake, status.State)
+	}
+}
+
+func formatDecimals9(value uint64) string {
+	return fmt.Sprintf("%d.%09d", value/1e9, value%1e9)
+}
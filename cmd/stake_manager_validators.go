@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/task"
+)
+
+const (
+	flagMaxCommission = "max_commission"
+	flagCreditEpochs  = "credit_epochs"
+)
+
+func stakeManagerValidatorsCmd() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "validators",
+		Short: "Print the scores of a stake manager's validators, from vote credits, commission and skip rate",
+
+		RunE: func(cmd *cobra.Command, args []string) error {
+			stakeManager, err := cmd.Flags().GetString(flagStakeManager)
+			if err != nil {
+				return err
+			}
+			endpoint, err := cmd.Flags().GetString(flagEndPoint)
+			if err != nil {
+				return err
+			}
+			output, err := cmd.Flags().GetString(flagOutput)
+			if err != nil {
+				return err
+			}
+			if output != outputText && output != outputJson {
+				return fmt.Errorf("unknown output: %s", output)
+			}
+			scoreCfg := config.ScoreConfig{}
+			if scoreCfg.MaxCommission, err = cmd.Flags().GetUint64(flagMaxCommission); err != nil {
+				return err
+			}
+			if scoreCfg.CreditEpochs, err = cmd.Flags().GetUint64(flagCreditEpochs); err != nil {
+				return err
+			}
+
+			c := client.NewClient([]string{endpoint})
+			stakeManagerDetail, err := c.GetLsdStakeManager(context.Background(), stakeManager)
+			if err != nil {
+				return err
+			}
+			scores, err := task.ScoreValidators(rpc.NewClient([]string{endpoint}), stakeManagerDetail.Validators, scoreCfg)
+			if err != nil {
+				return err
+			}
+			sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+
+			if output == outputJson {
+				jsonBts, err := json.MarshalIndent(scores, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(jsonBts))
+				return nil
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VALIDATOR\tCOMMISSION\tCREDITS\tSKIP RATE\tDELINQUENT\tSCORE\tREASON")
+			for _, score := range scores {
+				fmt.Fprintf(w, "%s\t%d%%\t%d/%d\t%.2f%%\t%t\t%.4f\t%s\n", score.Validator, score.Commission, score.Credits, score.MaxCredits,
+					score.SkipRate*100, score.Delinquent, score.Score, score.Reason)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().String(flagStakeManager, "", "stake manager")
+	cmd.Flags().String(flagEndPoint, "", "solana rpc endpoint")
+	cmd.Flags().String(flagOutput, outputText, "output format: text or json")
+	cmd.Flags().Uint64(flagMaxCommission, 100, "percent, validators charging more are scored 0")
+	cmd.Flags().Uint64(flagCreditEpochs, 5, "completed epochs the vote credits are averaged over")
+	return cmd
+}
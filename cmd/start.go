@@ -31,6 +31,11 @@ func startCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			dryRun, err := cmd.Flags().GetBool(flagDryRun)
+			if err != nil {
+				return err
+			}
+			cfg.DryRun = cfg.DryRun || dryRun
 
 			bts, _ := json.MarshalIndent(cfg, "", "  ")
 			fmt.Printf("Config: \n%s\n", string(bts))
@@ -103,5 +108,6 @@ func startCmd() *cobra.Command {
 	}
 	cmd.Flags().String(flagConfigPath, defaultConfigPath, "Config file path")
 	cmd.Flags().String(flagLogLevel, logrus.InfoLevel.String(), "The logging level (trace|debug|info|warn|error|fatal|panic)")
+	cmd.Flags().Bool(flagDryRun, false, "Simulate txs instead of sending them")
 	return cmd
 }
@@ -0,0 +1,159 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Level string
+
+const (
+	LevelInfo     Level = "info"
+	LevelWarn     Level = "warn"
+	LevelCritical Level = "critical"
+)
+
+type Alert struct {
+	Level   Level     `json:"level"`
+	Title   string    `json:"title"`
+	Message string    `json:"message"`
+	Source  string    `json:"source"` // which relay, e.g. the stack or stake manager address
+	Time    time.Time `json:"time"`
+}
+
+func (a *Alert) text() string {
+	return fmt.Sprintf("[%s] %s\n%s\nsource: %s\ntime: %s", strings.ToUpper(string(a.Level)), a.Title, a.Message, a.Source, a.Time.UTC().Format(time.RFC3339))
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func postJSON(ctx context.Context, url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return fmt.Errorf("status code: %d, body: %s", res.StatusCode, string(resBody))
+	}
+	return nil
+}
+
+// WebhookNotifier posts the alert as is, in json
+type WebhookNotifier struct {
+	URL string
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.URL, alert)
+}
+
+// SlackNotifier posts to a slack incoming webhook, or anything taking its payload
+type SlackNotifier struct {
+	WebhookURL string
+}
+
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{WebhookURL: webhookURL}
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, n.WebhookURL, map[string]string{"text": alert.text()})
+}
+
+// TelegramNotifier sends a message through the bot api, APIURL may point to a compatible server.
+type TelegramNotifier struct {
+	APIURL   string
+	BotToken string
+	ChatID   string
+}
+
+const DefaultTelegramAPIURL = "https://api.telegram.org"
+
+func NewTelegramNotifier(apiURL, botToken, chatID string) *TelegramNotifier {
+	if len(apiURL) == 0 {
+		apiURL = DefaultTelegramAPIURL
+	}
+	return &TelegramNotifier{
+		APIURL:   strings.TrimSuffix(apiURL, "/"),
+		BotToken: botToken,
+		ChatID:   chatID,
+	}
+}
+
+func (n *TelegramNotifier) Notify(ctx context.Context, alert Alert) error {
+	return postJSON(ctx, fmt.Sprintf("%s/bot%s/sendMessage", n.APIURL, n.BotToken), map[string]string{
+		"chat_id": n.ChatID,
+		"text":    alert.text(),
+	})
+}
+
+// Multi notifies every notifier, a failed one does not stop the others.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, alert Alert) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, alert); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Throttled drops alerts with the same level and title as one notified within Interval.
+type Throttled struct {
+	Notifier Notifier
+	Interval time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func NewThrottled(n Notifier, interval time.Duration) *Throttled {
+	return &Throttled{
+		Notifier: n,
+		Interval: interval,
+		last:     make(map[string]time.Time),
+	}
+}
+
+func (t *Throttled) Notify(ctx context.Context, alert Alert) error {
+	key := string(alert.Level) + alert.Title
+	t.mu.Lock()
+	if last, exist := t.last[key]; exist && time.Since(last) < t.Interval {
+		t.mu.Unlock()
+		return nil
+	}
+	t.last[key] = time.Now()
+	t.mu.Unlock()
+
+	return t.Notifier.Notify(ctx, alert)
+}
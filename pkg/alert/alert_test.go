@@ -0,0 +1,162 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type request struct {
+	path        string
+	contentType string
+	body        map[string]interface{}
+}
+
+// newStandIn serves sink requests with status, passing each one on requests
+func newStandIn(t *testing.T, status int) (*httptest.Server, chan request) {
+	requests := make(chan request, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		req := request{path: r.URL.Path, contentType: r.Header.Get("Content-Type")}
+		if err := json.Unmarshal(body, &req.body); err != nil {
+			t.Errorf("body %s not json: %s", body, err)
+		}
+		requests <- req
+		w.WriteHeader(status)
+		w.Write([]byte("stand-in says no"))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func testAlert() Alert {
+	return Alert{
+		Level:   LevelCritical,
+		Title:   "stake manager halted",
+		Message: "rate change over limit",
+		Source:  "stakeManager 8w6Lf6wj1BSsu9UPc1hHazqpGvY4QcEbMaRGDDpHhTtA",
+		Time:    time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+const testText = "[CRITICAL] stake manager halted\nrate change over limit\n" +
+	"source: stakeManager 8w6Lf6wj1BSsu9UPc1hHazqpGvY4QcEbMaRGDDpHhTtA\ntime: 2024-05-01T08:00:00Z"
+
+func TestSinks(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusOK)
+	tests := []struct {
+		name     string
+		notifier Notifier
+		path     string
+		body     map[string]interface{}
+	}{
+		{
+			name:     "webhook",
+			notifier: NewWebhookNotifier(server.URL + "/hook"),
+			path:     "/hook",
+			body: map[string]interface{}{
+				"level":   "critical",
+				"title":   "stake manager halted",
+				"message": "rate change over limit",
+				"source":  "stakeManager 8w6Lf6wj1BSsu9UPc1hHazqpGvY4QcEbMaRGDDpHhTtA",
+				"time":    "2024-05-01T08:00:00Z",
+			},
+		},
+		{
+			name:     "slack",
+			notifier: NewSlackNotifier(server.URL + "/services/T0/B0/x"),
+			path:     "/services/T0/B0/x",
+			body:     map[string]interface{}{"text": testText},
+		},
+		{
+			name:     "telegram",
+			notifier: NewTelegramNotifier(server.URL+"/", "123:abc", "-100"),
+			path:     "/bot123:abc/sendMessage",
+			body:     map[string]interface{}{"chat_id": "-100", "text": testText},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.notifier.Notify(context.Background(), testAlert()); err != nil {
+				t.Fatal(err)
+			}
+			req := <-requests
+			if req.path != tt.path || req.contentType != "application/json" {
+				t.Fatalf("path: %s, content type: %s", req.path, req.contentType)
+			}
+			got, _ := json.Marshal(req.body)
+			want, _ := json.Marshal(tt.body)
+			if string(got) != string(want) {
+				t.Fatalf("body: %s, want: %s", got, want)
+			}
+		})
+	}
+
+	if NewTelegramNotifier("", "t", "c").APIURL != DefaultTelegramAPIURL {
+		t.Fatal("telegram api url not defaulted")
+	}
+}
+
+func TestSinkStatusError(t *testing.T) {
+	server, _ := newStandIn(t, http.StatusBadGateway)
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), testAlert())
+	if err == nil || !strings.Contains(err.Error(), "status code: 502") || !strings.Contains(err.Error(), "stand-in says no") {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+type countNotifier struct {
+	count int
+	err   error
+}
+
+func (n *countNotifier) Notify(ctx context.Context, alert Alert) error {
+	n.count++
+	return n.err
+}
+
+func TestThrottled(t *testing.T) {
+	sink := &countNotifier{}
+	throttled := NewThrottled(sink, 50*time.Millisecond)
+	a := testAlert()
+	throttled.Notify(context.Background(), a)
+	throttled.Notify(context.Background(), a)
+	if sink.count != 1 {
+		t.Fatalf("notified %d times within interval, want 1", sink.count)
+	}
+
+	// another level or title is not a repeat
+	warn := a
+	warn.Level = LevelWarn
+	other := a
+	other.Title = "era handle failed"
+	throttled.Notify(context.Background(), warn)
+	throttled.Notify(context.Background(), other)
+	if sink.count != 3 {
+		t.Fatalf("notified %d times, want 3", sink.count)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	throttled.Notify(context.Background(), a)
+	if sink.count != 4 {
+		t.Fatalf("notified %d times after interval, want 4", sink.count)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	failing := &countNotifier{err: errors.New("sink down")}
+	first, last := &countNotifier{}, &countNotifier{}
+	err := Multi{first, failing, last}.Notify(context.Background(), testAlert())
+	if !errors.Is(err, failing.err) {
+		t.Fatalf("err: %v, want sink down", err)
+	}
+	if first.count != 1 || failing.count != 1 || last.count != 1 {
+		t.Fatalf("notified: %d %d %d, want every sink once", first.count, failing.count, last.count)
+	}
+}
@@ -0,0 +1,44 @@
+package computebudget
+
+import (
+	"encoding/binary"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+var ProgramID = common.PublicKeyFromString("ComputeBudget111111111111111111111111111111")
+
+type Instruction uint8
+
+const (
+	InstructionRequestUnitsDeprecated Instruction = iota
+	InstructionRequestHeapFrame
+	InstructionSetComputeUnitLimit
+	InstructionSetComputeUnitPrice
+)
+
+func SetComputeUnitLimit(units uint32) types.Instruction {
+	data := make([]byte, 5)
+	data[0] = byte(InstructionSetComputeUnitLimit)
+	binary.LittleEndian.PutUint32(data[1:], units)
+
+	return types.Instruction{
+		ProgramID: ProgramID,
+		Accounts:  []types.AccountMeta{},
+		Data:      data,
+	}
+}
+
+// SetComputeUnitPrice sets the priority fee in micro lamports per compute unit
+func SetComputeUnitPrice(microLamports uint64) types.Instruction {
+	data := make([]byte, 9)
+	data[0] = byte(InstructionSetComputeUnitPrice)
+	binary.LittleEndian.PutUint64(data[1:], microLamports)
+
+	return types.Instruction{
+		ProgramID: ProgramID,
+		Accounts:  []types.AccountMeta{},
+		Data:      data,
+	}
+}
@@ -22,12 +22,92 @@ type ConfigInitStakeManager struct {
 
 	FeePayerAccount string
 	AdminAccount    string
+	NonceAccounts   []string // durable nonce accounts of the fee payer, txs use a recent blockhash if empty
 
 	// setting
 	AddValidatorAddress    string
 	RemoveValidatorAddress string
 	RateChangeLimit        uint64
 	UnbondingDuration      uint64
+
+	Fee FeeConfig
+}
+
+// FeeConfig sets the compute budget instructions attached to every tx
+type FeeConfig struct {
+	ComputeUnitLimit      uint32 // skip SetComputeUnitLimit if 0
+	PriorityFeeMode       string // static(default)/dynamic
+	PriorityFee           uint64 // micro lamports per compute unit, the floor in dynamic mode
+	PriorityFeePercentile uint64 // percentile of getRecentPrioritizationFees used in dynamic mode, default 75
+	MaxPriorityFee        uint64 // cap of dynamic priority fee, no cap if 0
+}
+
+// RpcConfig sets the endpoint health checks, reads go to the healthiest endpoint of EndpointList
+type RpcConfig struct {
+	MaxSlotLag         uint64 // slots an endpoint may lag the highest slot of all endpoints, default 50
+	MaxErrorRate       uint64 // percent of the recent requests failed before an endpoint is unhealthy, default 50
+	CheckInterval      uint64 // seconds, default 30
+	BroadcastEndpoints uint64 // endpoints a tx is sent to at once, healthiest first, all if 0
+}
+
+// HealthConfig sets when /healthz and /readyz report unhealthy
+type HealthConfig struct {
+	MaxEraLag          uint64 // epochs a stake manager's LatestEra may lag the cluster epoch, default 1
+	MaxPassAge         uint64 // seconds since the last successful handling pass, default 1800
+	MinFeePayerBalance uint64 // lamports, skip if 0
+	MaxPhaseAge        uint64 // seconds a stake manager may stay in an era phase without progress, default 3600
+}
+
+// BalanceConfig sets the fee payer balance watcher
+type BalanceConfig struct {
+	WarnBalance     uint64   // lamports, log warnings below, skip if 0
+	CriticalBalance uint64   // lamports, log errors and pause PauseHandlers below, skip if 0
+	PauseHandlers   []string // handlers paused below CriticalBalance, default EraMerge and EraWithdraw
+	CheckInterval   uint64   // seconds, default 60
+}
+
+// AlertConfig sets the alert sinks, a sink is enabled when its url is set
+type AlertConfig struct {
+	WebhookURL       string // generic json post
+	SlackWebhookURL  string
+	TelegramAPIURL   string // default https://api.telegram.org
+	TelegramBotToken string
+	TelegramChatID   string
+
+	RetryThreshold      uint64 // alert once handler retries reach it, default 10
+	RateChangeThreshold uint64 // decimals 9, alert when one era moves the rate by more than this ratio, skip if 0
+	MinInterval         uint64 // seconds, the same alert is sent at most once within, default 600
+}
+
+// RebalanceConfig sets moving stake between validators towards ValidatorWeights, or an even split if unset.
+// Moves are redelegations signed by the stake manager admin, which must be in the keystore unless PlanOnly.
+type RebalanceConfig struct {
+	Enabled         bool
+	PlanOnly        bool   // log the planned moves instead of sending them
+	MaxAmountPerEra uint64 // lamports moved per era, no limit if 0
+	MaxMovesPerEra  uint64 // redelegations per era, default 4
+	MinMove         uint64 // lamports, smaller deviations are left, at least the min delegation
+}
+
+// WatchdogConfig sets the validator watchdog, flagged validators get no bond and are unbonded from first
+type WatchdogConfig struct {
+	FlagCommission   uint64 // percent, validators charging at least this are flagged, default 100
+	DelinquentChecks uint64 // consecutive checks a validator is seen delinquent, or its vote account missing, before flagged, default 3
+	CheckInterval    uint64 // seconds, default 60
+}
+
+// UpdateActiveConfig sets how EraUpdateActive instructions are packed into txs
+type UpdateActiveConfig struct {
+	BatchSize uint64 // instructions per tx, as many as fit in the tx size and compute limits if 0
+	Parallel  uint64 // txs sent at once, default 4
+}
+
+// ScoreConfig sets how validators are scored from their vote credits, commission and skip rate, 0 to 1.
+// Scores order validators for the worst_validator unbond strategy and the score select strategy.
+type ScoreConfig struct {
+	MinScore      float64 // validators scored below get no bond and are rebalanced off, disabled if 0
+	MaxCommission uint64  // percent, validators charging more are scored 0, default 100
+	CreditEpochs  uint64  // completed epochs the vote credits are averaged over, default 5
 }
 
 func LoadInitStakeManagerConfig(configFilePath string) (*ConfigInitStakeManager, error) {
@@ -59,10 +139,13 @@ type ConfigInitStack struct {
 
 	FeePayerAccount string
 	AdminAccount    string
+	NonceAccounts   []string // durable nonce accounts of the fee payer, txs use a recent blockhash if empty
 
 	// setting
 	StackAddress                    string
 	AddEntrustedStakeManagerAddress string
+
+	Fee FeeConfig
 }
 
 func LoadInitStackConfig(configFilePath string) (*ConfigInitStack, error) {
@@ -87,16 +170,41 @@ func loadSysConfigInitStack(path string, config *ConfigInitStack) error {
 }
 
 type ConfigStart struct {
-	EndpointList []string // url for  rpc endpoint
-	LogFilePath  string
-	KeystorePath string
+	EndpointList      []string // url for  rpc endpoint
+	WsEndpoint        string   // url for websocket endpoint, derived from the first rpc endpoint if empty
+	HttpListenAddress string   // listen address of the metrics server, e.g. ":9100", disabled if empty
+	LogFilePath       string
+	KeystorePath      string
+	StateDir          string // relay state store, holds generated stake account keys, disabled if empty
 
 	LsdProgramID string
 
 	StackAddress        string
 	StakeManagerAddress string
+	Concurrency         uint64 // entrusted stake managers handled at the same time, default 4
+	DryRun              bool   // simulate txs instead of sending, also set by --dry-run
 
 	FeePayerAccount string
+	NonceAccounts   []string // durable nonce accounts of the fee payer, txs use a recent blockhash if empty
+	LookupTable     bool     // batched era txs are v0 txs loading accounts from a lookup table per stake manager, kept by the fee payer
+
+	// bond
+	ValidatorSelectStrategy string            // first(default)/round_robin/least_staked/weighted/even/score
+	ValidatorWeights        map[string]uint64 // validator -> weight, used by weighted strategy
+
+	// unbond
+	UnbondStrategy string // largest(default)/worst_validator/proportional, worst_validator ranks by Score
+
+	Rpc       RpcConfig
+	Fee       FeeConfig
+	Health    HealthConfig
+	Balance   BalanceConfig
+	Alert     AlertConfig
+	Rebalance RebalanceConfig
+	Score     ScoreConfig
+	Watchdog  WatchdogConfig
+
+	UpdateActive UpdateActiveConfig
 }
 
 func LoadStartConfig(configFilePath string) (*ConfigStart, error) {
@@ -0,0 +1,127 @@
+// Package lookuptable builds instructions of the address lookup table program and decodes its table accounts.
+package lookuptable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+var ProgramID = common.PublicKeyFromString("AddressLookupTab1e1111111111111111111111111")
+
+const (
+	MetaSize     = 56  // bytes of the table state before the addresses
+	MaxAddresses = 256 // a v0 tx indexes table addresses with one byte
+
+	tableTypeLookupTable = 1
+)
+
+type Instruction uint32
+
+const (
+	InstructionCreateLookupTable Instruction = iota
+	InstructionFreezeLookupTable
+	InstructionExtendLookupTable
+	InstructionDeactivateLookupTable
+	InstructionCloseLookupTable
+)
+
+// DeriveLookupTableAddress returns the address of the table created by authority at recentSlot and its bump seed
+func DeriveLookupTableAddress(authority common.PublicKey, recentSlot uint64) (common.PublicKey, uint8, error) {
+	slot := make([]byte, 8)
+	binary.LittleEndian.PutUint64(slot, recentSlot)
+	table, bump, err := common.FindProgramAddress([][]byte{authority.Bytes(), slot}, ProgramID)
+	return table, uint8(bump), err
+}
+
+// CreateLookupTable creates the table at the address derived from authority and recentSlot,
+// recentSlot must still be in the slot hashes sysvar when the tx lands
+func CreateLookupTable(table, authority, payer common.PublicKey, recentSlot uint64, bumpSeed uint8) types.Instruction {
+	data := make([]byte, 13)
+	binary.LittleEndian.PutUint32(data[0:4], uint32(InstructionCreateLookupTable))
+	binary.LittleEndian.PutUint64(data[4:12], recentSlot)
+	data[12] = bumpSeed
+
+	return types.Instruction{
+		ProgramID: ProgramID,
+		Accounts: []types.AccountMeta{
+			{PubKey: table, IsSigner: false, IsWritable: true},
+			{PubKey: authority, IsSigner: true, IsWritable: false},
+			{PubKey: payer, IsSigner: true, IsWritable: true},
+			{PubKey: common.SystemProgramID, IsSigner: false, IsWritable: false},
+		},
+		Data: data,
+	}
+}
+
+// ExtendLookupTable appends addresses to the table, payer funds the rent of the grown account.
+// Appended addresses can be looked up from the next slot on.
+func ExtendLookupTable(table, authority, payer common.PublicKey, addresses []common.PublicKey) types.Instruction {
+	data := make([]byte, 12, 12+32*len(addresses))
+	binary.LittleEndian.PutUint32(data[0:4], uint32(InstructionExtendLookupTable))
+	binary.LittleEndian.PutUint64(data[4:12], uint64(len(addresses)))
+	for _, address := range addresses {
+		data = append(data, address.Bytes()...)
+	}
+
+	return types.Instruction{
+		ProgramID: ProgramID,
+		Accounts: []types.AccountMeta{
+			{PubKey: table, IsSigner: false, IsWritable: true},
+			{PubKey: authority, IsSigner: true, IsWritable: false},
+			{PubKey: payer, IsSigner: true, IsWritable: true},
+			{PubKey: common.SystemProgramID, IsSigner: false, IsWritable: false},
+		},
+		Data: data,
+	}
+}
+
+// LookupTable is the state of a table account
+type LookupTable struct {
+	DeactivationSlot           uint64 // math.MaxUint64 while active
+	LastExtendedSlot           uint64
+	LastExtendedSlotStartIndex uint8
+	Authority                  *common.PublicKey // nil once frozen
+	Addresses                  []common.PublicKey
+}
+
+func Deserialize(data []byte) (LookupTable, error) {
+	if len(data) < MetaSize || (len(data)-MetaSize)%32 != 0 {
+		return LookupTable{}, fmt.Errorf("lookup table data size %d invalid", len(data))
+	}
+	if binary.LittleEndian.Uint32(data[0:4]) != tableTypeLookupTable {
+		return LookupTable{}, errors.New("not a lookup table")
+	}
+	table := LookupTable{
+		DeactivationSlot:           binary.LittleEndian.Uint64(data[4:12]),
+		LastExtendedSlot:           binary.LittleEndian.Uint64(data[12:20]),
+		LastExtendedSlotStartIndex: data[20],
+	}
+	if data[21] == 1 {
+		authority := common.PublicKeyFromBytes(data[22:54])
+		table.Authority = &authority
+	}
+	for offset := MetaSize; offset < len(data); offset += 32 {
+		table.Addresses = append(table.Addresses, common.PublicKeyFromBytes(data[offset:offset+32]))
+	}
+	return table, nil
+}
+
+func (t *LookupTable) Serialize() []byte {
+	data := make([]byte, MetaSize, MetaSize+32*len(t.Addresses))
+	binary.LittleEndian.PutUint32(data[0:4], tableTypeLookupTable)
+	binary.LittleEndian.PutUint64(data[4:12], t.DeactivationSlot)
+	binary.LittleEndian.PutUint64(data[12:20], t.LastExtendedSlot)
+	data[20] = t.LastExtendedSlotStartIndex
+	if t.Authority != nil {
+		data[21] = 1
+		copy(data[22:54], t.Authority[:])
+	}
+	for _, address := range t.Addresses {
+		data = append(data, address.Bytes()...)
+	}
+	return data
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "solana_lsd_relay"
+
+var (
+	CurrentEpoch = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "current_epoch",
+		Help:      "Current finalized epoch of the cluster.",
+	})
+	LatestEra = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_latest_era",
+		Help:      "Latest era of the stake manager, behind current_epoch until the era is processed.",
+	}, []string{"stake_manager"})
+	Active = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_active_lamports",
+		Help:      "Active stake of the stake manager.",
+	}, []string{"stake_manager"})
+	Rate = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_rate",
+		Help:      "Exchange rate of the lsd token, decimals 9.",
+	}, []string{"stake_manager"})
+	NeedBond = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_need_bond_lamports",
+		Help:      "NeedBond of the era in process.",
+	}, []string{"stake_manager"})
+	NeedUnbond = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_need_unbond_lamports",
+		Help:      "NeedUnbond of the era in process.",
+	}, []string{"stake_manager"})
+	PendingStakeAccounts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_pending_stake_accounts",
+		Help:      "Stake accounts whose active is not updated in the era in process.",
+	}, []string{"stake_manager"})
+	SplitAccounts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_split_accounts",
+		Help:      "Split accounts waiting to be withdrawn.",
+	}, []string{"stake_manager"})
+	StakeManagerFailures = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stake_manager_consecutive_failures",
+		Help:      "Consecutive failed handling of the stake manager, 0 after a success.",
+	}, []string{"stake_manager"})
+
+	HandlerRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "handler_runs_total",
+		Help:      "Handler runs by result, success or failure.",
+	}, []string{"handler", "result"})
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "Handler latency, including waiting for its txs to finalize.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+	}, []string{"handler"})
+
+	TxSent = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tx_sent_total",
+		Help:      "Txs sent, each resend with a fresh blockhash counts once.",
+	})
+	TxResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tx_results_total",
+		Help:      "Landing outcome of sent txs, by status landed/failed/not_landed.",
+	}, []string{"status"})
+
+	FeePayerBalance = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "fee_payer_balance_lamports",
+		Help:      "SOL balance of the fee payer.",
+	})
+
+	ValidatorFlagged = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "validator_flagged",
+		Help:      "1 if the watchdog flagged the validator delinquent or over the commission threshold, else 0.",
+	}, []string{"validator"})
+
+	RpcEndpointHealthy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rpc_endpoint_healthy",
+		Help:      "1 if the rpc endpoint passed its last health check, else 0.",
+	}, []string{"endpoint"})
+	RpcEndpointSlotLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rpc_endpoint_slot_lag",
+		Help:      "Slots the rpc endpoint lags the highest slot of all endpoints.",
+	}, []string{"endpoint"})
+	RpcEndpointLatency = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "rpc_endpoint_latency_seconds",
+		Help:      "Moving average latency of requests to the rpc endpoint.",
+	}, []string{"endpoint"})
+
+	RpcRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Http requests to rpc endpoints.",
+	}, []string{"endpoint"})
+	RpcErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_errors_total",
+		Help:      "Http requests to rpc endpoints failed or answered with a non 200 status.",
+	}, []string{"endpoint"})
+)
+
+// ObserveHandler records one handler run
+func ObserveHandler(handler string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	HandlerRuns.WithLabelValues(handler, result).Inc()
+	HandlerDuration.WithLabelValues(handler).Observe(time.Since(start).Seconds())
+}
+
+// NewServeMux serves metrics at /metrics, other endpoints may be added by the caller.
+func NewServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+)
+
+var instrumentOnce sync.Once
+
+// InstrumentDefaultTransport counts requests and errors per endpoint on http.DefaultTransport,
+// which both the sdk client and our rpc client send through. Endpoints are labeled by scheme and host only,
+// as paths and queries often carry api keys.
+func InstrumentDefaultTransport() {
+	instrumentOnce.Do(func() {
+		http.DefaultTransport = &countingTransport{next: http.DefaultTransport}
+	})
+}
+
+type countingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := req.URL.Scheme + "://" + req.URL.Host
+	RpcRequests.WithLabelValues(endpoint).Inc()
+
+	res, err := t.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		RpcErrors.WithLabelValues(endpoint).Inc()
+	}
+	return res, err
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package mockrpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/lookuptable"
+)
+
+// LookupTable returns the addresses of a lookup table, false if there is no such table
+func (s *Server) LookupTable(addr common.PublicKey) ([]common.PublicKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table, exist := s.ledger.lookupTables[addr]
+	return append([]common.PublicKey(nil), table.Addresses...), exist
+}
+
+// lookupTableAddresses maps each table to its addresses, for resolving the lookups of v0 txs
+func (l *ledger) lookupTableAddresses() map[common.PublicKey][]common.PublicKey {
+	tables := make(map[common.PublicKey][]common.PublicKey, len(l.lookupTables))
+	for addr, table := range l.lookupTables {
+		tables[addr] = table.Addresses
+	}
+	return tables
+}
+
+// executeLookupTable runs CreateLookupTable and ExtendLookupTable, the authority has to sign both
+func (s *Server) executeLookupTable(l *ledger, instruction types.Instruction) error {
+	if len(instruction.Data) < 4 {
+		return fmt.Errorf("invalid instruction data")
+	}
+	if len(instruction.Accounts) < 3 {
+		return fmt.Errorf("not enough account keys")
+	}
+	addr := instruction.Accounts[0].PubKey
+	authority := instruction.Accounts[1]
+	if !authority.IsSigner {
+		return fmt.Errorf("lookup table authority %s did not sign", authority.PubKey.ToBase58())
+	}
+
+	switch lookuptable.Instruction(binary.LittleEndian.Uint32(instruction.Data[:4])) {
+	case lookuptable.InstructionCreateLookupTable:
+		if len(instruction.Data) < 13 {
+			return fmt.Errorf("invalid instruction data")
+		}
+		recentSlot := binary.LittleEndian.Uint64(instruction.Data[4:12])
+		if recentSlot > s.slot {
+			return fmt.Errorf("slot %d is not a recent slot", recentSlot)
+		}
+		derived, bump, err := lookuptable.DeriveLookupTableAddress(authority.PubKey, recentSlot)
+		if err != nil {
+			return err
+		}
+		if derived != addr || bump != instruction.Data[12] {
+			return fmt.Errorf("lookup table address %s not derived from authority and slot", addr.ToBase58())
+		}
+		if _, exist := l.lookupTables[addr]; exist {
+			return fmt.Errorf("account %s already in use", addr.ToBase58())
+		}
+		owner := authority.PubKey
+		l.lookupTables[addr] = lookuptable.LookupTable{DeactivationSlot: math.MaxUint64, Authority: &owner}
+		return nil
+	case lookuptable.InstructionExtendLookupTable:
+		if len(instruction.Data) < 12 {
+			return fmt.Errorf("invalid instruction data")
+		}
+		table, exist := l.lookupTables[addr]
+		if !exist {
+			return fmt.Errorf("lookup table %s not found", addr.ToBase58())
+		}
+		if table.Authority == nil || *table.Authority != authority.PubKey {
+			return fmt.Errorf("lookup table authority %s mismatch", authority.PubKey.ToBase58())
+		}
+		count := binary.LittleEndian.Uint64(instruction.Data[4:12])
+		if count == 0 || uint64(len(instruction.Data)-12) != count*32 {
+			return fmt.Errorf("invalid instruction data")
+		}
+		if len(table.Addresses)+int(count) > lookuptable.MaxAddresses {
+			return fmt.Errorf("lookup table %s is full", addr.ToBase58())
+		}
+		addresses := append([]common.PublicKey(nil), table.Addresses...)
+		for offset := 12; offset < len(instruction.Data); offset += 32 {
+			addresses = append(addresses, common.PublicKeyFromBytes(instruction.Data[offset:offset+32]))
+		}
+		table.LastExtendedSlotStartIndex = uint8(len(table.Addresses))
+		table.LastExtendedSlot = s.slot
+		table.Addresses = addresses
+		l.lookupTables[addr] = table
+		return nil
+	default:
+		return fmt.Errorf("lookup table instruction not supported")
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package mockrpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+var instructionNames = map[lsdprog.Instruction]string{
+	lsdprog.InstructionEraNew:          "era_new",
+	lsdprog.InstructionEraSkipBond:     "era_skip_bond",
+	lsdprog.InstructionEraBond:         "era_bond",
+	lsdprog.InstructionEraUnbond:       "era_unbond",
+	lsdprog.InstructionEraUpdateActive: "era_update_active",
+	lsdprog.InstructionEraUpdateRate:   "era_update_rate",
+	lsdprog.InstructionEraMerge:        "era_merge",
+	lsdprog.InstructionEraWithdraw:     "era_withdraw",
+	lsdprog.InstructionRedelegate:      "redelegate",
+}
+
+var errInjected = errors.New("injected failure")
+
+// programError is an injected failure of the lsd program, see FailNextWith
+type programError struct {
+	failure ProgramFailure
+}
+
+func (e *programError) Error() string {
+	return fmt.Sprintf("injected failure %#x", e.failure.Code)
+}
+
+// executeLsd runs an era instruction or redelegate of the lsd program. The bookkeeping follows the program,
+// the rate is simplified to the previous rate scaled by the active found over the active expected.
+func (s *Server) executeLsd(l *ledger, instruction types.Instruction, commit bool) (string, error) {
+	if len(instruction.Data) < 8 {
+		return "", fmt.Errorf("instruction data too short")
+	}
+	var discriminator lsdprog.Instruction
+	copy(discriminator[:], instruction.Data[:8])
+	name, exist := instructionNames[discriminator]
+	if !exist {
+		return "", fmt.Errorf("instruction %x not supported", discriminator)
+	}
+	if commit && s.failNext[name] > 0 {
+		s.failNext[name]--
+		if failure, exist := s.failWith[name]; exist {
+			return "", &programError{failure: failure}
+		}
+		return "", errInjected
+	}
+
+	accounts := make([]common.PublicKey, len(instruction.Accounts))
+	for i, account := range instruction.Accounts {
+		accounts[i] = account.PubKey
+	}
+	if len(accounts) == 0 {
+		return "", fmt.Errorf("not enough account keys")
+	}
+	stakeManager, err := l.stakeManager(accounts[0])
+	if err != nil {
+		return "", err
+	}
+	data := &stakeManager.EraProcessData
+
+	switch name {
+	case "era_new":
+		if !isEmpty(data) {
+			return "", fmt.Errorf("era process not end")
+		}
+		if stakeManager.LatestEra >= s.epoch {
+			return "", fmt.Errorf("era not updatable")
+		}
+		bond, unbond := stakeManager.EraBond, stakeManager.EraUnbond
+		if bond > unbond {
+			data.NeedBond = bond - unbond
+		} else {
+			data.NeedUnbond = unbond - bond
+		}
+		data.OldActive = stakeManager.Active + bond - unbond
+		data.PendingStakeAccounts = append([]common.PublicKey(nil), stakeManager.StakeAccounts...)
+		stakeManager.LatestEra++
+		stakeManager.EraBond = 0
+		stakeManager.EraUnbond = 0
+
+	case "era_skip_bond":
+		if data.NeedBond == 0 || data.NeedBond >= s.minDelegation {
+			return "", fmt.Errorf("need bond not skippable")
+		}
+		// carried to the next era
+		stakeManager.EraBond += data.NeedBond
+		data.OldActive -= data.NeedBond
+		data.NeedBond = 0
+
+	case "era_bond":
+		if len(accounts) < 5 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		validator, stakeAccount := accounts[1], accounts[3]
+		if data.NeedBond < s.minDelegation {
+			return "", fmt.Errorf("need bond below min delegation")
+		}
+		if !contains(stakeManager.Validators, validator) {
+			return "", fmt.Errorf("validator %s not exist", validator.ToBase58())
+		}
+		if _, exist := l.stakeAccounts[stakeAccount]; exist {
+			return "", fmt.Errorf("account %s already in use", stakeAccount.ToBase58())
+		}
+		l.stakeAccounts[stakeAccount] = StakeAccount{
+			Voter:             validator,
+			Stake:             data.NeedBond,
+			ActivationEpoch:   s.epoch,
+			DeactivationEpoch: math.MaxUint64,
+			CreditsObserved:   s.voteCredits[validator],
+		}
+		stakeManager.StakeAccounts = append(stakeManager.StakeAccounts, stakeAccount)
+		data.PendingStakeAccounts = append(data.PendingStakeAccounts, stakeAccount)
+		data.NeedBond = 0
+
+	case "era_unbond":
+		if len(accounts) < 6 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		from, split, validator := accounts[2], accounts[3], accounts[4]
+		if data.NeedUnbond == 0 {
+			return "", fmt.Errorf("no need to unbond")
+		}
+		if !contains(stakeManager.StakeAccounts, from) {
+			return "", fmt.Errorf("stake account %s not exist", from.ToBase58())
+		}
+		fromAccount := l.stakeAccounts[from]
+		if fromAccount.state(s.epoch) != client.StakeActivationStateActive {
+			return "", fmt.Errorf("stake account %s not active", from.ToBase58())
+		}
+		if fromAccount.Voter != validator {
+			return "", fmt.Errorf("validator not match")
+		}
+		if _, exist := l.stakeAccounts[split]; exist {
+			return "", fmt.Errorf("account %s already in use", split.ToBase58())
+		}
+		amount := data.NeedUnbond
+		if fromAccount.Stake < amount {
+			amount = fromAccount.Stake
+		}
+		splitAccount := fromAccount
+		splitAccount.Stake = amount
+		splitAccount.DeactivationEpoch = s.epoch
+		l.stakeAccounts[split] = splitAccount
+		stakeManager.SplitAccounts = append(stakeManager.SplitAccounts, split)
+
+		fromAccount.Stake -= amount
+		if fromAccount.Stake == 0 {
+			delete(l.stakeAccounts, from)
+			stakeManager.StakeAccounts = remove(stakeManager.StakeAccounts, from)
+			data.PendingStakeAccounts = remove(data.PendingStakeAccounts, from)
+		} else {
+			l.stakeAccounts[from] = fromAccount
+		}
+		data.NeedUnbond -= amount
+
+	case "era_update_active":
+		if len(accounts) < 2 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		stakeAccount := accounts[1]
+		if data.NeedBond != 0 || data.NeedUnbond != 0 {
+			return "", fmt.Errorf("era bond or unbond not end")
+		}
+		if !contains(data.PendingStakeAccounts, stakeAccount) {
+			return "", fmt.Errorf("stake account %s not pending", stakeAccount.ToBase58())
+		}
+		data.NewActive += l.stakeAccounts[stakeAccount].Stake
+		data.PendingStakeAccounts = remove(data.PendingStakeAccounts, stakeAccount)
+
+	case "era_update_rate":
+		if len(accounts) < 6 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		if data.NeedBond != 0 || data.NeedUnbond != 0 || len(data.PendingStakeAccounts) != 0 || data.NewActive == 0 || data.OldActive == 0 {
+			return "", fmt.Errorf("era active not updated")
+		}
+		for _, feeRecipient := range accounts[4:6] {
+			if _, exist := l.tokenAccounts[feeRecipient]; !exist {
+				return "", fmt.Errorf("fee recipient %s not initialized", feeRecipient.ToBase58())
+			}
+		}
+		rate := new(big.Int).SetUint64(stakeManager.Rate)
+		rate.Mul(rate, new(big.Int).SetUint64(data.NewActive))
+		rate.Div(rate, new(big.Int).SetUint64(data.OldActive))
+		stakeManager.Rate = rate.Uint64()
+		stakeManager.Active = data.NewActive
+		stakeManager.EraRates = append(stakeManager.EraRates, lsdprog.EraRate{Era: stakeManager.LatestEra, Rate: stakeManager.Rate})
+		data.OldActive = 0
+		data.NewActive = 0
+
+	case "era_merge":
+		if len(accounts) < 3 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		src, dst := accounts[1], accounts[2]
+		if !isEmpty(data) {
+			return "", fmt.Errorf("era process not end")
+		}
+		if src == dst || !contains(stakeManager.StakeAccounts, src) || !contains(stakeManager.StakeAccounts, dst) {
+			return "", fmt.Errorf("stake account not exist")
+		}
+		srcAccount, dstAccount := l.stakeAccounts[src], l.stakeAccounts[dst]
+		if srcAccount.state(s.epoch) != client.StakeActivationStateActive || dstAccount.state(s.epoch) != client.StakeActivationStateActive {
+			return "", fmt.Errorf("stake account not active")
+		}
+		if srcAccount.Voter != dstAccount.Voter || srcAccount.CreditsObserved != dstAccount.CreditsObserved {
+			return "", fmt.Errorf("stake accounts not mergeable")
+		}
+		dstAccount.Stake += srcAccount.Stake
+		l.stakeAccounts[dst] = dstAccount
+		delete(l.stakeAccounts, src)
+		stakeManager.StakeAccounts = remove(stakeManager.StakeAccounts, src)
+
+	case "era_withdraw":
+		if len(accounts) < 3 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		stakeAccount := accounts[2]
+		if !contains(stakeManager.SplitAccounts, stakeAccount) {
+			return "", fmt.Errorf("split account %s not exist", stakeAccount.ToBase58())
+		}
+		if l.stakeAccounts[stakeAccount].state(s.epoch) != client.StakeActivationStateInactive {
+			return "", fmt.Errorf("split account %s not inactive", stakeAccount.ToBase58())
+		}
+		delete(l.stakeAccounts, stakeAccount)
+		stakeManager.SplitAccounts = remove(stakeManager.SplitAccounts, stakeAccount)
+
+	case "redelegate":
+		// the split account only passes the stake on, it is left empty
+		if len(accounts) < 8 || len(instruction.Data) < 16 {
+			return "", fmt.Errorf("not enough account keys")
+		}
+		admin, toValidator, from, to := instruction.Accounts[1], accounts[2], accounts[4], accounts[6]
+		amount := binary.LittleEndian.Uint64(instruction.Data[8:16])
+		if admin.PubKey != stakeManager.Admin || !admin.IsSigner {
+			return "", fmt.Errorf("admin not match")
+		}
+		if !contains(stakeManager.Validators, toValidator) {
+			return "", fmt.Errorf("validator %s not exist", toValidator.ToBase58())
+		}
+		if !contains(stakeManager.StakeAccounts, from) {
+			return "", fmt.Errorf("stake account %s not exist", from.ToBase58())
+		}
+		fromAccount := l.stakeAccounts[from]
+		if fromAccount.state(s.epoch) != client.StakeActivationStateActive {
+			return "", fmt.Errorf("stake account %s not active", from.ToBase58())
+		}
+		if amount < s.minDelegation || amount > fromAccount.Stake {
+			return "", fmt.Errorf("redelegate amount %d invalid", amount)
+		}
+		if _, exist := l.stakeAccounts[to]; exist {
+			return "", fmt.Errorf("account %s already in use", to.ToBase58())
+		}
+		fromAccount.Stake -= amount
+		if fromAccount.Stake == 0 {
+			delete(l.stakeAccounts, from)
+			stakeManager.StakeAccounts = remove(stakeManager.StakeAccounts, from)
+		} else {
+			l.stakeAccounts[from] = fromAccount
+		}
+		l.stakeAccounts[to] = StakeAccount{
+			Voter:             toValidator,
+			Stake:             amount,
+			ActivationEpoch:   s.epoch,
+			DeactivationEpoch: math.MaxUint64,
+			CreditsObserved:   s.voteCredits[toValidator],
+		}
+		stakeManager.StakeAccounts = append(stakeManager.StakeAccounts, to)
+	}
+
+	if err := l.putStakeManager(accounts[0], stakeManager); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func isEmpty(data *lsdprog.EraProcessData) bool {
+	return data.NeedBond == 0 && data.NeedUnbond == 0 && data.NewActive == 0 && data.OldActive == 0 && len(data.PendingStakeAccounts) == 0
+}
+
+func contains(list []common.PublicKey, key common.PublicKey) bool {
+	for _, item := range list {
+		if item == key {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []common.PublicKey, key common.PublicKey) []common.PublicKey {
+	kept := make([]common.PublicKey, 0, len(list))
+	for _, item := range list {
+		if item != key {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
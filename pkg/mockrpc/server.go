@@ -0,0 +1,766 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+// Package mockrpc is an in-process Solana json rpc server for end to end tests of the relay.
+// It keeps stack, stake manager, stake and token accounts in memory and runs the era instructions
+// of the lsd program against them, so a client.Client pointed at URL drives real handlers.
+package mockrpc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	bin "github.com/dfuse-io/binary"
+	"github.com/gorilla/websocket"
+	"github.com/mr-tron/base58"
+	"github.com/near/borsh-go"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/tokenprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/computebudget"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/lookuptable"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
+)
+
+const (
+	DefaultMinDelegation = uint64(1e9)
+
+	slotsInEpoch        = 432000
+	blockHeightPerQuery = 10  // getBlockHeight moves the chain on, so a dropped tx expires after a few polls
+	blockhashValidity   = 150 // block heights a blockhash stays valid
+	creditsPerEpoch     = 100
+	stakeAccountSize    = 200
+	mockErrorCode       = 6999 // of injected failures not given a ProgramFailure
+)
+
+// StakeAccount is a delegated stake account. An account delegated in an epoch is activating in it
+// and active from the next one, an account deactivated in an epoch is deactivating in it and inactive from the next one.
+type StakeAccount struct {
+	Voter             common.PublicKey
+	Stake             uint64
+	ActivationEpoch   uint64
+	DeactivationEpoch uint64 // math.MaxUint64 if not deactivated
+	CreditsObserved   uint64
+}
+
+func (a StakeAccount) state(epoch uint64) client.StakeActivationState {
+	switch {
+	case a.DeactivationEpoch != math.MaxUint64 && epoch > a.DeactivationEpoch:
+		return client.StakeActivationStateInactive
+	case a.DeactivationEpoch != math.MaxUint64:
+		return client.StakeActivationStateDeactivating
+	case epoch > a.ActivationEpoch:
+		return client.StakeActivationStateActive
+	default:
+		return client.StakeActivationStateActivating
+	}
+}
+
+type tokenAccount struct {
+	mint  common.PublicKey
+	owner common.PublicKey
+}
+
+type txRecord struct {
+	slot uint64
+	err  interface{}
+	logs []string
+}
+
+// ledger is the state instructions run against, copied before each tx so a failed tx changes nothing
+type ledger struct {
+	stakeManagers map[common.PublicKey][]byte // borsh encoded lsdprog.StakeManager
+	stakeAccounts map[common.PublicKey]StakeAccount
+	tokenAccounts map[common.PublicKey]tokenAccount
+	nonceAccounts map[common.PublicKey]nonceAccount
+	lookupTables  map[common.PublicKey]lookuptable.LookupTable
+}
+
+func (l *ledger) copy() *ledger {
+	c := &ledger{
+		stakeManagers: make(map[common.PublicKey][]byte, len(l.stakeManagers)),
+		stakeAccounts: make(map[common.PublicKey]StakeAccount, len(l.stakeAccounts)),
+		tokenAccounts: make(map[common.PublicKey]tokenAccount, len(l.tokenAccounts)),
+		nonceAccounts: make(map[common.PublicKey]nonceAccount, len(l.nonceAccounts)),
+		lookupTables:  make(map[common.PublicKey]lookuptable.LookupTable, len(l.lookupTables)),
+	}
+	for k, v := range l.stakeManagers {
+		c.stakeManagers[k] = v
+	}
+	for k, v := range l.stakeAccounts {
+		c.stakeAccounts[k] = v
+	}
+	for k, v := range l.tokenAccounts {
+		c.tokenAccounts[k] = v
+	}
+	for k, v := range l.nonceAccounts {
+		c.nonceAccounts[k] = v
+	}
+	for k, v := range l.lookupTables {
+		c.lookupTables[k] = v
+	}
+	return c
+}
+
+type Server struct {
+	URL   string
+	WsURL string
+
+	srv          *httptest.Server
+	lsdProgramID common.PublicKey
+
+	mu            sync.Mutex
+	epoch         uint64
+	slot          uint64
+	blockHeight   uint64
+	blockhashes   uint64
+	recentHashes  map[string]bool // blockhashes handed out
+	minDelegation uint64
+	stacks        map[common.PublicKey]lsdprog.Stack
+	ledger        *ledger
+	voteCredits   map[common.PublicKey]uint64
+	delinquent    map[common.PublicKey]bool
+	commission    map[common.PublicKey]uint8
+	balances      map[common.PublicKey]uint64
+	txs           map[string]*txRecord
+	landed        []string
+	failNext      map[string]int
+	failWith      map[string]ProgramFailure
+	dropNext      int
+	wsConns       map[*wsConn]bool
+	signatureSubs map[string][]signatureSub
+	nextSubID     uint64
+}
+
+// New starts a server at epoch 0 running the lsd program at lsdProgramID, Close it when done.
+func New(lsdProgramID common.PublicKey) *Server {
+	s := &Server{
+		lsdProgramID:  lsdProgramID,
+		slot:          1,
+		blockHeight:   1,
+		minDelegation: DefaultMinDelegation,
+		stacks:        make(map[common.PublicKey]lsdprog.Stack),
+		ledger: &ledger{
+			stakeManagers: make(map[common.PublicKey][]byte),
+			stakeAccounts: make(map[common.PublicKey]StakeAccount),
+			tokenAccounts: make(map[common.PublicKey]tokenAccount),
+			nonceAccounts: make(map[common.PublicKey]nonceAccount),
+			lookupTables:  make(map[common.PublicKey]lookuptable.LookupTable),
+		},
+		voteCredits:   make(map[common.PublicKey]uint64),
+		delinquent:    make(map[common.PublicKey]bool),
+		commission:    make(map[common.PublicKey]uint8),
+		balances:      make(map[common.PublicKey]uint64),
+		recentHashes:  make(map[string]bool),
+		txs:           make(map[string]*txRecord),
+		failNext:      make(map[string]int),
+		failWith:      make(map[string]ProgramFailure),
+		wsConns:       make(map[*wsConn]bool),
+		signatureSubs: make(map[string][]signatureSub),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	s.WsURL = "ws" + strings.TrimPrefix(s.srv.URL, "http")
+	return s
+}
+
+func (s *Server) Close() {
+	s.CloseWs()
+	s.srv.Close()
+}
+
+func (s *Server) SetEpoch(epoch uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.epoch = epoch
+	s.slot = epoch*slotsInEpoch + 1
+}
+
+func (s *Server) Epoch() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.epoch
+}
+
+// AdvanceEpoch moves to the next epoch. Each stake account active in the ending epoch earns reward lamports,
+// and every delegated account observes the credits its validator voted, as the runtime does when paying rewards.
+func (s *Server) AdvanceEpoch(reward uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for voter := range s.voteCredits {
+		s.voteCredits[voter] += creditsPerEpoch
+	}
+	for addr, account := range s.ledger.stakeAccounts {
+		if account.state(s.epoch) == client.StakeActivationStateActive {
+			account.Stake += reward
+		}
+		if account.DeactivationEpoch == math.MaxUint64 {
+			account.CreditsObserved = s.voteCredits[account.Voter]
+		}
+		s.ledger.stakeAccounts[addr] = account
+	}
+	s.epoch++
+	s.slot = s.epoch*slotsInEpoch + 1
+}
+
+func (s *Server) SetMinDelegation(amount uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minDelegation = amount
+}
+
+func (s *Server) SetBalance(addr common.PublicKey, lamports uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balances[addr] = lamports
+}
+
+func (s *Server) AddStack(addr common.PublicKey, stack lsdprog.Stack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stacks[addr] = stack
+}
+
+func (s *Server) AddStakeManager(addr common.PublicKey, stakeManager lsdprog.StakeManager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, validator := range stakeManager.Validators {
+		if _, exist := s.voteCredits[validator]; !exist {
+			s.voteCredits[validator] = 0
+		}
+	}
+	if err := s.ledger.putStakeManager(addr, &stakeManager); err != nil {
+		panic(err)
+	}
+}
+
+// SetDelinquent moves a validator between the current and delinquent vote accounts
+func (s *Server) SetDelinquent(validator common.PublicKey, delinquent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delinquent[validator] = delinquent
+}
+
+func (s *Server) SetCommission(validator common.PublicKey, commission uint8) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.commission[validator] = commission
+}
+
+// UpdateStakeManager changes a stake manager in place, as users staking and unstaking would
+func (s *Server) UpdateStakeManager(addr common.PublicKey, fn func(stakeManager *lsdprog.StakeManager)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stakeManager, err := s.ledger.stakeManager(addr)
+	if err != nil {
+		panic(err)
+	}
+	fn(stakeManager)
+	if err := s.ledger.putStakeManager(addr, stakeManager); err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) StakeManager(addr common.PublicKey) lsdprog.StakeManager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stakeManager, err := s.ledger.stakeManager(addr)
+	if err != nil {
+		panic(err)
+	}
+	return *stakeManager
+}
+
+func (s *Server) AddStakeAccount(addr common.PublicKey, account StakeAccount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ledger.stakeAccounts[addr] = account
+}
+
+func (s *Server) StakeAccount(addr common.PublicKey) (StakeAccount, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	account, exist := s.ledger.stakeAccounts[addr]
+	return account, exist
+}
+
+// FailNext makes the next n txs carrying the lsd instruction, named as in the program like "era_bond", fail on chain
+func (s *Server) FailNext(instruction string, n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext[instruction] = n
+	delete(s.failWith, instruction)
+}
+
+// ProgramFailure is how the lsd program fails an instruction, as seen in the tx meta and logs of a real failure
+type ProgramFailure struct {
+	Code uint32   // custom program error code
+	Logs []string // program logs before the failed log, like the AnchorError log; none for a bare code
+}
+
+// FailNextWith is FailNext with the lsd program failing as given
+func (s *Server) FailNextWith(instruction string, n int, failure ProgramFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext[instruction] = n
+	s.failWith[instruction] = failure
+}
+
+// DropNext accepts the next n txs without ever landing them, as a congested leader would
+func (s *Server) DropNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropNext = n
+}
+
+// Instructions returns the lsd instructions landed so far, in order
+func (s *Server) Instructions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.landed...)
+}
+
+type request struct {
+	ID     interface{}       `json:"id"`
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWs(w, r)
+		return
+	}
+	req := request{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	result, rpcErr := s.handle(&req)
+	s.mu.Unlock()
+
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+	if rpcErr != nil {
+		res["error"] = rpcErr
+	} else {
+		res["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *Server) context() map[string]interface{} {
+	return map[string]interface{}{"slot": s.slot}
+}
+
+func (s *Server) withContext(value interface{}) map[string]interface{} {
+	return map[string]interface{}{"context": s.context(), "value": value}
+}
+
+func (s *Server) handle(req *request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "getAccountInfo":
+		var addr string
+		cfg := struct {
+			DataSlice *client.GetAccountInfoConfigDataSlice `json:"dataSlice"`
+		}{}
+		if err := decodeParams(req.Params, &addr, &cfg); err != nil {
+			return nil, err
+		}
+		return s.withContext(s.accountInfo(common.PublicKeyFromString(addr), cfg.DataSlice)), nil
+	case "getStakeActivation":
+		var addr string
+		if err := decodeParams(req.Params, &addr); err != nil {
+			return nil, err
+		}
+		account, exist := s.ledger.stakeAccounts[common.PublicKeyFromString(addr)]
+		if !exist {
+			return nil, &rpcError{Code: -32602, Message: "Invalid param: not a stake account"}
+		}
+		state := account.state(s.epoch)
+		res := client.GetStakeActivationResponse{State: state}
+		if state == client.StakeActivationStateActive || state == client.StakeActivationStateDeactivating {
+			res.Active = account.Stake
+		} else {
+			res.Inactive = account.Stake
+		}
+		return res, nil
+	case "getEpochInfo":
+		return client.GetEpochInfoResponse{
+			AbsoluteSlot: int(s.slot),
+			BlockHeight:  int(s.blockHeight),
+			Epoch:        int(s.epoch),
+			SlotIndex:    int(s.slot % slotsInEpoch),
+			SlotsInEpoch: slotsInEpoch,
+		}, nil
+	case "getSlot":
+		return s.slot, nil
+	case "getStakeMinimumDelegation":
+		return s.withContext(s.minDelegation), nil
+	case "getMinimumBalanceForRentExemption":
+		return uint64(2282880), nil
+	case "getBalance":
+		var addr string
+		if err := decodeParams(req.Params, &addr); err != nil {
+			return nil, err
+		}
+		return s.withContext(s.balances[common.PublicKeyFromString(addr)]), nil
+	case "getLatestBlockhash":
+		s.blockhashes++
+		hash := sha256.Sum256([]byte(fmt.Sprintf("blockhash %d", s.blockhashes)))
+		s.recentHashes[base58.Encode(hash[:])] = true
+		return s.withContext(map[string]interface{}{
+			"blockhash":            base58.Encode(hash[:]),
+			"lastValidBlockHeight": s.blockHeight + blockhashValidity,
+		}), nil
+	case "getBlockHeight":
+		s.blockHeight += blockHeightPerQuery
+		return s.blockHeight, nil
+	case "getRecentPrioritizationFees":
+		return []interface{}{}, nil
+	case "getVoteAccounts":
+		current := make([]map[string]interface{}, 0, len(s.voteCredits))
+		delinquent := make([]map[string]interface{}, 0)
+		for voter, credits := range s.voteCredits {
+			voteAccount := map[string]interface{}{
+				"votePubkey":   voter.ToBase58(),
+				"nodePubkey":   voter.ToBase58(),
+				"commission":   s.commission[voter],
+				"epochCredits": [][]uint64{{s.epoch, credits, 0}},
+			}
+			if s.delinquent[voter] {
+				delinquent = append(delinquent, voteAccount)
+			} else {
+				current = append(current, voteAccount)
+			}
+		}
+		return map[string]interface{}{"current": current, "delinquent": delinquent}, nil
+	case "getBlockProduction":
+		return s.withContext(map[string]interface{}{
+			"byIdentity": map[string]interface{}{},
+			"range":      map[string]interface{}{"firstSlot": s.slot, "lastSlot": s.slot},
+		}), nil
+	case "getSignatureStatuses":
+		var signatures []string
+		if err := decodeParams(req.Params, &signatures); err != nil {
+			return nil, err
+		}
+		statuses := make([]interface{}, len(signatures))
+		for i, signature := range signatures {
+			if tx, exist := s.txs[signature]; exist {
+				statuses[i] = map[string]interface{}{
+					"slot":               tx.slot,
+					"confirmations":      nil,
+					"confirmationStatus": client.CommitmentFinalized,
+					"err":                tx.err,
+				}
+			}
+		}
+		return s.withContext(statuses), nil
+	case "getTransaction":
+		var signature string
+		if err := decodeParams(req.Params, &signature); err != nil {
+			return nil, err
+		}
+		tx, exist := s.txs[signature]
+		if !exist {
+			return nil, nil
+		}
+		return map[string]interface{}{
+			"slot": tx.slot,
+			"meta": map[string]interface{}{"err": tx.err, "logMessages": tx.logs},
+			"transaction": map[string]interface{}{
+				"signatures": []string{signature},
+				"message":    map[string]interface{}{"accountKeys": []string{}, "instructions": []interface{}{}},
+			},
+		}, nil
+	case "sendTransaction":
+		return s.sendTransaction(req.Params)
+	case "simulateTransaction":
+		return s.simulateTransaction(req.Params)
+	default:
+		return nil, &rpcError{Code: -32601, Message: "Method not found"}
+	}
+}
+
+// decodeParams decodes leading params into dst, missing params are left as is
+func decodeParams(params []json.RawMessage, dst ...interface{}) *rpcError {
+	for i := range dst {
+		if i >= len(params) {
+			break
+		}
+		if err := json.Unmarshal(params[i], dst[i]); err != nil {
+			return &rpcError{Code: -32602, Message: fmt.Sprintf("Invalid params: %s", err)}
+		}
+	}
+	return nil
+}
+
+func (s *Server) accountInfo(addr common.PublicKey, dataSlice *client.GetAccountInfoConfigDataSlice) interface{} {
+	var owner common.PublicKey
+	var data []byte
+	if stack, exist := s.stacks[addr]; exist {
+		owner = s.lsdProgramID
+		data = anchorAccountData("Stack", &stack)
+	} else if raw, exist := s.ledger.stakeManagers[addr]; exist {
+		owner = s.lsdProgramID
+		discriminator := sha256.Sum256([]byte("account:StakeManager"))
+		data = append(discriminator[:8], raw...)
+	} else if account, exist := s.ledger.stakeAccounts[addr]; exist {
+		owner = common.StakeProgramID
+		data = account.encode()
+	} else if account, exist := s.ledger.tokenAccounts[addr]; exist {
+		owner = common.TokenProgramID
+		data = account.encode()
+	} else if account, exist := s.ledger.nonceAccounts[addr]; exist {
+		owner = common.SystemProgramID
+		data = account.encode()
+	} else if table, exist := s.ledger.lookupTables[addr]; exist {
+		owner = lookuptable.ProgramID
+		data = table.Serialize()
+	} else if _, exist := s.balances[addr]; exist {
+		owner = common.SystemProgramID
+	} else {
+		return nil
+	}
+
+	if dataSlice != nil {
+		start := dataSlice.Offset
+		if start > uint64(len(data)) {
+			start = uint64(len(data))
+		}
+		end := start + dataSlice.Length
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		data = data[start:end]
+	}
+	return map[string]interface{}{
+		"lamports":   s.balances[addr],
+		"owner":      owner.ToBase58(),
+		"executable": false,
+		"rentEpoch":  0,
+		"data":       []string{base64.StdEncoding.EncodeToString(data), "base64"},
+	}
+}
+
+func anchorAccountData(name string, account interface{}) []byte {
+	raw, err := borsh.Serialize(account)
+	if err != nil {
+		panic(err)
+	}
+	discriminator := sha256.Sum256([]byte("account:" + name))
+	return append(discriminator[:8], raw...)
+}
+
+func (a *StakeAccount) encode() []byte {
+	account := client.StakeAccount{Type: 2}
+	account.Info.Stake.Delegation.Voter = a.Voter
+	account.Info.Stake.Delegation.Stake = int64(a.Stake)
+	account.Info.Stake.Delegation.ActivationEpoch = int64(a.ActivationEpoch)
+	account.Info.Stake.Delegation.DeactivationEpoch = int64(a.DeactivationEpoch) // u64::MAX reads as -1
+	account.Info.Stake.Delegation.WarmupCooldownRate = 0.25
+	account.Info.Stake.CreditsObserved = a.CreditsObserved
+
+	buf := new(bytes.Buffer)
+	if err := bin.NewEncoder(buf).Encode(&account); err != nil {
+		panic(err)
+	}
+	data := buf.Bytes()
+	if len(data) < stakeAccountSize {
+		data = append(data, make([]byte, stakeAccountSize-len(data))...)
+	}
+	return data
+}
+
+func (a *tokenAccount) encode() []byte {
+	data := make([]byte, tokenprog.TokenAccountSize)
+	copy(data[:32], a.mint[:])
+	copy(data[32:64], a.owner[:])
+	data[108] = byte(tokenprog.TokenAccountStateInitialized)
+	return data
+}
+
+func (l *ledger) stakeManager(addr common.PublicKey) (*lsdprog.StakeManager, error) {
+	raw, exist := l.stakeManagers[addr]
+	if !exist {
+		return nil, fmt.Errorf("stake manager %s not found", addr.ToBase58())
+	}
+	stakeManager := lsdprog.StakeManager{}
+	if err := borsh.Deserialize(&stakeManager, raw); err != nil {
+		return nil, err
+	}
+	return &stakeManager, nil
+}
+
+func (l *ledger) putStakeManager(addr common.PublicKey, stakeManager *lsdprog.StakeManager) error {
+	raw, err := borsh.Serialize(*stakeManager)
+	if err != nil {
+		return err
+	}
+	l.stakeManagers[addr] = raw
+	return nil
+}
+
+// decodedTx is a legacy or v0 tx with its lookups resolved
+type decodedTx struct {
+	recentBlockHash string
+	instructions    []types.Instruction
+}
+
+func (s *Server) decodeTx(params []json.RawMessage) ([]byte, *decodedTx, *rpcError) {
+	var encoded string
+	if err := decodeParams(params, &encoded); err != nil {
+		return nil, nil, err
+	}
+	rawTx, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(rawTx) < 65 {
+		return nil, nil, &rpcError{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+	}
+	if !versionedtx.IsVersioned(rawTx) {
+		tx, err := types.TransactionDeserialize(rawTx)
+		if err != nil {
+			return nil, nil, &rpcError{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+		}
+		return rawTx, &decodedTx{recentBlockHash: tx.Message.RecentBlockHash, instructions: tx.Message.DecompileInstructions()}, nil
+	}
+	tx, err := versionedtx.TransactionDeserialize(rawTx)
+	if err != nil {
+		return nil, nil, &rpcError{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+	}
+	instructions, err := tx.Message.DecompileInstructions(s.ledger.lookupTableAddresses())
+	if err != nil {
+		return nil, nil, &rpcError{Code: -32602, Message: fmt.Sprintf("invalid transaction: %v", err)}
+	}
+	return rawTx, &decodedTx{recentBlockHash: tx.Message.RecentBlockHash, instructions: instructions}, nil
+}
+
+// sendTransaction lands the tx at once and finalized, or not at all if dropped or its durable nonce is not current.
+// Blockhashes never expire, a tx advancing a nonce under a recent blockhash is taken as a plain tx.
+func (s *Server) sendTransaction(params []json.RawMessage) (interface{}, *rpcError) {
+	rawTx, tx, rpcErr := s.decodeTx(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	signature := base58.Encode(rawTx[1:65])
+	if _, exist := s.txs[signature]; exist {
+		return signature, nil
+	}
+	if s.dropNext > 0 {
+		s.dropNext--
+		return signature, nil
+	}
+	if addr, ok := durableNonce(tx); ok && !s.recentHashes[tx.recentBlockHash] &&
+		s.ledger.nonceAccounts[addr].nonce.ToBase58() != tx.recentBlockHash {
+		return signature, nil
+	}
+
+	s.slot++
+	record := &txRecord{slot: s.slot}
+	landed, err, logs := s.execute(tx, true)
+	if err != nil {
+		record.err = err
+		// a failed durable nonce tx still advances its nonce, as the fee is still charged
+		if _, ok := durableNonce(tx); ok {
+			s.ledger.advanceNonce(tx.instructions[0])
+		}
+	} else {
+		s.landed = append(s.landed, landed...)
+	}
+	record.logs = logs
+	s.txs[signature] = record
+	s.signatureLanded(signature, record)
+	return signature, nil
+}
+
+func (s *Server) simulateTransaction(params []json.RawMessage) (interface{}, *rpcError) {
+	_, tx, rpcErr := s.decodeTx(params)
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	_, err, logs := s.execute(tx, false)
+	return s.withContext(map[string]interface{}{
+		"err":           err,
+		"logs":          logs,
+		"unitsConsumed": 1000 * len(tx.instructions),
+	}), nil
+}
+
+// execute runs the instructions of tx in order, the state is kept only if all of them succeed and commit is set.
+// It returns the lsd instructions run, the tx error in rpc format and the program logs.
+func (s *Server) execute(tx *decodedTx, commit bool) ([]string, interface{}, []string) {
+	working := s.ledger.copy()
+	landed := make([]string, 0)
+	logs := make([]string, 0)
+	for i, instruction := range tx.instructions {
+		logs = append(logs, fmt.Sprintf("Program %s invoke [1]", instruction.ProgramID.ToBase58()))
+		var err error
+		switch instruction.ProgramID {
+		case s.lsdProgramID:
+			var name string
+			name, err = s.executeLsd(working, instruction, commit)
+			if err == nil {
+				landed = append(landed, name)
+			}
+		case common.SPLAssociatedTokenAccountProgramID:
+			err = executeCreateAssociatedTokenAccount(working, instruction)
+		case common.SystemProgramID:
+			err = executeSystem(working, instruction)
+		case lookuptable.ProgramID:
+			err = s.executeLookupTable(working, instruction)
+		case computebudget.ProgramID:
+		default:
+			err = fmt.Errorf("program %s not supported", instruction.ProgramID.ToBase58())
+		}
+		if err != nil {
+			failure := ProgramFailure{Code: mockErrorCode, Logs: []string{
+				fmt.Sprintf("Program log: AnchorError occurred. Error Code: MockError. Error Number: %d. Error Message: %s.", mockErrorCode, err),
+			}}
+			var programErr *programError
+			if errors.As(err, &programErr) {
+				failure = programErr.failure
+			}
+			logs = append(logs, failure.Logs...)
+			logs = append(logs, fmt.Sprintf("Program %s failed: custom program error: %#x", instruction.ProgramID.ToBase58(), failure.Code))
+			return nil, map[string]interface{}{
+				"InstructionError": []interface{}{i, map[string]interface{}{"Custom": failure.Code}},
+			}, logs
+		}
+		logs = append(logs, fmt.Sprintf("Program %s success", instruction.ProgramID.ToBase58()))
+	}
+	if commit {
+		s.ledger = working
+	}
+	return landed, nil, logs
+}
+
+func executeCreateAssociatedTokenAccount(l *ledger, instruction types.Instruction) error {
+	if len(instruction.Accounts) < 4 {
+		return fmt.Errorf("not enough account keys")
+	}
+	ata := instruction.Accounts[1].PubKey
+	if _, exist := l.tokenAccounts[ata]; exist {
+		return fmt.Errorf("account %s already in use", ata.ToBase58())
+	}
+	l.tokenAccounts[ata] = tokenAccount{owner: instruction.Accounts[2].PubKey, mint: instruction.Accounts[3].PubKey}
+	return nil
+}
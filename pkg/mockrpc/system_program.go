@@ -0,0 +1,91 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package mockrpc
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/sysprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+type nonceAccount struct {
+	authority common.PublicKey
+	nonce     common.PublicKey
+}
+
+func (a *nonceAccount) encode() []byte {
+	data := make([]byte, sysprog.NonceAccountSize)
+	binary.LittleEndian.PutUint32(data[0:4], 1) // current version
+	binary.LittleEndian.PutUint32(data[4:8], 1) // initialized
+	copy(data[8:40], a.authority[:])
+	copy(data[40:72], a.nonce[:])
+	binary.LittleEndian.PutUint64(data[72:80], 5000)
+	return data
+}
+
+// AddNonceAccount creates an initialized durable nonce account advanced by authority
+func (s *Server) AddNonceAccount(addr, authority common.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ledger.nonceAccounts[addr] = nonceAccount{
+		authority: authority,
+		nonce:     sha256.Sum256(append([]byte("nonce"), addr[:]...)),
+	}
+}
+
+// Nonce returns the current nonce of a nonce account, the zero key if there is none
+func (s *Server) Nonce(addr common.PublicKey) common.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ledger.nonceAccounts[addr].nonce
+}
+
+func systemInstruction(instruction types.Instruction) (sysprog.Instruction, bool) {
+	if instruction.ProgramID != common.SystemProgramID || len(instruction.Data) < 4 {
+		return 0, false
+	}
+	return sysprog.Instruction(binary.LittleEndian.Uint32(instruction.Data[:4])), true
+}
+
+// durableNonce returns the nonce account of a durable nonce tx, one advancing a nonce in its first instruction
+func durableNonce(tx *decodedTx) (common.PublicKey, bool) {
+	instructions := tx.instructions
+	if len(instructions) == 0 {
+		return common.PublicKey{}, false
+	}
+	if kind, ok := systemInstruction(instructions[0]); !ok || kind != sysprog.InstructionAdvanceNonceAccount || len(instructions[0].Accounts) == 0 {
+		return common.PublicKey{}, false
+	}
+	return instructions[0].Accounts[0].PubKey, true
+}
+
+// executeSystem runs AdvanceNonceAccount, other system instructions are taken as succeeded without effect
+func executeSystem(l *ledger, instruction types.Instruction) error {
+	kind, ok := systemInstruction(instruction)
+	if !ok || kind != sysprog.InstructionAdvanceNonceAccount {
+		return nil
+	}
+	return l.advanceNonce(instruction)
+}
+
+func (l *ledger) advanceNonce(instruction types.Instruction) error {
+	if len(instruction.Accounts) < 3 {
+		return fmt.Errorf("not enough account keys")
+	}
+	addr := instruction.Accounts[0].PubKey
+	account, exist := l.nonceAccounts[addr]
+	if !exist {
+		return fmt.Errorf("nonce account %s not found", addr.ToBase58())
+	}
+	if authority := instruction.Accounts[2]; authority.PubKey != account.authority || !authority.IsSigner {
+		return fmt.Errorf("nonce authority %s did not sign", account.authority.ToBase58())
+	}
+	account.nonce = sha256.Sum256(account.nonce[:])
+	l.nonceAccounts[addr] = account
+	return nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package mockrpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn is a pubsub connection, the server writes notifications to it from the rpc handlers
+type wsConn struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+}
+
+func (c *wsConn) write(msg interface{}) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.WriteJSON(msg)
+}
+
+type signatureSub struct {
+	conn *wsConn
+	id   uint64
+}
+
+// serveWs answers signatureSubscribe on the websocket endpoint, WsURL. A signature is notified once its tx lands,
+// at once if it already has, and the subscription is dropped then, as a node does.
+func (s *Server) serveWs(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsConn{conn: conn}
+	s.mu.Lock()
+	s.wsConns[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.wsConns, c)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		req := request{}
+		if err := conn.ReadJSON(&req); err != nil {
+			return
+		}
+		res := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		var landed *txRecord
+		var landedSub signatureSub
+		s.mu.Lock()
+		switch req.Method {
+		case "signatureSubscribe":
+			var signature string
+			if err := decodeParams(req.Params, &signature); err != nil {
+				res["error"] = err
+				break
+			}
+			s.nextSubID++
+			res["result"] = s.nextSubID
+			sub := signatureSub{conn: c, id: s.nextSubID}
+			if tx, exist := s.txs[signature]; exist {
+				landed, landedSub = tx, sub
+				break
+			}
+			s.signatureSubs[signature] = append(s.signatureSubs[signature], sub)
+		case "signatureUnsubscribe":
+			var id uint64
+			if err := decodeParams(req.Params, &id); err != nil {
+				res["error"] = err
+				break
+			}
+			found := false
+			for signature, subs := range s.signatureSubs {
+				for i, sub := range subs {
+					if sub.conn == c && sub.id == id {
+						s.signatureSubs[signature] = append(subs[:i], subs[i+1:]...)
+						found = true
+						break
+					}
+				}
+			}
+			if found {
+				res["result"] = true
+			} else {
+				res["error"] = &rpcError{Code: -32602, Message: "Invalid subscription id."}
+			}
+		default:
+			res["error"] = &rpcError{Code: -32601, Message: "Method not found"}
+		}
+		s.mu.Unlock()
+		c.write(res)
+		// after the answer, the client takes notifications only once it knows the subscription
+		if landed != nil {
+			notifySignature(landedSub, landed)
+		}
+	}
+}
+
+// signatureLanded notifies the subscribers of a landed tx
+func (s *Server) signatureLanded(signature string, tx *txRecord) {
+	for _, sub := range s.signatureSubs[signature] {
+		notifySignature(sub, tx)
+	}
+	delete(s.signatureSubs, signature)
+}
+
+func notifySignature(sub signatureSub, tx *txRecord) {
+	result, _ := json.Marshal(map[string]interface{}{
+		"context": map[string]interface{}{"slot": tx.slot},
+		"value":   map[string]interface{}{"err": tx.err},
+	})
+	sub.conn.write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  "signatureNotification",
+		"params":  map[string]interface{}{"subscription": sub.id, "result": json.RawMessage(result)},
+	})
+}
+
+// CloseWs breaks every websocket connection, as a node restarting would
+func (s *Server) CloseWs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.wsConns {
+		c.conn.Close()
+	}
+	s.signatureSubs = make(map[string][]signatureSub)
+}
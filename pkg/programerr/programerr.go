@@ -0,0 +1,227 @@
+// Package programerr decodes the error of a failed tx, as given in its meta and logs, into a named error.
+// System and stake program errors are decoded by code. Errors of anchor programs, the lsd program included,
+// are named only by the AnchorError log the program writes before failing, a bare custom code is left unnamed.
+package programerr
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+)
+
+var (
+	// ErrAlreadyProcessed is wrapped by lsd program errors telling the instruction has nothing left to do,
+	// the era step was done by another tx. The relay takes them as success.
+	ErrAlreadyProcessed = errors.New("already processed")
+	// ErrHalt is wrapped by lsd program errors the relay can not get past by retrying, it stops handling the
+	// stake manager until an operator steps in.
+	ErrHalt = errors.New("halt")
+)
+
+// Error is a decoded tx error
+type Error struct {
+	Instruction int    // index of the failed instruction, -1 if the tx failed as a whole
+	Program     string // program that raised a custom error, empty for builtin and tx errors
+	Code        uint32 // custom error code, set if Custom
+	Custom      bool
+	Name        string // like "TooSoonToRedelegate", "Custom" if the code is not known
+	Message     string // explanation, empty if not known
+
+	kind error
+}
+
+func (e *Error) Error() string {
+	s := e.Name
+	if e.Custom {
+		s = fmt.Sprintf("%s error %s (%#x)", e.Program, e.Name, e.Code)
+	}
+	if e.Instruction >= 0 {
+		s = fmt.Sprintf("instruction %d: %s", e.Instruction, s)
+	}
+	if len(e.Message) != 0 {
+		s = fmt.Sprintf("%s: %s", s, e.Message)
+	}
+	return s
+}
+
+// Unwrap returns ErrAlreadyProcessed or ErrHalt if the error is one the relay reacts to
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+var (
+	failedLogRegexp = regexp.MustCompile(`^Program (\w+) failed: custom program error: 0x([0-9a-fA-F]+)$`)
+	anchorLogRegexp = regexp.MustCompile(`AnchorError.*Error Code: (\w+)\. Error Number: (\d+)\. Error Message: (.*)\.$`)
+)
+
+// Decoder decodes tx errors, telling the errors of LsdProgramID the relay reacts to
+type Decoder struct {
+	LsdProgramID common.PublicKey
+}
+
+// Decode decodes the err of a failed tx meta or simulation, in rpc json format, with the help of the tx logs.
+// programs are those of the tx instructions in order, a custom error is put on the program of the failed
+// instruction if no log tells the program raising it. It returns nil if metaErr is nil.
+func (d Decoder) Decode(metaErr interface{}, logs []string, programs []common.PublicKey) *Error {
+	switch e := metaErr.(type) {
+	case nil:
+		return nil
+	case string:
+		return &Error{Instruction: -1, Name: e, Message: txErrors[e]}
+	case map[string]interface{}:
+		detail, exist := e["InstructionError"].([]interface{})
+		if !exist || len(detail) != 2 {
+			for name := range e {
+				return &Error{Instruction: -1, Name: name, Message: txErrors[name]}
+			}
+			return &Error{Instruction: -1, Name: fmt.Sprint(metaErr)}
+		}
+		index, _ := detail[0].(float64)
+		switch detailErr := detail[1].(type) {
+		case string:
+			return &Error{Instruction: int(index), Name: detailErr, Message: instructionErrors[detailErr]}
+		case map[string]interface{}:
+			if code, exist := detailErr["Custom"].(float64); exist {
+				return d.decodeCustom(int(index), uint32(code), logs, programs)
+			}
+			for name := range detailErr {
+				return &Error{Instruction: int(index), Name: name, Message: instructionErrors[name]}
+			}
+		}
+		return &Error{Instruction: int(index), Name: fmt.Sprint(detail[1])}
+	default:
+		return &Error{Instruction: -1, Name: fmt.Sprint(metaErr)}
+	}
+}
+
+// decodeCustom names a custom error. The first failed log with the code is the innermost program failing, the
+// one that raised it, as logs of a cpi come before those of its caller. An anchor program logs the error it fails
+// with right before, so the name is taken from the last AnchorError log before the failed log. Without logs, the
+// error is put on the program of the failed instruction and left unnamed unless the code is a system or stake one.
+func (d Decoder) decodeCustom(index int, code uint32, logs []string, programs []common.PublicKey) *Error {
+	e := &Error{Instruction: index, Code: code, Custom: true, Name: "Custom"}
+	var program common.PublicKey
+	var anchorLog []string
+	found, named := false, false
+	for _, log := range logs {
+		if match := anchorLogRegexp.FindStringSubmatch(log); match != nil {
+			anchorLog = match
+			continue
+		}
+		match := failedLogRegexp.FindStringSubmatch(log)
+		if match == nil {
+			continue
+		}
+		logCode, err := strconv.ParseUint(match[2], 16, 32)
+		if err != nil || uint32(logCode) != code {
+			anchorLog = nil
+			continue
+		}
+		program = common.PublicKeyFromString(match[1])
+		found = true
+		if anchorLog != nil && anchorLog[2] == strconv.FormatUint(uint64(code), 10) {
+			e.Name, e.Message = anchorLog[1], anchorLog[3]
+			named = true
+		}
+		break
+	}
+	if !found && index >= 0 && index < len(programs) {
+		program = programs[index]
+		found = true
+	}
+
+	var table map[uint32][2]string
+	switch {
+	case !found:
+		e.Program = "program"
+	case program == common.SystemProgramID:
+		e.Program, table = "system program", systemErrors
+	case program == common.StakeProgramID:
+		e.Program, table = "stake program", stakeErrors
+	case program == d.LsdProgramID:
+		e.Program = "lsd program"
+	default:
+		e.Program = program.ToBase58()
+	}
+	if known, exist := table[code]; exist {
+		e.Name, e.Message = known[0], known[1]
+	}
+	// only an error the lsd program logged by name is reacted to, a bare code is retried as any other failure
+	if named && program == d.LsdProgramID {
+		e.kind = lsdErrorKinds[e.Name]
+	}
+	return e
+}
+
+// lsdErrorKinds are the lsd program errors the relay reacts to, by the name the program logs them with.
+// A name the program does not log never matches, its failures are then retried as any other.
+var lsdErrorKinds = map[string]error{
+	"EraIsLatest":           ErrAlreadyProcessed,
+	"EraIsProcessed":        ErrAlreadyProcessed,
+	"EraNoNeedBond":         ErrAlreadyProcessed,
+	"EraNoNeedUnBond":       ErrAlreadyProcessed,
+	"EraNoNeedUpdateActive": ErrAlreadyProcessed,
+	"EraNoNeedUpdateRate":   ErrAlreadyProcessed,
+
+	"RateChangeOverLimit": ErrHalt,
+	"AdminNotMatch":       ErrHalt,
+	"ProgramIdNotMatch":   ErrHalt,
+}
+
+// systemErrors are the custom errors of the system program, SystemError
+var systemErrors = map[uint32][2]string{
+	0: {"AccountAlreadyInUse", "an account with the same address already exists"},
+	1: {"ResultWithNegativeLamports", "account does not have enough SOL to perform the operation"},
+	2: {"InvalidProgramId", "cannot assign account to this program id"},
+	3: {"InvalidAccountDataLength", "cannot allocate account data of this length"},
+	4: {"MaxSeedLengthExceeded", "length of requested seed is too long"},
+	5: {"AddressWithSeedMismatch", "provided address does not match addressed derived from seed"},
+	6: {"NonceNoRecentBlockhashes", "advancing stored nonce requires a populated RecentBlockhashes sysvar"},
+	7: {"NonceBlockhashNotExpired", "stored nonce is still in recent_blockhashes"},
+	8: {"NonceUnexpectedBlockhashValue", "specified nonce does not match stored nonce"},
+}
+
+// stakeErrors are the custom errors of the stake program, StakeError
+var stakeErrors = map[uint32][2]string{
+	0:  {"NoCreditsToRedeem", "not enough credits to redeem"},
+	1:  {"LockupInForce", "lockup has not yet expired"},
+	2:  {"AlreadyDeactivated", "stake already deactivated"},
+	3:  {"TooSoonToRedelegate", "one re-delegation permitted per epoch"},
+	4:  {"InsufficientStake", "split amount is more than is staked"},
+	5:  {"MergeTransientStake", "stake account with transient stake cannot be merged"},
+	6:  {"MergeMismatch", "stake account merge failed due to different authority, lockups or state"},
+	7:  {"CustodianMissing", "custodian address not present"},
+	8:  {"CustodianSignatureMissing", "custodian signature not present"},
+	9:  {"InsufficientReferenceVotes", "insufficient voting activity in the reference vote account"},
+	10: {"VoteAddressMismatch", "stake account is not delegated to the provided vote account"},
+	11: {"MinimumDelinquentEpochsForDeactivationNotMet", "stake account has not been delinquent for the minimum epochs required for deactivation"},
+	12: {"InsufficientDelegation", "delegation amount is less than the minimum"},
+	13: {"RedelegateTransientOrInactiveStake", "stake account with transient or inactive stake cannot be redelegated"},
+	14: {"RedelegateToSameVoteAccount", "stake redelegation to the same vote account is not permitted"},
+	15: {"RedelegatedStakeMustFullyActivateBeforeDeactivationIsPermitted", "redelegated stake must be fully activated before deactivation"},
+	16: {"EpochRewardsActive", "stake action is not permitted while the epoch rewards period is active"},
+}
+
+// instructionErrors explain the builtin instruction errors the relay may run into
+var instructionErrors = map[string]string{
+	"InsufficientFunds":           "an account does not have enough lamports",
+	"InvalidAccountData":          "an account data is not what the program expects",
+	"AccountAlreadyInitialized":   "an account to initialize is already initialized",
+	"UninitializedAccount":        "an account is not initialized",
+	"MissingRequiredSignature":    "a signature required by the program is missing",
+	"ComputationalBudgetExceeded": "compute unit limit exceeded, raise the limit",
+	"ProgramFailedToComplete":     "program ran out of compute units or aborted",
+	"IncorrectProgramId":          "an account is owned by an unexpected program",
+}
+
+// txErrors explain the tx errors the relay may run into
+var txErrors = map[string]string{
+	"InsufficientFundsForFee": "fee payer can not pay the fee, top up the fee payer",
+	"AccountNotFound":         "fee payer account not found, fund the fee payer",
+	"BlockhashNotFound":       "blockhash expired or unknown",
+	"AlreadyProcessed":        "tx already processed",
+	"AccountInUse":            "an account is locked by another tx in the block",
+}
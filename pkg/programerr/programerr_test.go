@@ -0,0 +1,90 @@
+package programerr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+)
+
+func TestDecode(t *testing.T) {
+	lsdProgram := "8w6Lf6wj1BSsu9UPc1hHazqpGvY4QcEbMaRGDDpHhTtA"
+	decoder := Decoder{LsdProgramID: common.PublicKeyFromString(lsdProgram)}
+	tests := []struct {
+		name     string
+		metaErr  interface{}
+		logs     []string
+		programs []common.PublicKey
+		want     string
+		kind     error
+	}{
+		{
+			name:    "lsd program",
+			metaErr: map[string]interface{}{"InstructionError": []interface{}{float64(1), map[string]interface{}{"Custom": float64(6005)}}},
+			logs: []string{
+				"Program " + lsdProgram + " invoke [1]",
+				"Program log: AnchorError thrown in programs/lsd_program/src/era_update_rate.rs:87. Error Code: RateChangeOverLimit. Error Number: 6005. Error Message: Rate change over limit.",
+				"Program " + lsdProgram + " failed: custom program error: 0x1775",
+			},
+			want: "instruction 1: lsd program error RateChangeOverLimit (0x1775): Rate change over limit",
+			kind: ErrHalt,
+		},
+		{
+			name:    "lsd program error logged by another program",
+			metaErr: map[string]interface{}{"InstructionError": []interface{}{float64(1), map[string]interface{}{"Custom": float64(6005)}}},
+			logs: []string{
+				"Program log: AnchorError occurred. Error Code: RateChangeOverLimit. Error Number: 6005. Error Message: Rate change over limit.",
+				"Program " + common.SystemProgramID.ToBase58() + " failed: custom program error: 0x7",
+				"Program " + lsdProgram + " failed: custom program error: 0x1775",
+			},
+			want: "instruction 1: lsd program error Custom (0x1775)",
+		},
+		{
+			name:     "lsd program without logs",
+			metaErr:  map[string]interface{}{"InstructionError": []interface{}{float64(1), map[string]interface{}{"Custom": float64(6005)}}},
+			programs: []common.PublicKey{common.SystemProgramID, decoder.LsdProgramID},
+			want:     "instruction 1: lsd program error Custom (0x1775)",
+		},
+		{
+			name:    "stake program through cpi",
+			metaErr: map[string]interface{}{"InstructionError": []interface{}{float64(0), map[string]interface{}{"Custom": float64(3)}}},
+			logs: []string{
+				"Program " + common.StakeProgramID.ToBase58() + " failed: custom program error: 0x3",
+				"Program " + lsdProgram + " failed: custom program error: 0x3",
+			},
+			want: "instruction 0: stake program error TooSoonToRedelegate (0x3): one re-delegation permitted per epoch",
+		},
+		{
+			name:    "unknown custom",
+			metaErr: map[string]interface{}{"InstructionError": []interface{}{float64(0), map[string]interface{}{"Custom": float64(7)}}},
+			want:    "instruction 0: program error Custom (0x7)",
+		},
+		{
+			name:    "builtin",
+			metaErr: map[string]interface{}{"InstructionError": []interface{}{float64(2), "MissingRequiredSignature"}},
+			want:    "instruction 2: MissingRequiredSignature: a signature required by the program is missing",
+		},
+		{
+			name:    "tx",
+			metaErr: "InsufficientFundsForFee",
+			want:    "InsufficientFundsForFee: fee payer can not pay the fee, top up the fee payer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := decoder.Decode(tt.metaErr, tt.logs, tt.programs)
+			if err.Error() != tt.want {
+				t.Fatalf("err: %s, want: %s", err, tt.want)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Fatalf("err %s not %s", err, tt.kind)
+			}
+			if tt.kind == nil && err.Unwrap() != nil {
+				t.Fatalf("err %s is %s", err, err.Unwrap())
+			}
+		})
+	}
+	if decoder.Decode(nil, nil, nil) != nil {
+		t.Fatal("nil meta err decoded")
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 stafiprotocol
+// SPDX-License-Identifier: LGPL-3.0-only
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Client covers the rpc methods missing in solana-go-sdk's client.
+// Unlike the sdk client it never sleeps and retries on rpc errors, it only falls back to the next endpoint,
+// trying the healthiest endpoint of its pool first.
+type Client struct {
+	endpointList []string
+	httpClient   *http.Client
+	pool         *EndpointPool
+
+	Broadcast int // endpoints a tx is sent to at once, healthiest first, all if 0
+}
+
+func NewClient(endpointList []string) *Client {
+	if len(endpointList) == 0 {
+		panic("endpoint empty")
+	}
+	return &Client{
+		endpointList: endpointList,
+		httpClient:   &http.Client{Timeout: 30 * time.Second},
+		pool:         NewEndpointPool(endpointList),
+	}
+}
+
+func (c *Client) Pool() *EndpointPool {
+	return c.pool
+}
+
+type ErrorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ErrorResponse) Error() string {
+	return fmt.Sprintf("rpc error, code: %d, msg: %s", e.Code, e.Message)
+}
+
+type generalResponse struct {
+	Error  *ErrorResponse  `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+func (c *Client) request(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	var err error
+	for _, endpoint := range c.pool.Ordered() {
+		err = c.requestEndpoint(ctx, endpoint, method, params, result)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// requestEndpoint sends a request to one endpoint, failures other than rpc errors count against its health
+func (c *Client) requestEndpoint(ctx context.Context, endpoint, method string, params []interface{}, result interface{}) error {
+	start := time.Now()
+	err := c.doRequest(ctx, endpoint, method, params, result)
+	var rpcErr *ErrorResponse
+	if errors.As(err, &rpcErr) {
+		c.pool.observe(endpoint, time.Since(start), nil)
+	} else {
+		c.pool.observe(endpoint, time.Since(start), err)
+	}
+	return err
+}
+
+func (c *Client) doRequest(ctx context.Context, endpoint, method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// the url may carry an api key
+			return fmt.Errorf("%s %s: %w", urlErr.Op, EndpointLabel(endpoint), urlErr.Err)
+		}
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("status code: %d, use rpc: %s", res.StatusCode, EndpointLabel(endpoint))
+	}
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	generalRes := generalResponse{}
+	if err := json.Unmarshal(resBody, &generalRes); err != nil {
+		return err
+	}
+	if generalRes.Error != nil {
+		return generalRes.Error
+	}
+	return json.Unmarshal(generalRes.Result, result)
+}
@@ -0,0 +1,200 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxSlotLag   = 50
+	DefaultMaxErrorRate = 0.5
+
+	errorWindow     = 20  // recent requests the error rate is taken over
+	minErrorSamples = 5   // requests needed before the error rate counts
+	latencyWeight   = 0.3 // of the latest request in the moving average
+
+	healthCheckTimeout = 10 * time.Second
+)
+
+// EndpointStatus is the health of an endpoint as last observed
+type EndpointStatus struct {
+	Endpoint  string        `json:"endpoint"`
+	Healthy   bool          `json:"healthy"`
+	Reason    string        `json:"reason,omitempty"` // why it is unhealthy
+	Slot      uint64        `json:"slot"`
+	SlotLag   uint64        `json:"slotLag"` // behind the highest slot of all endpoints
+	Latency   time.Duration `json:"latency"` // moving average
+	ErrorRate float64       `json:"errorRate"`
+}
+
+type endpointHealth struct {
+	slot     uint64
+	checkErr error
+	latency  time.Duration
+	results  []bool // failed or not, of the recent requests
+}
+
+func (h *endpointHealth) errorRate() float64 {
+	if len(h.results) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, result := range h.results {
+		if result {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(h.results))
+}
+
+// EndpointPool tracks the health of rpc endpoints from health checks and the requests sent through them:
+// slot lag behind the other endpoints, latency and error rate. Requests go to the healthiest endpoint first.
+type EndpointPool struct {
+	mu        sync.Mutex
+	endpoints []string
+	health    map[string]*endpointHealth
+
+	MaxSlotLag   uint64
+	MaxErrorRate float64
+}
+
+func NewEndpointPool(endpoints []string) *EndpointPool {
+	health := make(map[string]*endpointHealth, len(endpoints))
+	for _, endpoint := range endpoints {
+		health[endpoint] = &endpointHealth{}
+	}
+	return &EndpointPool{
+		endpoints:    endpoints,
+		health:       health,
+		MaxSlotLag:   DefaultMaxSlotLag,
+		MaxErrorRate: DefaultMaxErrorRate,
+	}
+}
+
+// observe records the outcome of a request to endpoint
+func (p *EndpointPool) observe(endpoint string, latency time.Duration, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, exist := p.health[endpoint]
+	if !exist {
+		return
+	}
+	h.results = append(h.results, err != nil)
+	if len(h.results) > errorWindow {
+		h.results = h.results[len(h.results)-errorWindow:]
+	}
+	if err == nil {
+		if h.latency == 0 {
+			h.latency = latency
+		} else {
+			h.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(h.latency))
+		}
+	}
+}
+
+// setSlot records the slot an endpoint reported in a health check, or the error of the check
+func (p *EndpointPool) setSlot(endpoint string, slot uint64, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, exist := p.health[endpoint]
+	if !exist {
+		return
+	}
+	h.checkErr = err
+	if err == nil {
+		h.slot = slot
+	}
+}
+
+// Statuses returns the status of every endpoint, in the configured order
+func (p *EndpointPool) Statuses() []EndpointStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	maxSlot := uint64(0)
+	for _, h := range p.health {
+		if h.checkErr == nil && h.slot > maxSlot {
+			maxSlot = h.slot
+		}
+	}
+	statuses := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, endpoint := range p.endpoints {
+		h := p.health[endpoint]
+		status := EndpointStatus{
+			Endpoint:  endpoint,
+			Healthy:   true,
+			Slot:      h.slot,
+			Latency:   h.latency,
+			ErrorRate: h.errorRate(),
+		}
+		if h.slot > 0 {
+			status.SlotLag = maxSlot - h.slot
+		}
+		switch {
+		case h.checkErr != nil:
+			status.Healthy, status.Reason = false, fmt.Sprintf("health check failed: %s", h.checkErr)
+		case status.SlotLag > p.MaxSlotLag:
+			status.Healthy, status.Reason = false, fmt.Sprintf("slot %d lags %d behind", h.slot, status.SlotLag)
+		case len(h.results) >= minErrorSamples && status.ErrorRate > p.MaxErrorRate:
+			status.Healthy, status.Reason = false, fmt.Sprintf("%.0f%% of recent requests failed", status.ErrorRate*100)
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Ordered returns the endpoints to try in order: healthy ones by latency, then unhealthy ones by slot lag.
+// Healthy endpoints without a latency measured yet come after the measured ones, in the configured order.
+func (p *EndpointPool) Ordered() []string {
+	statuses := p.Statuses()
+	sort.SliceStable(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		if a.Healthy != b.Healthy {
+			return a.Healthy
+		}
+		if !a.Healthy {
+			return a.SlotLag < b.SlotLag
+		}
+		if measuredA, measuredB := a.Latency > 0, b.Latency > 0; measuredA != measuredB {
+			return measuredA
+		}
+		return a.Latency < b.Latency
+	})
+	endpoints := make([]string, 0, len(statuses))
+	for _, status := range statuses {
+		endpoints = append(endpoints, status.Endpoint)
+	}
+	return endpoints
+}
+
+// EndpointLabel is the scheme and host of an endpoint, safe to log and label metrics with
+// as paths and queries often carry api keys.
+func EndpointLabel(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || len(u.Host) == 0 {
+		return "invalid endpoint"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// CheckEndpoints asks every endpoint for its slot at once and returns the statuses after
+func (c *Client) CheckEndpoints(ctx context.Context) []EndpointStatus {
+	var wg sync.WaitGroup
+	for _, endpoint := range c.endpointList {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+			slot := uint64(0)
+			err := c.requestEndpoint(checkCtx, endpoint, "getSlot", []interface{}{map[string]string{"commitment": "confirmed"}}, &slot)
+			c.pool.setSlot(endpoint, slot, err)
+		}(endpoint)
+	}
+	wg.Wait()
+	return c.pool.Statuses()
+}
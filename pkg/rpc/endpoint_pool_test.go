@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// standIn is an rpc endpoint answering getSlot, getRecentPrioritizationFees and sendTransaction
+type standIn struct {
+	*httptest.Server
+	slot     atomic.Uint64
+	down     atomic.Bool // answer 503
+	delay    time.Duration
+	requests atomic.Int64
+	sent     atomic.Int64
+}
+
+func newStandIn(t *testing.T, slot uint64, delay time.Duration) *standIn {
+	s := &standIn{delay: delay}
+	s.slot.Store(slot)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		time.Sleep(s.delay)
+		if s.down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		req := struct {
+			Method string `json:"method"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&req)
+
+		var result interface{}
+		switch req.Method {
+		case "getSlot":
+			result = s.slot.Load()
+		case "getRecentPrioritizationFees":
+			result = []interface{}{}
+		case "sendTransaction":
+			s.sent.Add(1)
+			result = "signature"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": 0, "result": result})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestEndpointFailover(t *testing.T) {
+	lagging := newStandIn(t, 1000, 0)
+	slow := newStandIn(t, 2000, 20*time.Millisecond)
+	fast := newStandIn(t, 2000, 0)
+	c := NewClient([]string{lagging.URL, slow.URL, fast.URL})
+
+	statuses := c.CheckEndpoints(context.Background())
+	if statuses[0].Healthy || statuses[0].SlotLag != 1000 || !statuses[1].Healthy || !statuses[2].Healthy {
+		t.Fatalf("statuses: %+v", statuses)
+	}
+	if ordered := c.Pool().Ordered(); ordered[0] != fast.URL || ordered[1] != slow.URL || ordered[2] != lagging.URL {
+		t.Fatalf("ordered: %v", ordered)
+	}
+
+	// reads go to the healthiest endpoint
+	requests := fast.requests.Load()
+	if _, err := c.GetRecentPrioritizationFees(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if fast.requests.Load() != requests+1 {
+		t.Fatal("read not routed to the fastest endpoint")
+	}
+
+	// failed requests fall back to the next endpoint and turn the failing one unhealthy
+	fast.down.Store(true)
+	for i := 0; i < minErrorSamples; i++ {
+		if _, err := c.GetRecentPrioritizationFees(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statuses = c.Pool().Statuses()
+	if statuses[2].Healthy || statuses[2].ErrorRate <= DefaultMaxErrorRate {
+		t.Fatalf("failing endpoint: %+v", statuses[2])
+	}
+	if ordered := c.Pool().Ordered(); ordered[0] != slow.URL {
+		t.Fatalf("ordered after failures: %v", ordered)
+	}
+
+	// the lagging endpoint catches up
+	lagging.slot.Store(2000)
+	statuses = c.CheckEndpoints(context.Background())
+	if !statuses[0].Healthy {
+		t.Fatalf("caught up endpoint: %+v", statuses[0])
+	}
+}
+
+func TestSendRawTransactionBroadcast(t *testing.T) {
+	a, b, down := newStandIn(t, 100, 0), newStandIn(t, 100, 0), newStandIn(t, 100, 0)
+	down.down.Store(true)
+	c := NewClient([]string{down.URL, a.URL, b.URL})
+
+	signature, err := c.SendRawTransaction(context.Background(), []byte{1})
+	if err != nil || signature != "signature" {
+		t.Fatalf("signature: %s, err: %v", signature, err)
+	}
+	// the other sends finish in the background
+	deadline := time.Now().Add(time.Second)
+	for a.sent.Load()+b.sent.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if a.sent.Load() != 1 || b.sent.Load() != 1 || down.requests.Load() != 1 {
+		t.Fatalf("sent to a: %d, b: %d, down: %d", a.sent.Load(), b.sent.Load(), down.requests.Load())
+	}
+
+	// broadcast to the healthiest only
+	c.CheckEndpoints(context.Background())
+	c.Broadcast = 1
+	if _, err := c.SendRawTransaction(context.Background(), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if down.requests.Load() != 2 || a.sent.Load()+b.sent.Load() != 3 {
+		t.Fatalf("sent to a: %d, b: %d, down requests: %d", a.sent.Load(), b.sent.Load(), down.requests.Load())
+	}
+
+	b.down.Store(true)
+	a.down.Store(true)
+	c.Broadcast = 0
+	if _, err := c.SendRawTransaction(context.Background(), []byte{1}); err == nil {
+		t.Fatal("send to all failing endpoints succeeded")
+	}
+}
+
+func TestOrderedMeasuredFirst(t *testing.T) {
+	p := NewEndpointPool([]string{"http://a", "http://b", "http://proven", "http://slow"})
+	p.observe("http://slow", 200*time.Millisecond, nil)
+	p.observe("http://proven", 10*time.Millisecond, nil)
+
+	ordered := p.Ordered()
+	if ordered[0] != "http://proven" || ordered[1] != "http://slow" || ordered[2] != "http://a" || ordered[3] != "http://b" {
+		t.Fatalf("ordered: %v", ordered)
+	}
+}
@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/lookuptable"
+)
+
+var ErrLookupTableNotFound = errors.New("lookup table not found")
+
+// GetAddressLookupTable reads an address lookup table at confirmed commitment, so addresses just appended are seen
+func (c *Client) GetAddressLookupTable(ctx context.Context, account string) (lookuptable.LookupTable, error) {
+	res := struct {
+		Value *struct {
+			Owner string   `json:"owner"`
+			Data  []string `json:"data"`
+		} `json:"value"`
+	}{}
+	err := c.request(ctx, "getAccountInfo", []interface{}{
+		account,
+		map[string]interface{}{
+			"encoding":   "base64",
+			"commitment": "confirmed",
+		},
+	}, &res)
+	if err != nil {
+		return lookuptable.LookupTable{}, err
+	}
+	if res.Value == nil {
+		return lookuptable.LookupTable{}, ErrLookupTableNotFound
+	}
+	if res.Value.Owner != lookuptable.ProgramID.ToBase58() || len(res.Value.Data) != 2 {
+		return lookuptable.LookupTable{}, fmt.Errorf("account %s is not a lookup table", account)
+	}
+	data, err := base64.StdEncoding.DecodeString(res.Value.Data[0])
+	if err != nil {
+		return lookuptable.LookupTable{}, fmt.Errorf("decode lookup table %s failed: %w", account, err)
+	}
+	table, err := lookuptable.Deserialize(data)
+	if err != nil {
+		return lookuptable.LookupTable{}, fmt.Errorf("account %s is not a lookup table: %w", account, err)
+	}
+	return table, nil
+}
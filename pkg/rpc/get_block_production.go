@@ -0,0 +1,27 @@
+package rpc
+
+import (
+	"context"
+)
+
+type BlockProductionRange struct {
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+}
+
+type BlockProduction struct {
+	ByIdentity map[string][2]uint64 `json:"byIdentity"` // identity -> [leader slots, blocks produced]
+	Range      BlockProductionRange `json:"range"`
+}
+
+// GetBlockProduction returns the leader slots and blocks produced per validator identity in the current epoch
+func (c *Client) GetBlockProduction(ctx context.Context) (BlockProduction, error) {
+	res := struct {
+		Value BlockProduction `json:"value"`
+	}{}
+	err := c.request(ctx, "getBlockProduction", []interface{}{}, &res)
+	if err != nil {
+		return BlockProduction{}, err
+	}
+	return res.Value, nil
+}
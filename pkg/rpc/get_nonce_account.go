@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/sysprog"
+)
+
+const nonceStateInitialized = 1
+
+var ErrNonceAccountNotFound = errors.New("nonce account not found")
+
+// GetNonceAccount reads a durable nonce account at confirmed commitment. The sdk client reads at the node's
+// default commitment, finalized on most nodes, which lags the nonce a tx just advanced.
+func (c *Client) GetNonceAccount(ctx context.Context, account string) (sysprog.NonceAccount, error) {
+	res := struct {
+		Value *struct {
+			Owner string   `json:"owner"`
+			Data  []string `json:"data"`
+		} `json:"value"`
+	}{}
+	err := c.request(ctx, "getAccountInfo", []interface{}{
+		account,
+		map[string]interface{}{
+			"encoding":   "base64",
+			"commitment": "confirmed",
+		},
+	}, &res)
+	if err != nil {
+		return sysprog.NonceAccount{}, err
+	}
+	if res.Value == nil {
+		return sysprog.NonceAccount{}, ErrNonceAccountNotFound
+	}
+	if res.Value.Owner != common.SystemProgramID.ToBase58() || len(res.Value.Data) != 2 {
+		return sysprog.NonceAccount{}, fmt.Errorf("account %s is not a nonce account", account)
+	}
+	data, err := base64.StdEncoding.DecodeString(res.Value.Data[0])
+	if err != nil {
+		return sysprog.NonceAccount{}, fmt.Errorf("decode nonce account %s failed: %w", account, err)
+	}
+	nonceAccount, err := sysprog.NonceAccountDeserialize(data)
+	if err != nil {
+		return sysprog.NonceAccount{}, fmt.Errorf("account %s is not a nonce account: %w", account, err)
+	}
+	if nonceAccount.State != nonceStateInitialized {
+		return sysprog.NonceAccount{}, fmt.Errorf("nonce account %s not initialized", account)
+	}
+	return nonceAccount, nil
+}
@@ -0,0 +1,20 @@
+package rpc
+
+import (
+	"context"
+)
+
+type PrioritizationFee struct {
+	Slot              uint64 `json:"slot"`
+	PrioritizationFee uint64 `json:"prioritizationFee"` // micro lamports per compute unit
+}
+
+// GetRecentPrioritizationFees returns fees paid by recent txs that locked all of the given writable accounts
+func (c *Client) GetRecentPrioritizationFees(ctx context.Context, accounts []string) ([]PrioritizationFee, error) {
+	res := make([]PrioritizationFee, 0)
+	err := c.request(ctx, "getRecentPrioritizationFees", []interface{}{accounts}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+)
+
+type VoteAccount struct {
+	VotePubkey       string     `json:"votePubkey"`
+	NodePubkey       string     `json:"nodePubkey"`
+	ActivatedStake   uint64     `json:"activatedStake"`
+	EpochVoteAccount bool       `json:"epochVoteAccount"`
+	Commission       uint8      `json:"commission"`
+	LastVote         uint64     `json:"lastVote"`
+	RootSlot         uint64     `json:"rootSlot"`
+	EpochCredits     [][]uint64 `json:"epochCredits"` // [epoch, credits, previousCredits]
+}
+
+// LastEpochCredits returns credits earned in the latest epoch that has completed,
+// or in the current epoch if no completed epoch is recorded.
+func (v *VoteAccount) LastEpochCredits() uint64 {
+	if len(v.EpochCredits) == 0 {
+		return 0
+	}
+	entry := v.EpochCredits[len(v.EpochCredits)-1]
+	if len(v.EpochCredits) >= 2 {
+		entry = v.EpochCredits[len(v.EpochCredits)-2]
+	}
+	if len(entry) < 3 || entry[1] < entry[2] {
+		return 0
+	}
+	return entry[1] - entry[2]
+}
+
+// RecentEpochCredits returns the average credits earned in up to n of the latest epochs that have completed,
+// or in the current epoch if no completed epoch is recorded.
+func (v *VoteAccount) RecentEpochCredits(n int) uint64 {
+	entries := v.EpochCredits
+	if len(entries) >= 2 {
+		entries = entries[:len(entries)-1]
+	}
+	if len(entries) > n {
+		entries = entries[len(entries)-n:]
+	}
+	if len(entries) == 0 {
+		return 0
+	}
+	total := uint64(0)
+	for _, entry := range entries {
+		if len(entry) < 3 || entry[1] < entry[2] {
+			continue
+		}
+		total += entry[1] - entry[2]
+	}
+	return total / uint64(len(entries))
+}
+
+type GetVoteAccountsResponse struct {
+	Current    []VoteAccount `json:"current"`
+	Delinquent []VoteAccount `json:"delinquent"`
+}
+
+func (c *Client) GetVoteAccounts(ctx context.Context) (GetVoteAccountsResponse, error) {
+	res := GetVoteAccountsResponse{}
+	err := c.request(ctx, "getVoteAccounts", []interface{}{}, &res)
+	if err != nil {
+		return GetVoteAccountsResponse{}, err
+	}
+	return res, nil
+}
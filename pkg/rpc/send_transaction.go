@@ -0,0 +1,55 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+)
+
+// SendRawTransaction sends a signed raw tx to Broadcast endpoints at once, healthiest first, skipping preflight
+// like the sdk's. It returns the signature once any endpoint accepts the tx, or the errors if none does.
+func (c *Client) SendRawTransaction(ctx context.Context, rawTx []byte) (string, error) {
+	endpoints := c.pool.Ordered()
+	if c.Broadcast > 0 && c.Broadcast < len(endpoints) {
+		endpoints = endpoints[:c.Broadcast]
+	}
+	params := []interface{}{
+		base64.StdEncoding.EncodeToString(rawTx),
+		map[string]interface{}{
+			"encoding":            "base64",
+			"skipPreflight":       true,
+			"preflightCommitment": "finalized",
+		},
+	}
+
+	type sendResult struct {
+		endpoint  string
+		signature string
+		err       error
+	}
+	results := make(chan sendResult, len(endpoints))
+	var wg sync.WaitGroup
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			signature := ""
+			err := c.requestEndpoint(ctx, endpoint, "sendTransaction", params, &signature)
+			results <- sendResult{endpoint: endpoint, signature: signature, err: err}
+		}(endpoint)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	errs := make([]string, 0)
+	for result := range results {
+		if result.err == nil {
+			return result.signature, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %s", EndpointLabel(result.endpoint), result.err))
+	}
+	return "", fmt.Errorf("send tx to %d endpoints failed: %v", len(endpoints), errs)
+}
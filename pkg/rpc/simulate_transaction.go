@@ -0,0 +1,32 @@
+package rpc
+
+import (
+	"context"
+	"encoding/base64"
+)
+
+type SimulateTransactionResult struct {
+	Err           interface{} `json:"err"`
+	Logs          []string    `json:"logs"`
+	UnitsConsumed uint64      `json:"unitsConsumed"`
+}
+
+// SimulateTransaction simulates a signed raw tx without verifying signatures.
+// Unlike the sdk's it reports the compute units consumed.
+func (c *Client) SimulateTransaction(ctx context.Context, rawTx []byte) (*SimulateTransactionResult, error) {
+	res := struct {
+		Value SimulateTransactionResult `json:"value"`
+	}{}
+	err := c.request(ctx, "simulateTransaction", []interface{}{
+		base64.StdEncoding.EncodeToString(rawTx),
+		map[string]interface{}{
+			"encoding":   "base64",
+			"sigVerify":  false,
+			"commitment": "confirmed",
+		},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res.Value, nil
+}
@@ -0,0 +1,273 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrWsClosed = errors.New("websocket closed")
+
+// WsClient is a solana pubsub client over one websocket connection.
+// Done is closed once the connection breaks, subscriptions must then be made again on a new client.
+type WsClient struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan wsResponse
+	subs    map[uint64]chan json.RawMessage
+	subChs  map[uint64]chan json.RawMessage // request id -> channel of a subscribe call, registered as its answer is read
+	err     error
+
+	done chan struct{}
+}
+
+type wsResponse struct {
+	Result json.RawMessage
+	Err    error
+}
+
+type wsMessage struct {
+	ID     *uint64         `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *ErrorResponse  `json:"error"`
+	Method string          `json:"method"`
+	Params struct {
+		Subscription uint64          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// Subscription receives notifications of one subscription, C is closed when the connection breaks.
+type Subscription struct {
+	C <-chan json.RawMessage
+
+	id                uint64
+	unsubscribeMethod string
+	client            *WsClient
+}
+
+// Close stops the notifications without telling the node, for subscriptions the node dropped itself
+func (s *Subscription) Close() {
+	s.client.mu.Lock()
+	delete(s.client.subs, s.id)
+	s.client.mu.Unlock()
+}
+
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	s.client.mu.Lock()
+	delete(s.client.subs, s.id)
+	s.client.mu.Unlock()
+
+	var ok bool
+	return s.client.call(ctx, s.unsubscribeMethod, []interface{}{s.id}, &ok)
+}
+
+// WsEndpoint derives the websocket endpoint of a http rpc endpoint
+func WsEndpoint(httpEndpoint string) string {
+	if strings.HasPrefix(httpEndpoint, "https://") {
+		return "wss://" + strings.TrimPrefix(httpEndpoint, "https://")
+	}
+	if strings.HasPrefix(httpEndpoint, "http://") {
+		return "ws://" + strings.TrimPrefix(httpEndpoint, "http://")
+	}
+	return httpEndpoint
+}
+
+func DialWs(ctx context.Context, endpoint string) (*WsClient, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &WsClient{
+		conn:    conn,
+		pending: make(map[uint64]chan wsResponse),
+		subs:    make(map[uint64]chan json.RawMessage),
+		subChs:  make(map[uint64]chan json.RawMessage),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *WsClient) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection broke
+func (c *WsClient) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *WsClient) Close() error {
+	return c.conn.Close()
+}
+
+func (c *WsClient) readLoop() {
+	var err error
+	for {
+		var msg wsMessage
+		err = c.conn.ReadJSON(&msg)
+		if err != nil {
+			break
+		}
+
+		c.mu.Lock()
+		if msg.ID != nil {
+			// a notification may follow the answer at once, the subscription is known before the next read
+			if ch, exist := c.subChs[*msg.ID]; exist {
+				delete(c.subChs, *msg.ID)
+				var id uint64
+				if msg.Error == nil && json.Unmarshal(msg.Result, &id) == nil {
+					c.subs[id] = ch
+				}
+			}
+			if ch, exist := c.pending[*msg.ID]; exist {
+				delete(c.pending, *msg.ID)
+				res := wsResponse{Result: msg.Result}
+				if msg.Error != nil {
+					res.Err = msg.Error
+				}
+				ch <- res
+			}
+		} else if msg.Method != "" {
+			if ch, exist := c.subs[msg.Params.Subscription]; exist {
+				// drop the notification if the receiver is behind, receivers only need to know something changed
+				select {
+				case ch <- msg.Params.Result:
+				default:
+				}
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	c.mu.Lock()
+	c.err = err
+	for id, ch := range c.pending {
+		ch <- wsResponse{Err: ErrWsClosed}
+		delete(c.pending, id)
+	}
+	for id, ch := range c.subs {
+		close(ch)
+		delete(c.subs, id)
+	}
+	c.subChs = make(map[uint64]chan json.RawMessage)
+	c.mu.Unlock()
+	close(c.done)
+	c.conn.Close()
+}
+
+func (c *WsClient) call(ctx context.Context, method string, params []interface{}, result interface{}) error {
+	return c.request(ctx, method, params, result, nil)
+}
+
+// request sends a call and waits for its answer, subCh is registered for the notifications if it is a subscribe call
+func (c *WsClient) request(ctx context.Context, method string, params []interface{}, result interface{}, subCh chan json.RawMessage) error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return ErrWsClosed
+	default:
+	}
+	c.nextID++
+	id := c.nextID
+	resCh := make(chan wsResponse, 1)
+	c.pending[id] = resCh
+	if subCh != nil {
+		c.subChs[id] = subCh
+	}
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	err := c.conn.WriteJSON(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"method":  method,
+		"params":  params,
+	})
+	c.writeMu.Unlock()
+	if err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		delete(c.subChs, id)
+		c.mu.Unlock()
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, id)
+		delete(c.subChs, id)
+		c.mu.Unlock()
+		return ctx.Err()
+	case res := <-resCh:
+		if res.Err != nil {
+			return res.Err
+		}
+		return json.Unmarshal(res.Result, result)
+	}
+}
+
+func (c *WsClient) subscribe(ctx context.Context, method, unsubscribeMethod string, params []interface{}) (*Subscription, error) {
+	var id uint64
+	ch := make(chan json.RawMessage, 16)
+	if err := c.request(ctx, method, params, &id, ch); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method, err)
+	}
+
+	return &Subscription{
+		C:                 ch,
+		id:                id,
+		unsubscribeMethod: unsubscribeMethod,
+		client:            c,
+	}, nil
+}
+
+// AccountSubscribe notifies on every change of the account. Data is requested zstd compressed,
+// as stake manager accounts are large and mostly zero.
+func (c *WsClient) AccountSubscribe(ctx context.Context, account string, commitment string) (*Subscription, error) {
+	return c.subscribe(ctx, "accountSubscribe", "accountUnsubscribe", []interface{}{
+		account,
+		map[string]interface{}{"encoding": "base64+zstd", "commitment": commitment},
+	})
+}
+
+type SlotNotification struct {
+	Parent uint64 `json:"parent"`
+	Root   uint64 `json:"root"`
+	Slot   uint64 `json:"slot"`
+}
+
+func (c *WsClient) SlotSubscribe(ctx context.Context) (*Subscription, error) {
+	return c.subscribe(ctx, "slotSubscribe", "slotUnsubscribe", []interface{}{})
+}
+
+// SignatureNotification is sent once the tx reaches the commitment subscribed to, the node then drops the subscription
+type SignatureNotification struct {
+	Context struct {
+		Slot uint64 `json:"slot"`
+	} `json:"context"`
+	Value struct {
+		Err interface{} `json:"err"`
+	} `json:"value"`
+}
+
+func (c *WsClient) SignatureSubscribe(ctx context.Context, signature string, commitment string) (*Subscription, error) {
+	return c.subscribe(ctx, "signatureSubscribe", "signatureUnsubscribe", []interface{}{
+		signature,
+		map[string]interface{}{"commitment": commitment},
+	})
+}
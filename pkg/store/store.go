@@ -0,0 +1,218 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	TxStatusPending   = "pending"
+	TxStatusLanded    = "landed"
+	TxStatusFailed    = "failed"
+	TxStatusNotLanded = "not_landed"
+
+	maxTxRecords = 100
+)
+
+type TxRecord struct {
+	Signature            string    `json:"signature"`
+	Handler              string    `json:"handler"`
+	Era                  uint64    `json:"era"`
+	LastValidBlockHeight uint64    `json:"lastValidBlockHeight"`
+	NonceAccount         string    `json:"nonceAccount,omitempty"` // durable nonce txs only, valid while the nonce is unchanged
+	Nonce                string    `json:"nonce,omitempty"`
+	StakeAccount         string    `json:"stakeAccount,omitempty"` // created by the tx
+	Status               string    `json:"status"`
+	SentAt               time.Time `json:"sentAt"`
+}
+
+// StakeAccountRecord keeps a generated stake account keypair until the tx creating it lands,
+// so a tx lost in a restart is sent again with the same account.
+type StakeAccountRecord struct {
+	Handler    string    `json:"handler"`
+	Era        uint64    `json:"era"`
+	PublicKey  string    `json:"publicKey"`
+	PrivateKey string    `json:"privateKey"` // base58
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type StakeManagerState struct {
+	LatestEra     uint64               `json:"latestEra"`   // era of the latest tx sent
+	LastHandler   string               `json:"lastHandler"` // handler the latest handling stopped at, failed or the last one
+	Retry         int                  `json:"retry"`       // consecutive failed handling
+	Txs           []TxRecord           `json:"txs"`
+	StakeAccounts []StakeAccountRecord `json:"stakeAccounts"`
+	Rebalance     RebalanceProgress    `json:"rebalance"`             // stake moved in the latest era rebalanced
+	LookupTable   string               `json:"lookupTable,omitempty"` // address lookup table kept for the stake manager
+	UpdatedAt     time.Time            `json:"updatedAt"`
+}
+
+type RebalanceProgress struct {
+	Era    uint64 `json:"era"`
+	Amount uint64 `json:"amount"`
+	Moves  uint64 `json:"moves"`
+}
+
+// PendingTxs returns the txs sent but not known to land or expire
+func (s *StakeManagerState) PendingTxs() []TxRecord {
+	pending := make([]TxRecord, 0)
+	for _, tx := range s.Txs {
+		if tx.Status == TxStatusPending {
+			pending = append(pending, tx)
+		}
+	}
+	return pending
+}
+
+// SetTxStatus updates a tx, the stake account it created is forgotten once it lands.
+func (s *StakeManagerState) SetTxStatus(signature, status string) {
+	for i := range s.Txs {
+		if s.Txs[i].Signature != signature {
+			continue
+		}
+		s.Txs[i].Status = status
+		if status == TxStatusLanded && len(s.Txs[i].StakeAccount) > 0 {
+			s.RemoveStakeAccount(s.Txs[i].StakeAccount)
+		}
+	}
+}
+
+// AddTx records a sent tx. Over maxTxRecords the oldest settled records are dropped, pending ones are kept
+// whatever their number until reconciled.
+func (s *StakeManagerState) AddTx(tx TxRecord) {
+	s.Txs = append(s.Txs, tx)
+	excess := len(s.Txs) - maxTxRecords
+	if excess <= 0 {
+		return
+	}
+	kept := make([]TxRecord, 0, len(s.Txs))
+	for _, record := range s.Txs {
+		if excess > 0 && record.Status != TxStatusPending {
+			excess--
+			continue
+		}
+		kept = append(kept, record)
+	}
+	s.Txs = kept
+}
+
+func (s *StakeManagerState) RemoveStakeAccount(publicKey string) {
+	for i, account := range s.StakeAccounts {
+		if account.PublicKey == publicKey {
+			s.StakeAccounts = append(s.StakeAccounts[:i], s.StakeAccounts[i+1:]...)
+			return
+		}
+	}
+}
+
+// Store keeps one json file per stake manager in dir. Files hold stake account private keys,
+// so they are only readable by the owner.
+type Store struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string]*StakeManagerState
+}
+
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create state dir failed: %w", err)
+	}
+	return &Store{
+		dir:   dir,
+		cache: make(map[string]*StakeManagerState),
+	}, nil
+}
+
+// Load returns a copy of the state of a stake manager, empty if never saved
+func (s *Store) Load(stakeManager string) (StakeManagerState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.load(stakeManager)
+	if err != nil {
+		return StakeManagerState{}, err
+	}
+	return state.copy(), nil
+}
+
+// Update modifies the state of a stake manager and saves it, the state is left as is if fn fails.
+func (s *Store) Update(stakeManager string, fn func(state *StakeManagerState) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, err := s.load(stakeManager)
+	if err != nil {
+		return err
+	}
+	newState := state.copy()
+	if err := fn(&newState); err != nil {
+		return err
+	}
+	newState.UpdatedAt = time.Now()
+	if err := s.save(stakeManager, &newState); err != nil {
+		return err
+	}
+	s.cache[stakeManager] = &newState
+	return nil
+}
+
+func (s *Store) path(stakeManager string) string {
+	return filepath.Join(s.dir, stakeManager+".json")
+}
+
+func (s *Store) load(stakeManager string) (*StakeManagerState, error) {
+	if state, exist := s.cache[stakeManager]; exist {
+		return state, nil
+	}
+
+	state := &StakeManagerState{}
+	bts, err := os.ReadFile(s.path(stakeManager))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	} else if err := json.Unmarshal(bts, state); err != nil {
+		return nil, fmt.Errorf("decode state of %s failed: %w", stakeManager, err)
+	}
+	s.cache[stakeManager] = state
+	return state, nil
+}
+
+// save writes to a temp file then renames it, so a crash never leaves a partial file
+func (s *Store) save(stakeManager string, state *StakeManagerState) error {
+	bts, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(s.dir, stakeManager+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bts); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(stakeManager))
+}
+
+func (s *StakeManagerState) copy() StakeManagerState {
+	c := *s
+	c.Txs = append([]TxRecord(nil), s.Txs...)
+	c.StakeAccounts = append([]StakeAccountRecord(nil), s.StakeAccounts...)
+	return c
+}
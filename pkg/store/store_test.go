@@ -0,0 +1,34 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAddTxKeepsPending(t *testing.T) {
+	state := StakeManagerState{}
+	state.AddTx(TxRecord{Signature: "pending", Status: TxStatusPending})
+	for i := 0; i < maxTxRecords+20; i++ {
+		state.AddTx(TxRecord{Signature: fmt.Sprintf("landed%d", i), Status: TxStatusLanded})
+	}
+
+	if len(state.Txs) != maxTxRecords {
+		t.Fatalf("records: %d, want: %d", len(state.Txs), maxTxRecords)
+	}
+	pending := state.PendingTxs()
+	if len(pending) != 1 || pending[0].Signature != "pending" || state.Txs[0].Signature != "pending" {
+		t.Fatalf("pending: %v, first record: %s", pending, state.Txs[0].Signature)
+	}
+	// the oldest settled records go first
+	if state.Txs[1].Signature != "landed21" || state.Txs[len(state.Txs)-1].Signature != fmt.Sprintf("landed%d", maxTxRecords+19) {
+		t.Fatalf("records kept from %s to %s", state.Txs[1].Signature, state.Txs[len(state.Txs)-1].Signature)
+	}
+
+	// pending records are never dropped, even over the limit
+	for i := 0; i < maxTxRecords+1; i++ {
+		state.AddTx(TxRecord{Signature: fmt.Sprintf("pending%d", i), Status: TxStatusPending})
+	}
+	if len(state.PendingTxs()) != maxTxRecords+2 || len(state.Txs) != maxTxRecords+2 {
+		t.Fatalf("pending: %d, records: %d", len(state.PendingTxs()), len(state.Txs))
+	}
+}
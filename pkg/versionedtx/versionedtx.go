@@ -0,0 +1,447 @@
+// Package versionedtx builds and decodes v0 transactions, whose messages may load accounts from address lookup tables.
+// The sdk only knows legacy messages, the layout follows it with the version prefix and the table lookups added.
+package versionedtx
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mr-tron/base58"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+const (
+	versionPrefix = 0x80 // set on the first message byte of a versioned message, the low bits are the version
+	maxAccounts   = 256  // instructions index accounts with one byte
+)
+
+// LookupTableAccount is a lookup table with the addresses it held when read
+type LookupTableAccount struct {
+	Key       common.PublicKey
+	Addresses []common.PublicKey
+}
+
+// MessageLookup loads accounts from one table by index
+type MessageLookup struct {
+	Table           common.PublicKey
+	WritableIndexes []uint8
+	ReadonlyIndexes []uint8
+}
+
+// Message is a v0 message. Instructions index StaticAccounts first, then the writable accounts of all lookups
+// in order, then their readonly accounts.
+type Message struct {
+	Header          types.MessageHeader
+	StaticAccounts  []common.PublicKey
+	RecentBlockHash string
+	Instructions    []types.CompiledInstruction
+	Lookups         []MessageLookup
+}
+
+type Transaction struct {
+	Signatures []types.Signature
+	Message    Message
+}
+
+type CreateRawTransactionParam struct {
+	Instructions    []types.Instruction
+	Signers         []types.Account
+	FeePayer        common.PublicKey
+	RecentBlockHash string
+	LookupTables    []LookupTableAccount
+}
+
+// CreateRawTransaction compiles, signs and serializes a v0 tx. Accounts other than signers and programs are loaded
+// from the first table holding them, the rest stay static.
+func CreateRawTransaction(param CreateRawTransactionParam) ([]byte, error) {
+	if param.RecentBlockHash == "" {
+		return nil, errors.New("recent block hash is required")
+	}
+	if len(param.Instructions) < 1 {
+		return nil, errors.New("no instructions provided")
+	}
+
+	message, err := NewMessage(param.FeePayer, param.Instructions, param.RecentBlockHash, param.LookupTables)
+	if err != nil {
+		return nil, err
+	}
+	messageData, err := message.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	privateKeys := map[common.PublicKey]ed25519.PrivateKey{}
+	for _, signer := range param.Signers {
+		privateKeys[signer.PublicKey] = signer.PrivateKey
+	}
+	if int(message.Header.NumRequireSignatures) != len(privateKeys) {
+		return nil, fmt.Errorf("signer's num not match,require %d real is %d",
+			message.Header.NumRequireSignatures, len(privateKeys))
+	}
+	tx := Transaction{Message: message}
+	for _, account := range message.StaticAccounts[:message.Header.NumRequireSignatures] {
+		privateKey, exist := privateKeys[account]
+		if !exist {
+			return nil, fmt.Errorf("lack %s's private key", account.ToBase58())
+		}
+		tx.Signatures = append(tx.Signatures, ed25519.Sign(privateKey, messageData))
+	}
+	return tx.Serialize()
+}
+
+func NewMessage(feePayer common.PublicKey, instructions []types.Instruction, recentBlockHash string, lookupTables []LookupTableAccount) (Message, error) {
+	accountMap := map[common.PublicKey]*types.AccountMeta{}
+	programs := map[common.PublicKey]bool{}
+	for _, instruction := range instructions {
+		programs[instruction.ProgramID] = true
+		if _, exist := accountMap[instruction.ProgramID]; !exist {
+			accountMap[instruction.ProgramID] = &types.AccountMeta{PubKey: instruction.ProgramID}
+		}
+		for _, account := range instruction.Accounts {
+			a, exist := accountMap[account.PubKey]
+			if !exist {
+				account := account
+				accountMap[account.PubKey] = &account
+			} else {
+				a.IsSigner = a.IsSigner || account.IsSigner
+				a.IsWritable = a.IsWritable || account.IsWritable
+			}
+		}
+	}
+	if a, exist := accountMap[feePayer]; exist {
+		a.IsSigner, a.IsWritable = true, true
+	} else {
+		accountMap[feePayer] = &types.AccountMeta{PubKey: feePayer, IsSigner: true, IsWritable: true}
+	}
+
+	// a table address is looked up from the first table holding it
+	tableOf := map[common.PublicKey]int{}
+	indexOf := map[common.PublicKey]uint8{}
+	for i := len(lookupTables) - 1; i >= 0; i-- {
+		addresses := lookupTables[i].Addresses
+		if len(addresses) > maxAccounts {
+			addresses = addresses[:maxAccounts]
+		}
+		for j := len(addresses) - 1; j >= 0; j-- {
+			tableOf[addresses[j]] = i
+			indexOf[addresses[j]] = uint8(j)
+		}
+	}
+
+	var writableSigned, readonlySigned, writableUnsigned, readonlyUnsigned []common.PublicKey
+	loadedWritable := make([][]common.PublicKey, len(lookupTables))
+	loadedReadonly := make([][]common.PublicKey, len(lookupTables))
+	for _, account := range accountMap {
+		if account.PubKey == feePayer {
+			continue
+		}
+		if table, exist := tableOf[account.PubKey]; exist && !account.IsSigner && !programs[account.PubKey] {
+			if account.IsWritable {
+				loadedWritable[table] = append(loadedWritable[table], account.PubKey)
+			} else {
+				loadedReadonly[table] = append(loadedReadonly[table], account.PubKey)
+			}
+			continue
+		}
+		switch {
+		case account.IsSigner && account.IsWritable:
+			writableSigned = append(writableSigned, account.PubKey)
+		case account.IsSigner:
+			readonlySigned = append(readonlySigned, account.PubKey)
+		case account.IsWritable:
+			writableUnsigned = append(writableUnsigned, account.PubKey)
+		default:
+			readonlyUnsigned = append(readonlyUnsigned, account.PubKey)
+		}
+	}
+	for _, accounts := range [][]common.PublicKey{writableSigned, readonlySigned, writableUnsigned, readonlyUnsigned} {
+		sortAccounts(accounts)
+	}
+
+	static := make([]common.PublicKey, 0, len(accountMap))
+	static = append(static, feePayer)
+	static = append(static, writableSigned...)
+	static = append(static, readonlySigned...)
+	static = append(static, writableUnsigned...)
+	static = append(static, readonlyUnsigned...)
+
+	accountIndex := map[common.PublicKey]int{}
+	for i, account := range static {
+		accountIndex[account] = i
+	}
+	lookups := make([]MessageLookup, 0)
+	writable := make([]common.PublicKey, 0)
+	readonly := make([]common.PublicKey, 0)
+	for i, table := range lookupTables {
+		if len(loadedWritable[i]) == 0 && len(loadedReadonly[i]) == 0 {
+			continue
+		}
+		lookup := MessageLookup{Table: table.Key, WritableIndexes: []uint8{}, ReadonlyIndexes: []uint8{}}
+		sortAccounts(loadedWritable[i])
+		sortAccounts(loadedReadonly[i])
+		for _, account := range loadedWritable[i] {
+			lookup.WritableIndexes = append(lookup.WritableIndexes, indexOf[account])
+		}
+		for _, account := range loadedReadonly[i] {
+			lookup.ReadonlyIndexes = append(lookup.ReadonlyIndexes, indexOf[account])
+		}
+		lookups = append(lookups, lookup)
+		writable = append(writable, loadedWritable[i]...)
+		readonly = append(readonly, loadedReadonly[i]...)
+	}
+	for i, account := range writable {
+		accountIndex[account] = len(static) + i
+	}
+	for i, account := range readonly {
+		accountIndex[account] = len(static) + len(writable) + i
+	}
+	if len(accountIndex) > maxAccounts {
+		return Message{}, fmt.Errorf("tx references %d accounts, at most %d allowed", len(accountIndex), maxAccounts)
+	}
+
+	compiledInstructions := make([]types.CompiledInstruction, 0, len(instructions))
+	for _, instruction := range instructions {
+		accounts := make([]int, 0, len(instruction.Accounts))
+		for _, account := range instruction.Accounts {
+			accounts = append(accounts, accountIndex[account.PubKey])
+		}
+		compiledInstructions = append(compiledInstructions, types.CompiledInstruction{
+			ProgramIDIndex: accountIndex[instruction.ProgramID],
+			Accounts:       accounts,
+			Data:           instruction.Data,
+		})
+	}
+
+	return Message{
+		Header: types.MessageHeader{
+			NumRequireSignatures:        uint8(1 + len(writableSigned) + len(readonlySigned)),
+			NumReadonlySignedAccounts:   uint8(len(readonlySigned)),
+			NumReadonlyUnsignedAccounts: uint8(len(readonlyUnsigned)),
+		},
+		StaticAccounts:  static,
+		RecentBlockHash: recentBlockHash,
+		Instructions:    compiledInstructions,
+		Lookups:         lookups,
+	}, nil
+}
+
+func sortAccounts(accounts []common.PublicKey) {
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Bytes(), accounts[j].Bytes()) < 0
+	})
+}
+
+func (m *Message) Serialize() ([]byte, error) {
+	b := []byte{versionPrefix}
+	b = append(b, m.Header.NumRequireSignatures)
+	b = append(b, m.Header.NumReadonlySignedAccounts)
+	b = append(b, m.Header.NumReadonlyUnsignedAccounts)
+
+	b = append(b, common.UintToVarLenBytes(uint64(len(m.StaticAccounts)))...)
+	for _, key := range m.StaticAccounts {
+		b = append(b, key[:]...)
+	}
+
+	blockHash, err := base58.Decode(m.RecentBlockHash)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, blockHash...)
+
+	b = append(b, common.UintToVarLenBytes(uint64(len(m.Instructions)))...)
+	for _, instruction := range m.Instructions {
+		b = append(b, byte(instruction.ProgramIDIndex))
+		b = append(b, common.UintToVarLenBytes(uint64(len(instruction.Accounts)))...)
+		for _, accountIdx := range instruction.Accounts {
+			b = append(b, byte(accountIdx))
+		}
+		b = append(b, common.UintToVarLenBytes(uint64(len(instruction.Data)))...)
+		b = append(b, instruction.Data...)
+	}
+
+	b = append(b, common.UintToVarLenBytes(uint64(len(m.Lookups)))...)
+	for _, lookup := range m.Lookups {
+		b = append(b, lookup.Table[:]...)
+		b = append(b, common.UintToVarLenBytes(uint64(len(lookup.WritableIndexes)))...)
+		b = append(b, lookup.WritableIndexes...)
+		b = append(b, common.UintToVarLenBytes(uint64(len(lookup.ReadonlyIndexes)))...)
+		b = append(b, lookup.ReadonlyIndexes...)
+	}
+	return b, nil
+}
+
+// DecompileInstructions resolves the instruction accounts, tables maps each looked up table to its addresses
+func (m *Message) DecompileInstructions(tables map[common.PublicKey][]common.PublicKey) ([]types.Instruction, error) {
+	writable := make([]common.PublicKey, 0)
+	readonly := make([]common.PublicKey, 0)
+	for _, lookup := range m.Lookups {
+		addresses, exist := tables[lookup.Table]
+		if !exist {
+			return nil, fmt.Errorf("lookup table %s not found", lookup.Table.ToBase58())
+		}
+		for _, indexes := range []struct {
+			indexes []uint8
+			to      *[]common.PublicKey
+		}{{lookup.WritableIndexes, &writable}, {lookup.ReadonlyIndexes, &readonly}} {
+			for _, index := range indexes.indexes {
+				if int(index) >= len(addresses) {
+					return nil, fmt.Errorf("lookup table %s index %d out of range", lookup.Table.ToBase58(), index)
+				}
+				*indexes.to = append(*indexes.to, addresses[index])
+			}
+		}
+	}
+	accounts := make([]common.PublicKey, 0, len(m.StaticAccounts)+len(writable)+len(readonly))
+	accounts = append(accounts, m.StaticAccounts...)
+	accounts = append(accounts, writable...)
+	accounts = append(accounts, readonly...)
+
+	numSigned := int(m.Header.NumRequireSignatures)
+	numStatic := len(m.StaticAccounts)
+	isWritable := func(i int) bool {
+		switch {
+		case i < numSigned:
+			return i < numSigned-int(m.Header.NumReadonlySignedAccounts)
+		case i < numStatic:
+			return i < numStatic-int(m.Header.NumReadonlyUnsignedAccounts)
+		default:
+			return i < numStatic+len(writable)
+		}
+	}
+
+	instructions := make([]types.Instruction, 0, len(m.Instructions))
+	for _, cins := range m.Instructions {
+		if cins.ProgramIDIndex >= numStatic {
+			return nil, fmt.Errorf("program index %d not a static account", cins.ProgramIDIndex)
+		}
+		metas := make([]types.AccountMeta, 0, len(cins.Accounts))
+		for _, i := range cins.Accounts {
+			if i >= len(accounts) {
+				return nil, fmt.Errorf("account index %d out of range", i)
+			}
+			metas = append(metas, types.AccountMeta{
+				PubKey:     accounts[i],
+				IsSigner:   i < numSigned,
+				IsWritable: isWritable(i),
+			})
+		}
+		instructions = append(instructions, types.Instruction{
+			ProgramID: m.StaticAccounts[cins.ProgramIDIndex],
+			Accounts:  metas,
+			Data:      cins.Data,
+		})
+	}
+	return instructions, nil
+}
+
+func (tx *Transaction) Serialize() ([]byte, error) {
+	if len(tx.Signatures) == 0 || len(tx.Signatures) != int(tx.Message.Header.NumRequireSignatures) {
+		return nil, errors.New("Signature verification failed")
+	}
+	messageData, err := tx.Message.Serialize()
+	if err != nil {
+		return nil, err
+	}
+
+	output := common.UintToVarLenBytes(uint64(len(tx.Signatures)))
+	for _, sig := range tx.Signatures {
+		output = append(output, sig...)
+	}
+	return append(output, messageData...), nil
+}
+
+// IsVersioned tells whether a serialized tx carries a versioned message
+func IsVersioned(rawTx []byte) bool {
+	count, n := binary.Uvarint(rawTx)
+	offset := n + int(count)*64
+	return n > 0 && offset < len(rawTx) && rawTx[offset]&versionPrefix != 0
+}
+
+func TransactionDeserialize(rawTx []byte) (Transaction, error) {
+	d := decoder{data: rawTx}
+	signatureCount := d.uvarint()
+	tx := Transaction{}
+	for i := uint64(0); i < signatureCount && d.err == nil; i++ {
+		tx.Signatures = append(tx.Signatures, d.bytes(64))
+	}
+
+	if prefix := d.byte(); d.err == nil && prefix != versionPrefix {
+		return Transaction{}, fmt.Errorf("message version prefix %#x not supported", prefix)
+	}
+	m := &tx.Message
+	m.Header.NumRequireSignatures = d.byte()
+	m.Header.NumReadonlySignedAccounts = d.byte()
+	m.Header.NumReadonlyUnsignedAccounts = d.byte()
+	accountCount := d.uvarint()
+	for i := uint64(0); i < accountCount && d.err == nil; i++ {
+		m.StaticAccounts = append(m.StaticAccounts, common.PublicKeyFromBytes(d.bytes(32)))
+	}
+	m.RecentBlockHash = base58.Encode(d.bytes(32))
+	instructionCount := d.uvarint()
+	for i := uint64(0); i < instructionCount && d.err == nil; i++ {
+		cins := types.CompiledInstruction{ProgramIDIndex: int(d.byte())}
+		for _, index := range d.bytes(int(d.uvarint())) {
+			cins.Accounts = append(cins.Accounts, int(index))
+		}
+		cins.Data = d.bytes(int(d.uvarint()))
+		m.Instructions = append(m.Instructions, cins)
+	}
+	lookupCount := d.uvarint()
+	for i := uint64(0); i < lookupCount && d.err == nil; i++ {
+		lookup := MessageLookup{Table: common.PublicKeyFromBytes(d.bytes(32))}
+		lookup.WritableIndexes = d.bytes(int(d.uvarint()))
+		lookup.ReadonlyIndexes = d.bytes(int(d.uvarint()))
+		m.Lookups = append(m.Lookups, lookup)
+	}
+	if d.err != nil {
+		return Transaction{}, d.err
+	}
+	if len(tx.Signatures) != int(m.Header.NumRequireSignatures) {
+		return Transaction{}, fmt.Errorf("signature count %d, %d required", len(tx.Signatures), m.Header.NumRequireSignatures)
+	}
+	return tx, nil
+}
+
+// decoder reads a serialized tx front to back, the first error sticks and later reads return zero values
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = errors.New("tx data too short")
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	u, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = errors.New("tx data format error")
+		return 0
+	}
+	d.data = d.data[n:]
+	return u
+}
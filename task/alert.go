@@ -0,0 +1,102 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
+)
+
+const (
+	defaultAlertRetryThreshold = 10
+	defaultAlertMinInterval    = 600 // seconds
+	alertTimeout               = 10 * time.Second
+)
+
+// initNotifier builds the notifier of the configured sinks, alerts are dropped if none configured.
+func (task *Task) initNotifier() {
+	cfg := task.cfg.Alert
+	notifiers := make(alert.Multi, 0)
+	if len(cfg.WebhookURL) > 0 {
+		notifiers = append(notifiers, alert.NewWebhookNotifier(cfg.WebhookURL))
+	}
+	if len(cfg.SlackWebhookURL) > 0 {
+		notifiers = append(notifiers, alert.NewSlackNotifier(cfg.SlackWebhookURL))
+	}
+	if len(cfg.TelegramBotToken) > 0 {
+		notifiers = append(notifiers, alert.NewTelegramNotifier(cfg.TelegramAPIURL, cfg.TelegramBotToken, cfg.TelegramChatID))
+	}
+	if len(notifiers) == 0 {
+		return
+	}
+
+	minInterval := time.Duration(cfg.MinInterval) * time.Second
+	if minInterval == 0 {
+		minInterval = defaultAlertMinInterval * time.Second
+	}
+	task.notifier = alert.NewThrottled(notifiers, minInterval)
+}
+
+func (task *Task) alertSource() string {
+	if task.entrustedMode {
+		return "stack " + task.stackAccountPubkey.ToBase58()
+	}
+	return "stakeManager " + task.stakeManagerPubkey.ToBase58()
+}
+
+// alert notifies in background, handlers never wait on sinks
+func (task *Task) alert(level alert.Level, title, format string, args ...interface{}) {
+	if task.notifier == nil {
+		return
+	}
+	a := alert.Alert{
+		Level:   level,
+		Title:   title,
+		Message: fmt.Sprintf(format, args...),
+		Source:  task.alertSource(),
+		Time:    time.Now(),
+	}
+	SafeGo(func() {
+		task.notify(a)
+	})
+}
+
+// alertSync notifies before returning, for alerts raised on shutdown
+func (task *Task) alertSync(level alert.Level, title, format string, args ...interface{}) {
+	if task.notifier == nil {
+		return
+	}
+	task.notify(alert.Alert{
+		Level:   level,
+		Title:   title,
+		Message: fmt.Sprintf(format, args...),
+		Source:  task.alertSource(),
+		Time:    time.Now(),
+	})
+}
+
+func (task *Task) notify(a alert.Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+	if err := task.notifier.Notify(ctx, a); err != nil {
+		logrus.Warnf("send alert %s failed: %s", a.Title, err)
+	}
+}
+
+// checkRateChange alerts when one era moves the rate by more than RateChangeThreshold
+func (task *Task) checkRateChange(stakeManagerAddr string, oldRate, newRate uint64) {
+	threshold := task.cfg.Alert.RateChangeThreshold
+	if threshold == 0 || oldRate == 0 {
+		return
+	}
+	diff := newRate - oldRate
+	if newRate < oldRate {
+		diff = oldRate - newRate
+	}
+	// diff/oldRate > threshold/1e9, multiplied through in float to avoid overflow
+	if float64(diff)*1e9 > float64(threshold)*float64(oldRate) {
+		task.alert(alert.LevelWarn, "rate changed over threshold", "stakeManager %s rate moved from %d to %d", stakeManagerAddr, oldRate, newRate)
+	}
+}
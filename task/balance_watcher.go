@@ -0,0 +1,106 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+)
+
+const defaultBalanceCheckInterval = 60 // seconds
+
+var defaultPauseHandlers = []string{"EraMerge", "EraWithdraw"}
+
+type balanceLevel int
+
+const (
+	balanceLevelOk balanceLevel = iota
+	balanceLevelWarn
+	balanceLevelCritical
+)
+
+// initPauseHandlers checks the handlers paused on critical balance exist
+func (task *Task) initPauseHandlers() error {
+	names := task.cfg.Balance.PauseHandlers
+	if len(names) == 0 {
+		names = defaultPauseHandlers
+		task.cfg.Balance.PauseHandlers = names
+	}
+
+	task.pauseHandlers = make(map[string]bool, len(names))
+	for _, name := range names {
+		exist := false
+		for _, handler := range task.handlers {
+			if handler.name == name {
+				exist = true
+				break
+			}
+		}
+		if !exist {
+			return fmt.Errorf("unknown pause handler: %s", name)
+		}
+		task.pauseHandlers[name] = true
+	}
+	return nil
+}
+
+// paused reports whether a handler is skipped to save the fee payer balance
+// for the handlers moving the era on.
+func (task *Task) paused(handlerName string) bool {
+	return task.lowBalance.Load() && task.pauseHandlers[handlerName]
+}
+
+// watchBalance checks the fee payer balance every CheckInterval, it logs when the balance
+// crosses WarnBalance or CriticalBalance and pauses PauseHandlers below CriticalBalance.
+func (task *Task) watchBalance() {
+	interval := time.Duration(task.cfg.Balance.CheckInterval) * time.Second
+	if interval == 0 {
+		interval = defaultBalanceCheckInterval * time.Second
+	}
+	feePayer := task.feePayerAccount.PublicKey.ToBase58()
+
+	level := balanceLevelOk
+	for {
+		balance, err := task.client.Load().GetBalance(context.Background(), feePayer)
+		if err != nil {
+			logrus.Warnf("get fee payer %s balance failed: %s", feePayer, err)
+		} else {
+			metrics.FeePayerBalance.Set(float64(balance))
+			task.health.setFeePayerBalance(balance)
+
+			newLevel := balanceLevelOk
+			switch {
+			case task.cfg.Balance.CriticalBalance > 0 && balance < task.cfg.Balance.CriticalBalance:
+				newLevel = balanceLevelCritical
+			case task.cfg.Balance.WarnBalance > 0 && balance < task.cfg.Balance.WarnBalance:
+				newLevel = balanceLevelWarn
+			}
+
+			if newLevel != level {
+				switch newLevel {
+				case balanceLevelCritical:
+					logrus.Errorf("fee payer %s balance %d below critical %d, pause handlers: %v",
+						feePayer, balance, task.cfg.Balance.CriticalBalance, task.cfg.Balance.PauseHandlers)
+					task.alert(alert.LevelCritical, "fee payer balance critical", "fee payer %s balance %d below %d, pause handlers: %v",
+						feePayer, balance, task.cfg.Balance.CriticalBalance, task.cfg.Balance.PauseHandlers)
+				case balanceLevelWarn:
+					logrus.Warnf("fee payer %s balance %d below warn %d", feePayer, balance, task.cfg.Balance.WarnBalance)
+					task.alert(alert.LevelWarn, "fee payer balance low", "fee payer %s balance %d below %d", feePayer, balance, task.cfg.Balance.WarnBalance)
+				default:
+					logrus.Infof("fee payer %s balance %d recovered", feePayer, balance)
+				}
+				level = newLevel
+			}
+			task.lowBalance.Store(level == balanceLevelCritical)
+		}
+
+		select {
+		case <-task.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+const defaultEndpointCheckInterval = 30 // seconds
+
+func configureRpcClient(c *rpc.Client, cfg config.RpcConfig) {
+	c.Broadcast = int(cfg.BroadcastEndpoints)
+	if cfg.MaxSlotLag > 0 {
+		c.Pool().MaxSlotLag = cfg.MaxSlotLag
+	}
+	if cfg.MaxErrorRate > 0 {
+		c.Pool().MaxErrorRate = float64(cfg.MaxErrorRate) / 100
+	}
+}
+
+// watchEndpoints health checks the rpc endpoints every CheckInterval and logs endpoints turning unhealthy or
+// recovering. The sdk client only moves on to the next endpoint on errors, so when the healthiest endpoint changes
+// a new client is swapped in trying the endpoints in the pool's order. The client in use is never changed, handlers
+// read it concurrently.
+func (task *Task) watchEndpoints() {
+	interval := time.Duration(task.cfg.Rpc.CheckInterval) * time.Second
+	if interval == 0 {
+		interval = defaultEndpointCheckInterval * time.Second
+	}
+
+	healthy := make(map[string]bool)
+	lead := task.cfg.EndpointList[0]
+	for {
+		for _, status := range task.rpcClient.CheckEndpoints(context.Background()) {
+			label := rpc.EndpointLabel(status.Endpoint)
+			wasHealthy, checked := healthy[status.Endpoint]
+			switch {
+			case !status.Healthy && (wasHealthy || !checked):
+				logrus.Warnf("rpc endpoint %s unhealthy: %s", label, status.Reason)
+			case status.Healthy && checked && !wasHealthy:
+				logrus.Infof("rpc endpoint %s recovered, slot lag: %d, latency: %s", label, status.SlotLag, status.Latency)
+			}
+			healthy[status.Endpoint] = status.Healthy
+
+			healthyValue := 0.0
+			if status.Healthy {
+				healthyValue = 1
+			}
+			metrics.RpcEndpointHealthy.WithLabelValues(label).Set(healthyValue)
+			metrics.RpcEndpointSlotLag.WithLabelValues(label).Set(float64(status.SlotLag))
+			metrics.RpcEndpointLatency.WithLabelValues(label).Set(status.Latency.Seconds())
+		}
+		if ordered := task.rpcClient.Pool().Ordered(); ordered[0] != lead {
+			lead = ordered[0]
+			c := client.NewClient(ordered)
+			task.client.Store(c)
+			task.txSender.SetClient(c)
+			logrus.Debugf("sdk client leads with rpc endpoint %s", rpc.EndpointLabel(lead))
+		}
+
+		select {
+		case <-task.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
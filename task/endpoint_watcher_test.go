@@ -0,0 +1,36 @@
+package task
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+func TestClientSwappedWhileHandling(t *testing.T) {
+	env := newTestEnv(t)
+	down := httptest.NewServer(nil)
+	down.Close()
+	env.task.cfg.EndpointList = []string{down.URL, env.server.URL}
+	env.task.rpcClient = rpc.NewClient(env.task.cfg.EndpointList)
+	original := env.task.client.Load()
+
+	done := make(chan struct{})
+	go func() {
+		env.task.watchEndpoints()
+		close(done)
+	}()
+	env.handleEra(t)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for env.task.client.Load() == original && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	swapped := env.task.client.Load()
+	if swapped == original || swapped != env.task.txSender.client.Load() || swapped.Endpoint() != env.server.URL {
+		t.Fatalf("sdk client leads with %s, want: %s", env.task.client.Load().Endpoint(), env.server.URL)
+	}
+	close(env.task.stop)
+	<-done
+}
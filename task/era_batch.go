@@ -0,0 +1,37 @@
+package task
+
+import (
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
+)
+
+const maxTxComputeUnits = 1400000 // a tx may take at most
+
+// maxBatch is how many instructions taking up to computeUnits each fit the compute limit of a tx
+func (task *Task) maxBatch(computeUnits uint64) int {
+	limit := uint64(maxTxComputeUnits)
+	if task.cfg.Fee.ComputeUnitLimit > 0 {
+		limit = uint64(task.cfg.Fee.ComputeUnitLimit)
+	}
+	if n := limit / computeUnits; n > 0 {
+		return int(n)
+	}
+	return 1
+}
+
+// batchInstructions splits the instructions, in order, into batches of at most maxBatch that fit in a tx sent with
+// the lookup tables. It returns the number of instructions of each batch.
+func (task *Task) batchInstructions(lookupTables []versionedtx.LookupTableAccount, instructions []types.Instruction, maxBatch int) []int {
+	sizes := make([]int, 0)
+	start := 0
+	for end := start + 2; end <= len(instructions); end++ {
+		if end-start > maxBatch || !task.txSender.Fits(lookupTables, instructions[start:end]) {
+			sizes = append(sizes, end-1-start)
+			start = end - 1
+		}
+	}
+	if start < len(instructions) {
+		sizes = append(sizes, len(instructions)-start)
+	}
+	return sizes
+}
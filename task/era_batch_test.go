@@ -0,0 +1,63 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/mockrpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+func countInstructions(instructions []string, name string) int {
+	count := 0
+	for _, instruction := range instructions {
+		if instruction == name {
+			count++
+		}
+	}
+	return count
+}
+
+func TestEraMergeWithdrawBatched(t *testing.T) {
+	env := newTestEnv(t)
+	stateStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+	env.task.cfg.LookupTable = true
+	addStakeAccounts(env, 24)
+	splitAccounts := make([]common.PublicKey, 0, 40)
+	for i := 0; i < 40; i++ {
+		splitAccount := types.NewAccount().PublicKey
+		env.server.AddStakeAccount(splitAccount, mockrpc.StakeAccount{Voter: env.validator, Stake: 1e9, DeactivationEpoch: 5})
+		splitAccounts = append(splitAccounts, splitAccount)
+	}
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) { sm.SplitAccounts = splitAccounts })
+
+	env.handleEra(t)
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if len(sm.StakeAccounts) != 1 || len(sm.SplitAccounts) != 0 {
+		t.Fatalf("stake accounts: %d, split accounts: %d", len(sm.StakeAccounts), len(sm.SplitAccounts))
+	}
+	instructions := env.server.Instructions()
+	if merges, withdraws := countInstructions(instructions, "era_merge"), countInstructions(instructions, "era_withdraw"); merges != 24 || withdraws != 40 {
+		t.Fatalf("era_merge landed: %d, era_withdraw landed: %d", merges, withdraws)
+	}
+
+	// each fits in one v0 tx, as legacy txs they take 2 and 3
+	state, err := stateStore.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := make(map[string]int)
+	for _, tx := range state.Txs {
+		txs[tx.Handler]++
+	}
+	if txs["EraMerge"] != 1 || txs["EraWithdraw"] != 1 {
+		t.Fatalf("EraMerge txs: %d, EraWithdraw txs: %d", txs["EraMerge"], txs["EraWithdraw"])
+	}
+}
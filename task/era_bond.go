@@ -2,27 +2,25 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
-	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 )
 
 func (task *Task) EraBond(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
-	minDelegationAmount, err := task.client.GetMinDelegationAmount(context.Background())
+	minDelegationAmount, err := task.client.Load().GetMinDelegationAmount(context.Background())
 	if err != nil {
 		return err
 	}
 
-	if !needBond(&stakeManager.EraProcessData, minDelegationAmount) {
+	if phase, _ := eraPhaseOf(&stakeManager.EraProcessData, minDelegationAmount); phase != EraPhaseBond {
 		return nil
 	}
 
@@ -31,47 +29,40 @@ func (task *Task) EraBond(stakeManagerAddr common.PublicKey) error {
 		return err
 	}
 
-	res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-		Commitment: client.CommitmentConfirmed,
-	})
+	validator, err := task.selectBondValidator(stakeManager)
 	if err != nil {
-		fmt.Printf("get recent block hash error, err: %v\n", err)
+		return err
 	}
 
-	stakeAccount := types.NewAccount() //random account
-
-	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-		Instructions: []types.Instruction{
-			lsdprog.EraBond(
-				task.lsdProgramID,
-				stakeManagerAddr,
-				stakeManager.Validators[0], // use first validator
-				stakePool,
-				stakeAccount.PublicKey,
-				task.feePayerAccount.PublicKey,
-			),
-		},
-		Signers:         []types.Account{task.feePayerAccount, stakeAccount},
-		FeePayer:        task.feePayerAccount.PublicKey,
-		RecentBlockHash: res.Blockhash,
-	})
-
+	// era_bond takes no amount: the program delegates the whole NeedBond and clears it in the same
+	// instruction, so one era can not be split across validators and a resend can not double bond.
+	stakeAccount, err := task.newStakeAccount(stakeManagerAddr, "EraBond", stakeManager.LatestEra)
 	if err != nil {
-		fmt.Printf("generate tx error, err: %v\n", err)
+		return err
 	}
-	txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
+
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraBond", era: stakeManager.LatestEra, stakeAccount: &stakeAccount}, []types.Instruction{
+		lsdprog.EraBond(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			validator,
+			stakePool,
+			stakeAccount.PublicKey,
+			task.feePayerAccount.PublicKey,
+		),
+	}, stakeAccount)
 	if err != nil {
-		fmt.Printf("send tx error, err: %v\n", err)
+		return err
 	}
 
-	logrus.Infof("EraBond send tx hash: %s, stakeAccount: %s, bond: %d",
-		txHash, stakeAccount.PublicKey.ToBase58(), stakeManager.EraProcessData.NeedBond)
-	if err := task.waitTx(txHash); err != nil {
-		stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	logrus.Infof("EraBond send tx hash: %s, stakeAccount: %s, validator: %s, bond: %d",
+		result.Signature, stakeAccount.PublicKey.ToBase58(), validator.ToBase58(), stakeManager.EraProcessData.NeedBond)
+	if err := result.Err(); err != nil {
+		stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if errInside != nil {
 			return errInside
 		}
-		if !needBond(&stakeManagerNew.EraProcessData, minDelegationAmount) {
+		if phase, _ := eraPhaseOf(&stakeManagerNew.EraProcessData, minDelegationAmount); phase != EraPhaseBond {
 			logrus.Info("EraBond success")
 			return nil
 		}
@@ -2,7 +2,6 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stafiprotocol/solana-go-sdk/client"
@@ -11,13 +10,21 @@ import (
 	"github.com/stafiprotocol/solana-go-sdk/types"
 )
 
+const eraMergeComputeUnits = 50000 // an EraMerge instruction takes at most, with the stake program merge
+
+type eraMerge struct {
+	src, dst common.PublicKey
+}
+
+// EraMerge merges the active stake accounts delegated to the same validator with the same credits observed. The
+// instructions are packed into as few txs as fit, v0 txs with the lookup table of the stake manager if LookupTable is set.
 func (task *Task) EraMerge(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
-	if !isEmpty(&stakeManager.EraProcessData) {
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseIdle {
 		return nil
 	}
 
@@ -28,7 +35,7 @@ func (task *Task) EraMerge(stakeManagerAddr common.PublicKey) error {
 
 	valToAccount := make(map[string]map[uint64][]common.PublicKey) // voter -> credit -> []stakeAccount
 	for _, stakeAccount := range stakeManager.StakeAccounts {
-		accountInfo, err := task.client.GetStakeActivation(
+		accountInfo, err := task.client.Load().GetStakeActivation(
 			context.Background(),
 			stakeAccount.ToBase58(),
 			client.GetStakeActivationConfig{})
@@ -39,7 +46,7 @@ func (task *Task) EraMerge(stakeManagerAddr common.PublicKey) error {
 			continue
 		}
 
-		account, err := task.client.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		account, err := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
 		if err != nil {
 			return err
 		}
@@ -55,64 +62,65 @@ func (task *Task) EraMerge(stakeManagerAddr common.PublicKey) error {
 		valToAccount[voter][credit] = append(valToAccount[voter][credit], stakeAccount)
 	}
 
+	// every account of a group merges into the first, a batch may hold several of them
+	merges := make([]eraMerge, 0)
 	for _, creditToAccounts := range valToAccount {
 		for _, accounts := range creditToAccounts {
-			if len(accounts) < 2 {
-				continue
-			}
-			res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-				Commitment: client.CommitmentConfirmed,
-			})
-			if err != nil {
-				fmt.Printf("get recent block hash error, err: %v\n", err)
-			}
-			srcStakeAccount := accounts[1]
-			dstStakeAccount := accounts[0]
-			rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-				Instructions: []types.Instruction{
-					lsdprog.EraMerge(
-						task.lsdProgramID,
-						stakeManagerAddr,
-						srcStakeAccount,
-						dstStakeAccount,
-						stakePool,
-					),
-				},
-				Signers:         []types.Account{task.feePayerAccount},
-				FeePayer:        task.feePayerAccount.PublicKey,
-				RecentBlockHash: res.Blockhash,
-			})
-			if err != nil {
-				fmt.Printf("generate tx error, err: %v\n", err)
-			}
-			txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
-			if err != nil {
-				fmt.Printf("send tx error, err: %v\n", err)
+			for _, srcStakeAccount := range accounts[1:] {
+				merges = append(merges, eraMerge{src: srcStakeAccount, dst: accounts[0]})
 			}
+		}
+	}
+	if len(merges) == 0 {
+		return nil
+	}
 
-			logrus.Infof("EraMerge send tx hash: %s, srcStakeAccount: %s, dstStakeAccount: %s",
-				txHash, srcStakeAccount.ToBase58(), dstStakeAccount.ToBase58())
-			if err := task.waitTx(txHash); err != nil {
-				stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
-				if errInside != nil {
-					return errInside
-				}
-				stakeAccountExist := make(map[string]bool)
-				for _, stakeAccount := range stakeManagerNew.StakeAccounts {
-					stakeAccountExist[stakeAccount.ToBase58()] = true
-				}
+	lookupTables, err := task.eraLookupTables(stakeManagerAddr, stakeManager)
+	if err != nil {
+		logrus.Warnf("lookup table of stakeManager %s not usable: %s, send legacy txs", stakeManagerAddr.ToBase58(), err)
+	}
+	instructions := make([]types.Instruction, 0, len(merges))
+	for _, merge := range merges {
+		instructions = append(instructions, lsdprog.EraMerge(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			merge.src,
+			merge.dst,
+			stakePool,
+		))
+	}
 
-				if !stakeAccountExist[srcStakeAccount.ToBase58()] || !stakeAccountExist[dstStakeAccount.ToBase58()] {
-					logrus.Info("EraMerge success")
-					continue
-				}
+	start := 0
+	for _, size := range task.batchInstructions(lookupTables, instructions, task.maxBatch(eraMergeComputeUnits)) {
+		batch := merges[start : start+size]
+		result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraMerge", era: stakeManager.LatestEra, lookupTables: lookupTables},
+			instructions[start:start+size])
+		start += size
+		if err != nil {
+			return err
+		}
 
-				return err
+		logrus.Infof("EraMerge send tx hash: %s, merges: %d, first srcStakeAccount: %s, dstStakeAccount: %s",
+			result.Signature, len(batch), batch[0].src.ToBase58(), batch[0].dst.ToBase58())
+		if err := result.Err(); err != nil {
+			stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+			if errInside != nil {
+				return errInside
+			}
+			stakeAccountExist := make(map[string]bool)
+			for _, stakeAccount := range stakeManagerNew.StakeAccounts {
+				stakeAccountExist[stakeAccount.ToBase58()] = true
 			}
 
-			logrus.Info("EraMerge success")
-
+			// a failed tx may have landed after all, it only fails the handler if one of its merges is still to do
+			for _, merge := range batch {
+				if stakeAccountExist[merge.src.ToBase58()] && stakeAccountExist[merge.dst.ToBase58()] {
+					return err
+				}
+			}
 		}
+
+		logrus.Info("EraMerge success")
 	}
 
 	return nil
@@ -2,7 +2,6 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stafiprotocol/solana-go-sdk/client"
@@ -12,11 +11,11 @@ import (
 )
 
 func (task *Task) EraNew(stakeManagerAddr common.PublicKey) error {
-	epochInfo, err := task.client.GetEpochInfo(context.Background(), client.CommitmentFinalized)
+	epochInfo, err := task.client.Load().GetEpochInfo(context.Background(), client.CommitmentFinalized)
 	if err != nil {
 		return err
 	}
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
@@ -24,39 +23,23 @@ func (task *Task) EraNew(stakeManagerAddr common.PublicKey) error {
 		return nil
 	}
 
-	if !isEmpty(&stakeManager.EraProcessData) {
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseIdle {
 		return nil
 	}
 
-	res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-		Commitment: client.CommitmentConfirmed,
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraNew", era: stakeManager.LatestEra + 1}, []types.Instruction{
+		lsdprog.EraNew(
+			task.lsdProgramID,
+			stakeManagerAddr,
+		),
 	})
 	if err != nil {
-		fmt.Printf("get recent block hash error, err: %v\n", err)
-	}
-
-	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-		Instructions: []types.Instruction{
-			lsdprog.EraNew(
-				task.lsdProgramID,
-				stakeManagerAddr,
-			),
-		},
-		Signers:         []types.Account{task.feePayerAccount},
-		FeePayer:        task.feePayerAccount.PublicKey,
-		RecentBlockHash: res.Blockhash,
-	})
-	if err != nil {
-		fmt.Printf("generate tx error, err: %v\n", err)
-	}
-	txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
-	if err != nil {
-		fmt.Printf("send tx error, err: %v\n", err)
+		return err
 	}
 
-	logrus.Infof("EraNew send tx hash: %s, newEra: %d", txHash, stakeManager.LatestEra+1)
-	if err := task.waitTx(txHash); err != nil {
-		stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	logrus.Infof("EraNew send tx hash: %s, newEra: %d", result.Signature, stakeManager.LatestEra+1)
+	if err := result.Err(); err != nil {
+		stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if errInside != nil {
 			return errInside
 		}
@@ -2,65 +2,46 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
-	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 )
 
 func (task *Task) EraSkipBond(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
-	minDelegationAmount, err := task.client.GetMinDelegationAmount(context.Background())
+	minDelegationAmount, err := task.client.Load().GetMinDelegationAmount(context.Background())
 	if err != nil {
 		return err
 	}
 
-	if !needSkipBond(&stakeManager.EraProcessData, minDelegationAmount) {
+	if phase, _ := eraPhaseOf(&stakeManager.EraProcessData, minDelegationAmount); phase != EraPhaseSkipBond {
 		return nil
 	}
 
-	res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-		Commitment: client.CommitmentConfirmed,
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraSkipBond", era: stakeManager.LatestEra}, []types.Instruction{
+		lsdprog.EraSkipBond(
+			task.lsdProgramID,
+			stakeManagerAddr,
+		),
 	})
 	if err != nil {
-		fmt.Printf("get recent block hash error, err: %v\n", err)
-	}
-
-	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-		Instructions: []types.Instruction{
-			lsdprog.EraSkipBond(
-				task.lsdProgramID,
-				stakeManagerAddr,
-			),
-		},
-		Signers:         []types.Account{task.feePayerAccount},
-		FeePayer:        task.feePayerAccount.PublicKey,
-		RecentBlockHash: res.Blockhash,
-	})
-
-	if err != nil {
-		fmt.Printf("generate tx error, err: %v\n", err)
-	}
-	txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
-	if err != nil {
-		fmt.Printf("send tx error, err: %v\n", err)
+		return err
 	}
 
 	logrus.Infof("EraSkipBond send tx hash: %s,  skipBondAmount: %d",
-		txHash, stakeManager.EraProcessData.NeedBond)
-	if err := task.waitTx(txHash); err != nil {
-		stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+		result.Signature, stakeManager.EraProcessData.NeedBond)
+	if err := result.Err(); err != nil {
+		stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if errInside != nil {
 			return errInside
 		}
-		if !needSkipBond(&stakeManagerNew.EraProcessData, minDelegationAmount) {
+		if phase, _ := eraPhaseOf(&stakeManagerNew.EraProcessData, minDelegationAmount); phase != EraPhaseSkipBond {
 			logrus.Info("EraSkipBond success")
 			return nil
 		}
@@ -0,0 +1,130 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+)
+
+type EraPhase string
+
+const (
+	EraPhaseIdle         EraPhase = "idle"          // era of the current epoch processed
+	EraPhaseNew          EraPhase = "new"           // a new epoch started, the era is due
+	EraPhaseSkipBond     EraPhase = "skip_bond"     // bond below the min delegation, carried to the next era
+	EraPhaseBond         EraPhase = "bond"          // bond to delegate
+	EraPhaseUnbond       EraPhase = "unbond"        // unbond to split off and deactivate
+	EraPhaseUpdateActive EraPhase = "update_active" // stake accounts to count into the new active
+	EraPhaseUpdateRate   EraPhase = "update_rate"   // new active counted, rate to update
+	EraPhaseIllegal      EraPhase = "illegal"       // process data no era instruction can move on
+)
+
+// eraPhaseHandlers are the handlers driven by the era state machine, the others run once the era is idle
+var eraPhaseHandlers = map[EraPhase]string{
+	EraPhaseNew:          "EraNew",
+	EraPhaseSkipBond:     "EraSkipBond",
+	EraPhaseBond:         "EraBond",
+	EraPhaseUnbond:       "EraUnbond",
+	EraPhaseUpdateActive: "EraUpdateActive",
+	EraPhaseUpdateRate:   "EraUpdateRate",
+}
+
+func isEraPhaseHandler(name string) bool {
+	for _, handler := range eraPhaseHandlers {
+		if handler == name {
+			return true
+		}
+	}
+	return false
+}
+
+// EraState is where a stake manager is in processing its era, and the single action moving it on
+type EraState struct {
+	Era                  uint64   `json:"era"`
+	Epoch                uint64   `json:"epoch"`
+	Phase                EraPhase `json:"phase"`
+	Handler              string   `json:"handler,omitempty"` // handler of the next action, empty if idle or illegal
+	Reason               string   `json:"reason"`
+	NeedBond             uint64   `json:"needBond"`
+	NeedUnbond           uint64   `json:"needUnbond"`
+	OldActive            uint64   `json:"oldActive"`
+	NewActive            uint64   `json:"newActive"`
+	PendingStakeAccounts int      `json:"pendingStakeAccounts"`
+}
+
+// NewEraState computes the era state of a stake manager in epoch, minDelegationAmount tells skip bond from bond.
+func NewEraState(stakeManager *lsdprog.StakeManager, epoch, minDelegationAmount uint64) EraState {
+	data := &stakeManager.EraProcessData
+	phase, reason := eraPhaseOf(data, minDelegationAmount)
+	if phase == EraPhaseIdle && stakeManager.LatestEra < epoch {
+		phase = EraPhaseNew
+		reason = fmt.Sprintf("latest era %d behind epoch %d", stakeManager.LatestEra, epoch)
+	}
+	return EraState{
+		Era:                  stakeManager.LatestEra,
+		Epoch:                epoch,
+		Phase:                phase,
+		Handler:              eraPhaseHandlers[phase],
+		Reason:               reason,
+		NeedBond:             data.NeedBond,
+		NeedUnbond:           data.NeedUnbond,
+		OldActive:            data.OldActive,
+		NewActive:            data.NewActive,
+		PendingStakeAccounts: len(data.PendingStakeAccounts),
+	}
+}
+
+// eraPhaseOf follows the order the program processes an era in: era_new nets the era's bond and unbond into
+// NeedBond or NeedUnbond and snapshots the stake accounts as pending, which are counted once bond or unbond is done,
+// then the rate is updated and the process data cleared. It returns EraPhaseIdle if no era is in process.
+func eraPhaseOf(data *lsdprog.EraProcessData, minDelegationAmount uint64) (EraPhase, string) {
+	switch {
+	case data.NeedBond > 0 && data.NeedUnbond > 0:
+		return EraPhaseIllegal, fmt.Sprintf("need bond %d and need unbond %d both set", data.NeedBond, data.NeedUnbond)
+	case data.NeedBond > 0 && data.NeedBond < minDelegationAmount:
+		return EraPhaseSkipBond, fmt.Sprintf("need bond %d below min delegation %d", data.NeedBond, minDelegationAmount)
+	case data.NeedBond > 0:
+		return EraPhaseBond, fmt.Sprintf("need bond %d", data.NeedBond)
+	case data.NeedUnbond > 0:
+		return EraPhaseUnbond, fmt.Sprintf("need unbond %d", data.NeedUnbond)
+	case len(data.PendingStakeAccounts) > 0:
+		return EraPhaseUpdateActive, fmt.Sprintf("%d stake accounts pending", len(data.PendingStakeAccounts))
+	case data.NewActive != 0 && data.OldActive != 0:
+		return EraPhaseUpdateRate, fmt.Sprintf("old active %d, new active %d", data.OldActive, data.NewActive)
+	case data.NewActive != 0 || data.OldActive != 0:
+		return EraPhaseIllegal, fmt.Sprintf("old active %d, new active %d, rate can not be updated", data.OldActive, data.NewActive)
+	default:
+		return EraPhaseIdle, "no era in process"
+	}
+}
+
+// eraProcessPhase is eraPhaseOf for handlers that need not tell skip bond from bond
+func eraProcessPhase(data *lsdprog.EraProcessData) EraPhase {
+	phase, _ := eraPhaseOf(data, 0)
+	return phase
+}
+
+// sameProgress tells if nothing moved on between two states of a stake manager
+func (s *EraState) sameProgress(other *EraState) bool {
+	return s.Era == other.Era && s.Phase == other.Phase && s.NeedBond == other.NeedBond && s.NeedUnbond == other.NeedUnbond &&
+		s.NewActive == other.NewActive && s.PendingStakeAccounts == other.PendingStakeAccounts
+}
+
+func (task *Task) eraState(stakeManagerAddr common.PublicKey) (EraState, error) {
+	epochInfo, err := task.client.Load().GetEpochInfo(context.Background(), client.CommitmentFinalized)
+	if err != nil {
+		return EraState{}, err
+	}
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	if err != nil {
+		return EraState{}, err
+	}
+	minDelegationAmount, err := task.client.Load().GetMinDelegationAmount(context.Background())
+	if err != nil {
+		return EraState{}, err
+	}
+	return NewEraState(stakeManager, uint64(epochInfo.Epoch), minDelegationAmount), nil
+}
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+)
+
+func TestNewEraState(t *testing.T) {
+	pending := []common.PublicKey{{1}}
+	cases := []struct {
+		name      string
+		latestEra uint64
+		data      lsdprog.EraProcessData
+		phase     EraPhase
+		handler   string
+	}{
+		{"idle", 10, lsdprog.EraProcessData{}, EraPhaseIdle, ""},
+		{"new", 9, lsdprog.EraProcessData{}, EraPhaseNew, "EraNew"},
+		{"skip bond", 10, lsdprog.EraProcessData{NeedBond: 1, OldActive: 1, PendingStakeAccounts: pending}, EraPhaseSkipBond, "EraSkipBond"},
+		{"bond", 10, lsdprog.EraProcessData{NeedBond: 1e9, OldActive: 1, PendingStakeAccounts: pending}, EraPhaseBond, "EraBond"},
+		{"unbond", 10, lsdprog.EraProcessData{NeedUnbond: 1, OldActive: 1, PendingStakeAccounts: pending}, EraPhaseUnbond, "EraUnbond"},
+		{"update active", 10, lsdprog.EraProcessData{OldActive: 1, PendingStakeAccounts: pending}, EraPhaseUpdateActive, "EraUpdateActive"},
+		{"update rate", 10, lsdprog.EraProcessData{OldActive: 1, NewActive: 1}, EraPhaseUpdateRate, "EraUpdateRate"},
+		{"bond and unbond", 10, lsdprog.EraProcessData{NeedBond: 1e9, NeedUnbond: 1}, EraPhaseIllegal, ""},
+		{"no new active", 10, lsdprog.EraProcessData{OldActive: 1}, EraPhaseIllegal, ""},
+		{"era in process lags epoch", 8, lsdprog.EraProcessData{OldActive: 1, NewActive: 1}, EraPhaseUpdateRate, "EraUpdateRate"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := NewEraState(&lsdprog.StakeManager{LatestEra: c.latestEra, EraProcessData: c.data}, 10, 1e9)
+			if state.Phase != c.phase || state.Handler != c.handler {
+				t.Fatalf("phase: %s, handler: %s, want: %s, %s (%s)", state.Phase, state.Handler, c.phase, c.handler, state.Reason)
+			}
+		})
+	}
+}
+
+func TestIllegalEraStateStopsHandling(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) {
+		sm.LatestEra = 10
+		sm.EraProcessData.NeedBond = 1e9
+		sm.EraProcessData.NeedUnbond = 1e9
+	})
+	err := env.task.handleEra(nil)
+	if err == nil || !strings.Contains(err.Error(), "illegal") {
+		t.Fatalf("handleEra err: %v, want illegal state", err)
+	}
+	if got := env.server.Instructions(); len(got) != 0 {
+		t.Fatalf("instructions landed: %v", got)
+	}
+	states := env.task.health.eraStateList()
+	if len(states) != 1 || states[0].Phase != EraPhaseIllegal {
+		t.Fatalf("tracked era states: %+v", states)
+	}
+}
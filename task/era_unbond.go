@@ -5,19 +5,18 @@ import (
 	"fmt"
 
 	"github.com/sirupsen/logrus"
-	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
 )
 
 func (task *Task) EraUnbond(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
-	if !needUnbond(&stakeManager.EraProcessData) {
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseUnbond {
 		return nil
 	}
 
@@ -26,61 +25,67 @@ func (task *Task) EraUnbond(stakeManagerAddr common.PublicKey) error {
 		return err
 	}
 
-	stakeAccount := stakeManager.StakeAccounts[0] // use first
-	stakeAccountInfo, err := task.client.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+	plan, err := task.planUnbond(stakeManager)
 	if err != nil {
 		return err
 	}
-	validator := stakeAccountInfo.StakeAccount.Info.Stake.Delegation.Voter
 
-	res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-		Commitment: client.CommitmentConfirmed,
-	})
-	if err != nil {
-		fmt.Printf("get recent block hash error, err: %v\n", err)
+	for _, candidate := range plan {
+		if err := task.eraUnbondFrom(stakeManagerAddr, stakeManager, stakePool, candidate); err != nil {
+			return err
+		}
+		if task.cfg.DryRun {
+			// nothing changed on chain, later candidates would be planned on a stale NeedUnbond
+			return nil
+		}
+
+		stakeManager, err = task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+		if err != nil {
+			return err
+		}
+		if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseUnbond {
+			logrus.Info("EraUnbond success")
+			return nil
+		}
 	}
-	splitStakeAccount := types.NewAccount() //random account
 
-	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-		Instructions: []types.Instruction{
-			lsdprog.EraUnbond(
-				task.lsdProgramID,
-				stakeManagerAddr,
-				stakePool,
-				stakeAccount,
-				splitStakeAccount.PublicKey,
-				validator,
-				task.feePayerAccount.PublicKey,
-			),
-		},
-		Signers:         []types.Account{task.feePayerAccount, splitStakeAccount},
-		FeePayer:        task.feePayerAccount.PublicKey,
-		RecentBlockHash: res.Blockhash,
-	})
+	return fmt.Errorf("EraUnbond unbond plan used up, needUnbond: %d", stakeManager.EraProcessData.NeedUnbond)
+}
 
+func (task *Task) eraUnbondFrom(stakeManagerAddr common.PublicKey, stakeManager *lsdprog.StakeManager, stakePool common.PublicKey, candidate unbondCandidate) error {
+	splitStakeAccount, err := task.newStakeAccount(stakeManagerAddr, "EraUnbond", stakeManager.LatestEra)
 	if err != nil {
-		fmt.Printf("generate tx error, err: %v\n", err)
+		return err
 	}
-	txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
+
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraUnbond", era: stakeManager.LatestEra, stakeAccount: &splitStakeAccount}, []types.Instruction{
+		lsdprog.EraUnbond(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			stakePool,
+			candidate.stakeAccount,
+			splitStakeAccount.PublicKey,
+			candidate.validator,
+			task.feePayerAccount.PublicKey,
+		),
+	}, splitStakeAccount)
 	if err != nil {
-		fmt.Printf("send tx error, err: %v\n", err)
+		return err
 	}
 
-	logrus.Infof("EraUnbond send tx hash: %s, splitStakeAccount: %s, unbond: %d",
-		txHash, splitStakeAccount.PublicKey.ToBase58(), stakeManager.EraProcessData.NeedBond)
-	if err := task.waitTx(txHash); err != nil {
-		stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	logrus.Infof("EraUnbond send tx hash: %s, stakeAccount: %s, stake: %d, splitStakeAccount: %s, needUnbond: %d",
+		result.Signature, candidate.stakeAccount.ToBase58(), candidate.stake, splitStakeAccount.PublicKey.ToBase58(), stakeManager.EraProcessData.NeedUnbond)
+	if err := result.Err(); err != nil {
+		stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if errInside != nil {
 			return errInside
 		}
 		if stakeManagerNew.EraProcessData.NeedUnbond < stakeManager.EraProcessData.NeedUnbond {
-			logrus.Info("EraUnbond success")
 			return nil
 		}
 
 		return err
 	}
 
-	logrus.Info("EraUnbond success")
 	return nil
 }
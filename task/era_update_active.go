@@ -3,79 +3,159 @@ package task
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
-	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
 	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
 )
 
+const (
+	defaultUpdateActiveParallel = 4
+
+	updateActiveComputeUnits = 25000 // an EraUpdateActive instruction takes at most
+)
+
+// EraUpdateActive adds up the active stake of the pending stake accounts. The instructions are packed into as few
+// txs as fit, v0 txs with the lookup table of the stake manager if LookupTable is set, sent Parallel at a time,
+// and the accounts taken are read back from chain after each round.
 func (task *Task) EraUpdateActive(stakeManagerAddr common.PublicKey) error {
+	var lookupTables []versionedtx.LookupTableAccount
+	lookupTablesLoaded := false
 	for {
-		stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+		stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if err != nil {
 			return err
 		}
 
-		if !needUpdateActive(&stakeManager.EraProcessData) {
+		if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseUpdateActive {
 			return nil
 		}
 
-		eraActive := stakeManager.EraProcessData.OldActive
-		eraProcessActive := stakeManager.EraProcessData.NewActive
-
-		stakeAccount := stakeManager.EraProcessData.PendingStakeAccounts[0]
-		stakeAccountInfo, err := task.client.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
-		if err != nil {
-			return err
+		if !lookupTablesLoaded {
+			lookupTables, err = task.eraLookupTables(stakeManagerAddr, stakeManager)
+			if err != nil {
+				logrus.Warnf("lookup table of stakeManager %s not usable: %s, send legacy txs", stakeManagerAddr.ToBase58(), err)
+			}
+			lookupTablesLoaded = true
 		}
 
-		res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-			Commitment: client.CommitmentConfirmed,
-		})
-		if err != nil {
-			fmt.Printf("get recent block hash error, err: %v\n", err)
+		pending := stakeManager.EraProcessData.PendingStakeAccounts
+		batches := task.updateActiveBatches(stakeManagerAddr, lookupTables, pending)
+		errs := task.sendUpdateActiveBatches(stakeManagerAddr, stakeManager.LatestEra, lookupTables, batches)
+		if task.cfg.DryRun {
+			// nothing changed on chain, the same pending stake accounts would come again
+			for _, err := range errs {
+				if err != nil {
+					return err
+				}
+			}
+			return nil
 		}
-		rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-			Instructions: []types.Instruction{
-				lsdprog.EraUpdateActive(
-					task.lsdProgramID,
-					stakeManagerAddr,
-					stakeAccount,
-				),
-			},
-			Signers:         []types.Account{task.feePayerAccount},
-			FeePayer:        task.feePayerAccount.PublicKey,
-			RecentBlockHash: res.Blockhash,
-		})
 
+		stakeManagerNew, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if err != nil {
-			fmt.Printf("generate tx error, err: %v\n", err)
+			return err
 		}
-		txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
-		if err != nil {
-			fmt.Printf("send tx error, err: %v\n", err)
+		if eraProcessPhase(&stakeManagerNew.EraProcessData) != EraPhaseUpdateActive {
+			logrus.Info("EraUpdateActive success")
+			return nil
 		}
-
-		logrus.Infof("EraUpdateActive send tx hash: %s, stakeAccount: %s, stakeAccoutActive: %d, eraSnapshotActive: %d, eraProcessActive(old): %d, eraProcessActive(new): %d",
-			txHash, stakeAccount.ToBase58(), stakeAccountInfo.StakeAccount.Info.Stake.Delegation.Stake, eraActive, eraProcessActive, int64(eraProcessActive)+stakeAccountInfo.StakeAccount.Info.Stake.Delegation.Stake)
-
-		if err := task.waitTx(txHash); err != nil {
-			stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
-			if errInside != nil {
-				return errInside
-			}
-			if !needUpdateActive(&stakeManagerNew.EraProcessData) {
-				logrus.Info("EraUpdateActive success")
-				return nil
+		stillPending := make(map[common.PublicKey]bool)
+		for _, stakeAccount := range stakeManagerNew.EraProcessData.PendingStakeAccounts {
+			stillPending[stakeAccount] = true
+		}
+		// a failed batch may have landed after all, it only fails the handler if its accounts are still pending
+		for i, batch := range batches {
+			if errs[i] == nil {
+				continue
 			}
-			if stakeManagerNew.EraProcessData.PendingStakeAccounts[0] != stakeAccount {
-				logrus.Info("EraUpdateActive success")
+			for _, stakeAccount := range batch {
+				if stillPending[stakeAccount] {
+					return errs[i]
+				}
 			}
+		}
+		if len(stillPending) >= len(pending) {
+			return fmt.Errorf("EraUpdateActive of %d pending stake accounts made no progress", len(pending))
+		}
+		logrus.Infof("EraUpdateActive %d of %d pending stake accounts updated", len(pending)-len(stillPending), len(pending))
+	}
+}
+
+// updateActiveBatches packs the pending stake accounts into batches of BatchSize, or as many as the tx size
+// and compute limits allow
+func (task *Task) updateActiveBatches(stakeManagerAddr common.PublicKey, lookupTables []versionedtx.LookupTableAccount, pending []common.PublicKey) [][]common.PublicKey {
+	maxBatch := task.maxBatch(updateActiveComputeUnits)
+	if task.cfg.UpdateActive.BatchSize > 0 && task.cfg.UpdateActive.BatchSize < uint64(maxBatch) {
+		maxBatch = int(task.cfg.UpdateActive.BatchSize)
+	}
+
+	batches := make([][]common.PublicKey, 0)
+	start := 0
+	for _, size := range task.batchInstructions(lookupTables, task.updateActiveInstructions(stakeManagerAddr, pending), maxBatch) {
+		batches = append(batches, pending[start:start+size])
+		start += size
+	}
+	return batches
+}
+
+func (task *Task) updateActiveInstructions(stakeManagerAddr common.PublicKey, stakeAccounts []common.PublicKey) []types.Instruction {
+	instructions := make([]types.Instruction, 0, len(stakeAccounts))
+	for _, stakeAccount := range stakeAccounts {
+		instructions = append(instructions, lsdprog.EraUpdateActive(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			stakeAccount,
+		))
+	}
+	return instructions
+}
+
+// sendUpdateActiveBatches sends a tx for each batch, Parallel at a time, and returns the error of each
+func (task *Task) sendUpdateActiveBatches(stakeManagerAddr common.PublicKey, era uint64, lookupTables []versionedtx.LookupTableAccount, batches [][]common.PublicKey) []error {
+	parallel := task.cfg.UpdateActive.Parallel
+	if parallel == 0 {
+		parallel = defaultUpdateActiveParallel
+	}
+
+	errs := make([]error, len(batches))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int, batch []common.PublicKey) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = task.sendUpdateActive(stakeManagerAddr, era, lookupTables, batch)
+		}(i, batch)
+	}
+	wg.Wait()
+	return errs
+}
+
+func (task *Task) sendUpdateActive(stakeManagerAddr common.PublicKey, era uint64, lookupTables []versionedtx.LookupTableAccount, batch []common.PublicKey) error {
+	batchActive := int64(0)
+	for _, stakeAccount := range batch {
+		stakeAccountInfo, err := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		if err != nil {
 			return err
 		}
+		batchActive += stakeAccountInfo.StakeAccount.Info.Stake.Delegation.Stake
+	}
 
-		logrus.Info("EraUpdateActive success")
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraUpdateActive", era: era, lookupTables: lookupTables},
+		task.updateActiveInstructions(stakeManagerAddr, batch))
+	if err != nil {
+		return err
 	}
+
+	logrus.Infof("EraUpdateActive send tx hash: %s, stakeAccounts: %d, first stakeAccount: %s, stakeAccountsActive: %d",
+		result.Signature, len(batch), batch[0].ToBase58(), batchActive)
+	return result.Err()
 }
@@ -0,0 +1,173 @@
+package task
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/mockrpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+// addStakeAccounts gives the stake manager of env n more active stake accounts of 1 SOL
+func addStakeAccounts(env *testEnv, n int) {
+	stakeAccounts := make([]common.PublicKey, 0, n)
+	for i := 0; i < n; i++ {
+		stakeAccount := types.NewAccount().PublicKey
+		env.server.AddStakeAccount(stakeAccount, mockrpc.StakeAccount{
+			Voter:             env.validator,
+			Stake:             1e9,
+			DeactivationEpoch: math.MaxUint64,
+		})
+		stakeAccounts = append(stakeAccounts, stakeAccount)
+	}
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) {
+		sm.StakeAccounts = append(sm.StakeAccounts, stakeAccounts...)
+		sm.Active += uint64(n) * 1e9
+	})
+}
+
+func countUpdateActive(instructions []string) int {
+	count := 0
+	for _, instruction := range instructions {
+		if instruction == "era_update_active" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestEraUpdateActiveBatched(t *testing.T) {
+	env := newTestEnv(t)
+	stateStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+	addStakeAccounts(env, 40)
+
+	env.handleEra(t)
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if got := countUpdateActive(env.server.Instructions()); got != 41 {
+		t.Fatalf("era_update_active landed: %d, want: 41", got)
+	}
+	if sm.Active != 50e9 {
+		t.Fatalf("active: %d", sm.Active)
+	}
+
+	state, err := stateStore.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	txs := 0
+	for _, tx := range state.Txs {
+		if tx.Handler == "EraUpdateActive" {
+			txs++
+		}
+	}
+	// bounded by the tx size, not by the compute limit
+	if txs < 2 || txs > 4 {
+		t.Fatalf("EraUpdateActive txs: %d", txs)
+	}
+}
+
+func TestEraUpdateActiveBatchFailed(t *testing.T) {
+	env := newTestEnv(t)
+	env.task.cfg.UpdateActive.BatchSize = 4
+	addStakeAccounts(env, 11)
+
+	// one of the three batches fails, the others land
+	env.server.FailNext("era_update_active", 1)
+	if err := env.task.handleEra(nil); err == nil {
+		t.Fatal("handleEra succeeded with a failed batch")
+	}
+	if got := countUpdateActive(env.server.Instructions()); got != 8 {
+		t.Fatalf("era_update_active landed: %d, want: 8", got)
+	}
+	sm := env.server.StakeManager(env.stakeManager)
+	if len(sm.EraProcessData.PendingStakeAccounts) != 4 {
+		t.Fatalf("pending stake accounts: %d", len(sm.EraProcessData.PendingStakeAccounts))
+	}
+
+	env.handleEra(t)
+	sm = env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if got := countUpdateActive(env.server.Instructions()); got != 12 {
+		t.Fatalf("era_update_active landed: %d, want: 12", got)
+	}
+}
+
+func TestEraUpdateActiveLookupTable(t *testing.T) {
+	env := newTestEnv(t)
+	stateStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+	env.task.cfg.LookupTable = true
+	addStakeAccounts(env, 100)
+
+	updateActiveTxs := func() int {
+		state, err := stateStore.Load(env.stakeManager.ToBase58())
+		if err != nil {
+			t.Fatal(err)
+		}
+		txs := 0
+		for _, tx := range state.Txs {
+			if tx.Handler == "EraUpdateActive" {
+				txs++
+			}
+		}
+		return txs
+	}
+	assertTableHolds := func(sm *lsdprog.StakeManager) {
+		state, err := stateStore.Load(env.stakeManager.ToBase58())
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses, exist := env.server.LookupTable(common.PublicKeyFromString(state.LookupTable))
+		if !exist {
+			t.Fatalf("lookup table %q not created", state.LookupTable)
+		}
+		held := make(map[common.PublicKey]bool)
+		for _, address := range addresses {
+			held[address] = true
+		}
+		for _, stakeAccount := range sm.StakeAccounts {
+			if !held[stakeAccount] {
+				t.Fatalf("stake account %s not in the lookup table", stakeAccount.ToBase58())
+			}
+		}
+	}
+
+	// 101 instructions fit in two v0 txs, bounded by the compute limit
+	env.handleEra(t)
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if got := countUpdateActive(env.server.Instructions()); got != 101 {
+		t.Fatalf("era_update_active landed: %d, want: 101", got)
+	}
+	if txs := updateActiveTxs(); txs != 2 {
+		t.Fatalf("EraUpdateActive txs: %d", txs)
+	}
+	assertTableHolds(&sm)
+
+	// era 10 merged the stake accounts into one, the table is extended with the stake accounts added since
+	env.server.AdvanceEpoch(0)
+	addStakeAccounts(env, 5)
+	sm = env.server.StakeManager(env.stakeManager)
+	want := 101 + len(sm.StakeAccounts)
+	env.handleEra(t)
+	sm = env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 11)
+	if got := countUpdateActive(env.server.Instructions()); got != want {
+		t.Fatalf("era_update_active landed: %d, want: %d", got, want)
+	}
+	if txs := updateActiveTxs(); txs != 3 {
+		t.Fatalf("EraUpdateActive txs: %d", txs)
+	}
+	assertTableHolds(&sm)
+}
@@ -2,7 +2,6 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stafiprotocol/solana-go-sdk/assotokenprog"
@@ -13,15 +12,15 @@ import (
 )
 
 func (task *Task) EraUpdateRate(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
-	if !needUpdateRate(&stakeManager.EraProcessData) {
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseUpdateRate {
 		return nil
 	}
-	stackAccount, err := task.client.GetLsdStack(context.Background(), task.stackAccountPubkey.ToBase58())
+	stackAccount, err := task.client.Load().GetLsdStack(context.Background(), task.stackAccountPubkey.ToBase58())
 	if err != nil {
 		return err
 	}
@@ -38,7 +37,7 @@ func (task *Task) EraUpdateRate(stakeManagerAddr common.PublicKey) error {
 		return err
 	}
 
-	_, err = task.client.GetTokenAccountInfo(context.Background(), platformFeeRecipient.ToBase58())
+	_, err = task.client.Load().GetTokenAccountInfo(context.Background(), platformFeeRecipient.ToBase58())
 	if err != nil {
 		if err == client.ErrAccountNotFound {
 			instructions = append(instructions, assotokenprog.CreateAssociatedTokenAccount(
@@ -54,7 +53,7 @@ func (task *Task) EraUpdateRate(stakeManagerAddr common.PublicKey) error {
 	}
 
 	if platformFeeRecipient != stackFeeRecipient {
-		_, err = task.client.GetTokenAccountInfo(context.Background(), stackFeeRecipient.ToBase58())
+		_, err = task.client.Load().GetTokenAccountInfo(context.Background(), stackFeeRecipient.ToBase58())
 		if err != nil {
 			if err == client.ErrAccountNotFound {
 				instructions = append(instructions, assotokenprog.CreateAssociatedTokenAccount(
@@ -70,13 +69,6 @@ func (task *Task) EraUpdateRate(stakeManagerAddr common.PublicKey) error {
 		return err
 	}
 
-	res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-		Commitment: client.CommitmentConfirmed,
-	})
-	if err != nil {
-		fmt.Printf("get recent block hash error, err: %v\n", err)
-	}
-
 	lsdTokenMint := stakeManager.LsdTokenMint
 
 	instructions = append(instructions, lsdprog.EraUpdateRate(
@@ -90,40 +82,32 @@ func (task *Task) EraUpdateRate(stakeManagerAddr common.PublicKey) error {
 		stackFeeAccount,
 	))
 
-	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-		Instructions:    instructions,
-		Signers:         []types.Account{task.feePayerAccount},
-		FeePayer:        task.feePayerAccount.PublicKey,
-		RecentBlockHash: res.Blockhash,
-	})
-
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraUpdateRate", era: stakeManager.LatestEra}, instructions)
 	if err != nil {
-		fmt.Printf("generate tx error, err: %v\n", err)
-	}
-	txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
-	if err != nil {
-		fmt.Printf("send tx error, err: %v\n", err)
+		return err
 	}
 
 	logrus.Infof("EraUpdateRate send tx hash: %s, pipelineActive: %d, eraSnapshotActive: %d, eraProcessActive: %d, rate(old): %d",
-		txHash, stakeManager.Active, stakeManager.EraProcessData.OldActive, stakeManager.EraProcessData.NewActive, stakeManager.Rate)
-	if err := task.waitTx(txHash); err != nil {
-		stakeManagerNew, errInside := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+		result.Signature, stakeManager.Active, stakeManager.EraProcessData.OldActive, stakeManager.EraProcessData.NewActive, stakeManager.Rate)
+	if err := result.Err(); err != nil {
+		stakeManagerNew, errInside := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 		if errInside != nil {
 			return errInside
 		}
 
-		if !needUpdateRate(&stakeManagerNew.EraProcessData) {
+		if eraProcessPhase(&stakeManagerNew.EraProcessData) != EraPhaseUpdateRate {
 			logrus.Infof("EraUpdateRate success, rate(new): %d", stakeManagerNew.Rate)
+			task.checkRateChange(stakeManagerAddr.ToBase58(), stakeManager.Rate, stakeManagerNew.Rate)
 			return nil
 		}
 		return err
 	}
-	stakeManagerNew, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManagerNew, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
 	logrus.Infof("EraUpdateRate success, rate(new): %d", stakeManagerNew.Rate)
+	task.checkRateChange(stakeManagerAddr.ToBase58(), stakeManager.Rate, stakeManagerNew.Rate)
 	return nil
 }
@@ -2,7 +2,6 @@ package task
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stafiprotocol/solana-go-sdk/client"
@@ -11,15 +10,19 @@ import (
 	"github.com/stafiprotocol/solana-go-sdk/types"
 )
 
+const eraWithdrawComputeUnits = 30000 // an EraWithdraw instruction takes at most, with the stake program withdraw
+
+// EraWithdraw withdraws the inactive split accounts to the stake pool. The instructions are packed into as few txs as
+// fit, v0 txs with the lookup table of the stake manager if LookupTable is set.
 func (task *Task) EraWithdraw(stakeManagerAddr common.PublicKey) error {
-	stakeManager, err := task.client.GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
 	if err != nil {
 		return err
 	}
 
 	couldWithdrawAccount := make([]common.PublicKey, 0)
 	for _, account := range stakeManager.SplitAccounts {
-		accountInfo, err := task.client.GetStakeActivation(
+		accountInfo, err := task.client.Load().GetStakeActivation(
 			context.Background(),
 			account.ToBase58(),
 			client.GetStakeActivationConfig{})
@@ -39,52 +42,50 @@ func (task *Task) EraWithdraw(stakeManagerAddr common.PublicKey) error {
 		return err
 	}
 
+	lookupTables, err := task.eraLookupTables(stakeManagerAddr, stakeManager)
+	if err != nil {
+		logrus.Warnf("lookup table of stakeManager %s not usable: %s, send legacy txs", stakeManagerAddr.ToBase58(), err)
+	}
+	instructions := make([]types.Instruction, 0, len(couldWithdrawAccount))
 	for _, stakeAccount := range couldWithdrawAccount {
-		stakeAccountInfo, err := task.client.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
-		if err != nil {
-			return err
-		}
+		instructions = append(instructions, lsdprog.EraWithdraw(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			stakePool,
+			stakeAccount,
+		))
+	}
 
-		res, err := task.client.GetLatestBlockhash(context.Background(), client.GetLatestBlockhashConfig{
-			Commitment: client.CommitmentConfirmed,
-		})
-		if err != nil {
-			fmt.Printf("get recent block hash error, err: %v\n", err)
+	start := 0
+	for _, size := range task.batchInstructions(lookupTables, instructions, task.maxBatch(eraWithdrawComputeUnits)) {
+		batch := couldWithdrawAccount[start : start+size]
+		withdrawAmount := uint64(0)
+		for _, stakeAccount := range batch {
+			stakeAccountInfo, err := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+			if err != nil {
+				return err
+			}
+			withdrawAmount += stakeAccountInfo.Lamports
 		}
 
-		rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
-			Instructions: []types.Instruction{
-				lsdprog.EraWithdraw(
-					task.lsdProgramID,
-					stakeManagerAddr,
-					stakePool,
-					stakeAccount,
-				),
-			},
-			Signers:         []types.Account{task.feePayerAccount},
-			FeePayer:        task.feePayerAccount.PublicKey,
-			RecentBlockHash: res.Blockhash,
-		})
-
-		if err != nil {
-			fmt.Printf("generate tx error, err: %v\n", err)
-		}
-		txHash, err := task.client.SendRawTransaction(context.Background(), rawTx)
+		result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraWithdraw", era: stakeManager.LatestEra, lookupTables: lookupTables},
+			instructions[start:start+size])
+		start += size
 		if err != nil {
-			fmt.Printf("send tx error, err: %v\n", err)
+			return err
 		}
 
-		logrus.Infof("EraWithdraw send tx hash: %s, stakeAccount: %s, withdrawAmount: %d",
-			txHash, stakeAccount.ToBase58(), stakeAccountInfo.Lamports)
+		logrus.Infof("EraWithdraw send tx hash: %s, stakeAccounts: %d, first stakeAccount: %s, withdrawAmount: %d",
+			result.Signature, len(batch), batch[0].ToBase58(), withdrawAmount)
 
-		if err := task.waitTx(txHash); err != nil {
-			_, errInside := task.client.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
-			if errInside != nil && errInside == client.ErrAccountNotFound {
-				logrus.Info("EraWithdraw success")
-				return nil
+		if err := result.Err(); err != nil {
+			// a failed tx may have landed after all, it only fails the handler if one of its accounts is left
+			for _, stakeAccount := range batch {
+				_, errInside := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+				if errInside != client.ErrAccountNotFound {
+					return err
+				}
 			}
-
-			return err
 		}
 
 		logrus.Info("EraWithdraw success")
@@ -0,0 +1,211 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+const (
+	pollInterval         = 30 * time.Second // while websocket is down
+	fallbackPollInterval = 5 * time.Minute  // while websocket is up, in case a notification is missed
+	wsRedialInterval     = 10 * time.Second
+	epochCheckInterval   = 5 * time.Second
+)
+
+// eventTrigger collects stake managers to handle, signaled by websocket notifications.
+type eventTrigger struct {
+	mu      sync.Mutex
+	all     bool
+	targets map[common.PublicKey]bool
+	signal  chan struct{}
+}
+
+func newEventTrigger() *eventTrigger {
+	return &eventTrigger{
+		targets: make(map[common.PublicKey]bool),
+		signal:  make(chan struct{}, 1),
+	}
+}
+
+// fire marks one stake manager to handle, or all if stakeManager is nil
+func (e *eventTrigger) fire(stakeManager *common.PublicKey) {
+	e.mu.Lock()
+	if stakeManager == nil {
+		e.all = true
+	} else {
+		e.targets[*stakeManager] = true
+	}
+	e.mu.Unlock()
+
+	select {
+	case e.signal <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the stake managers fired since last take, nil means all
+func (e *eventTrigger) take() map[common.PublicKey]bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	targets := e.targets
+	all := e.all
+	e.targets = make(map[common.PublicKey]bool)
+	e.all = false
+	if all {
+		return nil
+	}
+	return targets
+}
+
+// waitEvent blocks until a notification or the poll interval, it returns false if the task stopped.
+func (task *Task) waitEvent() (map[common.PublicKey]bool, bool) {
+	interval := pollInterval
+	if task.wsAlive.Load() {
+		interval = fallbackPollInterval
+	}
+
+	select {
+	case <-task.stop:
+		return nil, false
+	case <-task.trigger.signal:
+		return task.trigger.take(), true
+	case <-time.After(interval):
+		task.trigger.take()
+		return nil, true
+	}
+}
+
+// watchEvents keeps a websocket subscription on the stack, the stake managers and slots,
+// and redials when the connection breaks. Handlers fall back to polling meanwhile.
+func (task *Task) watchEvents() {
+	for {
+		err := task.subscribeEvents()
+		task.wsAlive.Store(false)
+		select {
+		case <-task.stop:
+			return
+		default:
+		}
+		if err == nil {
+			// stack changed, subscribe again with the new entrusted stake managers
+			continue
+		}
+		logrus.Warnf("websocket subscription broken: %v, will redial", err)
+		// handle everything, notifications may be lost while down
+		task.trigger.fire(nil)
+
+		select {
+		case <-task.stop:
+			return
+		case <-time.After(wsRedialInterval):
+		}
+	}
+}
+
+func (task *Task) subscribeEvents() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wsClient, err := rpc.DialWs(ctx, task.wsEndpoint)
+	if err != nil {
+		return err
+	}
+	defer wsClient.Close()
+
+	stakeManagers := []common.PublicKey{task.stakeManagerPubkey}
+	var stackSub *rpc.Subscription
+	if task.entrustedMode {
+		stackAccount, err := task.client.Load().GetLsdStack(ctx, task.stackAccountPubkey.ToBase58())
+		if err != nil {
+			return err
+		}
+		stakeManagers = stackAccount.EntrustedStakeManagers
+
+		stackSub, err = wsClient.AccountSubscribe(ctx, task.stackAccountPubkey.ToBase58(), string(client.CommitmentFinalized))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, stakeManager := range stakeManagers {
+		sub, err := wsClient.AccountSubscribe(ctx, stakeManager.ToBase58(), string(client.CommitmentFinalized))
+		if err != nil {
+			return err
+		}
+		stakeManager := stakeManager
+		go func() {
+			for range sub.C {
+				logrus.Debugf("stakeManager %s changed", stakeManager.ToBase58())
+				task.trigger.fire(&stakeManager)
+			}
+		}()
+	}
+
+	epochInfo, err := task.client.Load().GetEpochInfo(ctx, client.CommitmentFinalized)
+	if err != nil {
+		return err
+	}
+	nextEpochSlot := uint64(epochInfo.AbsoluteSlot-epochInfo.SlotIndex) + uint64(epochInfo.SlotsInEpoch)
+	slotSub, err := wsClient.SlotSubscribe(ctx)
+	if err != nil {
+		return err
+	}
+
+	task.wsAlive.Store(true)
+	logrus.Infof("websocket subscribed, stakeManagers: %d, next epoch slot: %d", len(stakeManagers), nextEpochSlot)
+
+	var stackC <-chan json.RawMessage // nil channel blocks forever in single stake manager mode
+	if stackSub != nil {
+		stackC = stackSub.C
+	}
+	lastEpochCheck := time.Time{}
+	for {
+		select {
+		case <-task.stop:
+			return nil
+		case <-wsClient.Done():
+			return wsClient.Err()
+		case _, ok := <-stackC:
+			if !ok {
+				return wsClient.Err()
+			}
+			// entrusted stake managers may change, subscribe again
+			logrus.Debug("stack changed")
+			task.trigger.fire(nil)
+			return nil
+		case msg, ok := <-slotSub.C:
+			if !ok {
+				return wsClient.Err()
+			}
+			slot := rpc.SlotNotification{}
+			if err := json.Unmarshal(msg, &slot); err != nil {
+				continue
+			}
+			// finalized epoch switches some slots after the first slot of the epoch, check at most once per epochCheckInterval
+			if slot.Slot < nextEpochSlot || time.Since(lastEpochCheck) < epochCheckInterval {
+				continue
+			}
+			lastEpochCheck = time.Now()
+
+			epochInfo, err := task.client.Load().GetEpochInfo(ctx, client.CommitmentFinalized)
+			if err != nil {
+				return err
+			}
+			newNextEpochSlot := uint64(epochInfo.AbsoluteSlot-epochInfo.SlotIndex) + uint64(epochInfo.SlotsInEpoch)
+			if newNextEpochSlot == nextEpochSlot {
+				continue
+			}
+			nextEpochSlot = newNextEpochSlot
+			logrus.Infof("new epoch %d", epochInfo.Epoch)
+			task.trigger.fire(nil)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+)
+
+const (
+	defaultMaxEraLag   = 1
+	defaultMaxPassAge  = 1800 // seconds
+	defaultMaxPhaseAge = 3600 // seconds
+)
+
+// healthState keeps what handling passes observed, for /healthz and /readyz
+type healthState struct {
+	mu              sync.Mutex
+	startTime       time.Time
+	lastPass        time.Time                        // zero before the first successful pass, single stake manager mode
+	workerPasses    map[common.PublicKey]*workerPass // entrusted mode, kept by the workers
+	epoch           uint64
+	latestEras      map[common.PublicKey]uint64
+	eraStates       map[common.PublicKey]*trackedEraState
+	halted          map[common.PublicKey]string // halt reasons, see Task.halt
+	feePayerBalance uint64
+	balanceKnown    bool
+}
+
+func newHealthState() *healthState {
+	return &healthState{
+		startTime:    time.Now(),
+		latestEras:   make(map[common.PublicKey]uint64),
+		eraStates:    make(map[common.PublicKey]*trackedEraState),
+		workerPasses: make(map[common.PublicKey]*workerPass),
+		halted:       make(map[common.PublicKey]string),
+	}
+}
+
+// workerPass is the handling outcome of an entrusted stake manager
+type workerPass struct {
+	since    time.Time // first outcome
+	lastPass time.Time // zero before the first successful pass
+}
+
+func (h *healthState) passed() {
+	h.mu.Lock()
+	h.lastPass = time.Now()
+	h.mu.Unlock()
+}
+
+// workerDone records the outcome of a worker handling an entrusted stake manager
+func (h *healthState) workerDone(stakeManager common.PublicKey, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	pass, exist := h.workerPasses[stakeManager]
+	if !exist {
+		pass = &workerPass{since: time.Now()}
+		h.workerPasses[stakeManager] = pass
+	}
+	if err == nil {
+		pass.lastPass = time.Now()
+	}
+}
+
+func (h *healthState) setHalted(stakeManager common.PublicKey, reason string) {
+	h.mu.Lock()
+	h.halted[stakeManager] = reason
+	h.mu.Unlock()
+}
+
+func (h *healthState) setLatestEra(stakeManager common.PublicKey, latestEra uint64) {
+	h.mu.Lock()
+	h.latestEras[stakeManager] = latestEra
+	h.mu.Unlock()
+}
+
+// keepStakeManagers drops stake managers no longer entrusted
+func (h *healthState) keepStakeManagers(stakeManagers []common.PublicKey) {
+	keep := make(map[common.PublicKey]bool, len(stakeManagers))
+	for _, stakeManager := range stakeManagers {
+		keep[stakeManager] = true
+	}
+	h.mu.Lock()
+	for stakeManager := range h.latestEras {
+		if !keep[stakeManager] {
+			delete(h.latestEras, stakeManager)
+		}
+	}
+	for stakeManager := range h.eraStates {
+		if !keep[stakeManager] {
+			delete(h.eraStates, stakeManager)
+		}
+	}
+	for stakeManager := range h.workerPasses {
+		if !keep[stakeManager] {
+			delete(h.workerPasses, stakeManager)
+		}
+	}
+	for stakeManager := range h.halted {
+		if !keep[stakeManager] {
+			delete(h.halted, stakeManager)
+		}
+	}
+	h.mu.Unlock()
+}
+
+type trackedEraState struct {
+	EraState
+	StakeManager string    `json:"stakeManager"`
+	Since        time.Time `json:"since"` // since when the stake manager made no progress
+
+	stuckReported bool
+}
+
+// observeEraState records the era state of a stake manager. It returns how long the stake manager made
+// no progress, and true the first time that goes over maxPhaseAge outside the idle phase.
+func (h *healthState) observeEraState(stakeManager common.PublicKey, state EraState, maxPhaseAge time.Duration) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tracked, exist := h.eraStates[stakeManager]
+	if !exist || !tracked.sameProgress(&state) {
+		tracked = &trackedEraState{StakeManager: stakeManager.ToBase58(), Since: time.Now()}
+		h.eraStates[stakeManager] = tracked
+	}
+	tracked.EraState = state
+
+	age := time.Since(tracked.Since)
+	if state.Phase == EraPhaseIdle || age <= maxPhaseAge || tracked.stuckReported {
+		return age, false
+	}
+	tracked.stuckReported = true
+	return age, true
+}
+
+func (h *healthState) eraStateList() []trackedEraState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := make([]trackedEraState, 0, len(h.eraStates))
+	for _, tracked := range h.eraStates {
+		list = append(list, *tracked)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].StakeManager < list[j].StakeManager })
+	return list
+}
+
+func (h *healthState) setEpoch(epoch uint64) {
+	h.mu.Lock()
+	h.epoch = epoch
+	h.mu.Unlock()
+}
+
+func (h *healthState) setFeePayerBalance(balance uint64) {
+	h.mu.Lock()
+	h.feePayerBalance = balance
+	h.balanceKnown = true
+	h.mu.Unlock()
+}
+
+// check returns the failed checks. Liveness covers what a restart may fix: a stuck handler, lagging eras or a
+// halted stake manager, readiness adds the first pass and the fee payer balance.
+func (h *healthState) check(maxEraLag, maxPassAge, minBalance uint64, maxPhaseAge time.Duration, readiness bool) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	failures := make([]string, 0)
+	maxAge := time.Duration(maxPassAge) * time.Second
+	if len(h.workerPasses) == 0 {
+		lastPass := h.lastPass
+		if lastPass.IsZero() {
+			if readiness {
+				failures = append(failures, "no successful handling pass yet")
+			}
+			lastPass = h.startTime
+		}
+		if age := time.Since(lastPass); age > maxAge {
+			failures = append(failures, fmt.Sprintf("last successful handling pass %s ago", age.Truncate(time.Second)))
+		}
+	}
+	// in entrusted mode every stake manager has to pass, one failing worker is not hidden by the others
+	for stakeManager, pass := range h.workerPasses {
+		lastPass := pass.lastPass
+		if lastPass.IsZero() {
+			if readiness {
+				failures = append(failures, fmt.Sprintf("stakeManager %s no successful handling pass yet", stakeManager.ToBase58()))
+			}
+			lastPass = pass.since
+		}
+		if age := time.Since(lastPass); age > maxAge {
+			failures = append(failures, fmt.Sprintf("stakeManager %s last successful handling pass %s ago", stakeManager.ToBase58(), age.Truncate(time.Second)))
+		}
+	}
+
+	// a halted stake manager passes without handling anything, its passes tell nothing
+	for stakeManager, reason := range h.halted {
+		failures = append(failures, fmt.Sprintf("stakeManager %s halted: %s", stakeManager.ToBase58(), reason))
+	}
+
+	for stakeManager, latestEra := range h.latestEras {
+		if h.epoch > latestEra && h.epoch-latestEra > maxEraLag {
+			failures = append(failures, fmt.Sprintf("stakeManager %s latestEra %d lags epoch %d", stakeManager.ToBase58(), latestEra, h.epoch))
+		}
+	}
+
+	for _, tracked := range h.eraStates {
+		if age := time.Since(tracked.Since); tracked.Phase != EraPhaseIdle && age > maxPhaseAge {
+			failures = append(failures, fmt.Sprintf("stakeManager %s stuck in era %d phase %s for %s: %s",
+				tracked.StakeManager, tracked.Era, tracked.Phase, age.Truncate(time.Second), tracked.Reason))
+		}
+	}
+
+	if readiness && minBalance > 0 && h.balanceKnown && h.feePayerBalance < minBalance {
+		failures = append(failures, fmt.Sprintf("fee payer balance %d below %d", h.feePayerBalance, minBalance))
+	}
+	return failures
+}
+
+type healthResponse struct {
+	Status   string   `json:"status"`
+	Failures []string `json:"failures,omitempty"`
+}
+
+func (task *Task) healthHandler(readiness bool) http.HandlerFunc {
+	maxEraLag := task.cfg.Health.MaxEraLag
+	if maxEraLag == 0 {
+		maxEraLag = defaultMaxEraLag
+	}
+	maxPassAge := task.cfg.Health.MaxPassAge
+	if maxPassAge == 0 {
+		maxPassAge = defaultMaxPassAge
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		failures := task.health.check(maxEraLag, maxPassAge, task.cfg.Health.MinFeePayerBalance, task.maxPhaseAge(), readiness)
+		res := healthResponse{Status: "ok", Failures: failures}
+		w.Header().Set("Content-Type", "application/json")
+		if len(failures) > 0 {
+			res.Status = "unhealthy"
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// eraStateHandler serves the era state of every stake manager handled, for inspection
+func (task *Task) eraStateHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(task.health.eraStateList())
+	}
+}
+
+func (task *Task) maxPhaseAge() time.Duration {
+	maxPhaseAge := task.cfg.Health.MaxPhaseAge
+	if maxPhaseAge == 0 {
+		maxPhaseAge = defaultMaxPhaseAge
+	}
+	return time.Duration(maxPhaseAge) * time.Second
+}
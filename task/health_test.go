@@ -0,0 +1,40 @@
+package task
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+func TestHealthFromWorkers(t *testing.T) {
+	h := newHealthState()
+	passing := types.NewAccount().PublicKey
+	failing := types.NewAccount().PublicKey
+
+	h.workerDone(passing, nil)
+	h.workerDone(failing, errors.New("handle failed"))
+	failures := h.check(1, 1800, 0, time.Hour, true)
+	if len(failures) != 1 || !strings.Contains(failures[0], failing.ToBase58()+" no successful handling pass yet") {
+		t.Fatalf("readiness failures: %v", failures)
+	}
+	if failures := h.check(1, 1800, 0, time.Hour, false); len(failures) != 0 {
+		t.Fatalf("liveness failures: %v", failures)
+	}
+
+	// one worker failing for long is unhealthy, whatever the others do
+	h.workerPasses[failing].since = time.Now().Add(-time.Hour)
+	h.workerDone(passing, nil)
+	h.workerDone(failing, errors.New("handle failed"))
+	failures = h.check(1, 1800, 0, time.Hour, false)
+	if len(failures) != 1 || !strings.Contains(failures[0], failing.ToBase58()+" last successful handling pass") {
+		t.Fatalf("liveness failures: %v", failures)
+	}
+
+	h.workerDone(failing, nil)
+	if failures := h.check(1, 1800, 0, time.Hour, true); len(failures) != 0 {
+		t.Fatalf("failures after pass: %v", failures)
+	}
+}
@@ -0,0 +1,165 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/lookuptable"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
+)
+
+const lookupTableExtendBatch = 20 // addresses appended per tx
+
+// eraLookupTables returns the lookup table batched era txs of the stake manager are sent with, nil if LookupTable
+// is off. The table is created when missing and extended with the stake accounts it does not hold yet.
+func (task *Task) eraLookupTables(stakeManagerAddr common.PublicKey, stakeManager *lsdprog.StakeManager) ([]versionedtx.LookupTableAccount, error) {
+	if !task.cfg.LookupTable {
+		return nil, nil
+	}
+	stakePool, _, err := common.FindProgramAddress([][]byte{stakeManagerAddr.Bytes(), stakePoolSeed}, task.lsdProgramID)
+	if err != nil {
+		return nil, err
+	}
+	wanted := []common.PublicKey{
+		task.lsdProgramID,
+		stakePool,
+		stakeManagerAddr,
+		task.stackAccountPubkey,
+		stakeManager.LsdTokenMint,
+		common.SysVarClockPubkey,
+		common.SysVarStakeHistoryPubkey,
+		common.StakeProgramID,
+	}
+	wanted = append(wanted, stakeManager.StakeAccounts...)
+	wanted = append(wanted, stakeManager.SplitAccounts...)
+
+	tableAddr := task.loadLookupTable(stakeManagerAddr)
+	table := lookuptable.LookupTable{}
+	if tableAddr != (common.PublicKey{}) {
+		table, err = task.rpcClient.GetAddressLookupTable(context.Background(), tableAddr.ToBase58())
+		switch {
+		case errors.Is(err, rpc.ErrLookupTableNotFound):
+			logrus.Warnf("lookup table %s of stakeManager %s not found, will create one", tableAddr.ToBase58(), stakeManagerAddr.ToBase58())
+			tableAddr = common.PublicKey{}
+		case err != nil:
+			return nil, err
+		case table.DeactivationSlot != math.MaxUint64 || table.Authority == nil || *table.Authority != task.feePayerAccount.PublicKey:
+			logrus.Warnf("lookup table %s of stakeManager %s can not be extended, will create one", tableAddr.ToBase58(), stakeManagerAddr.ToBase58())
+			tableAddr = common.PublicKey{}
+		}
+	}
+	if tableAddr == (common.PublicKey{}) && task.cfg.DryRun {
+		// creating a table is not simulated, a dry run sends legacy txs
+		return nil, nil
+	}
+
+	held := make(map[common.PublicKey]bool, len(table.Addresses))
+	for _, address := range table.Addresses {
+		held[address] = true
+	}
+	missing := make([]common.PublicKey, 0)
+	for _, address := range wanted {
+		if !held[address] {
+			held[address] = true
+			missing = append(missing, address)
+		}
+	}
+	if room := lookuptable.MaxAddresses - len(table.Addresses); len(missing) > room {
+		logrus.Warnf("lookup table of stakeManager %s is full, %d accounts left out", stakeManagerAddr.ToBase58(), len(missing)-room)
+		missing = missing[:room]
+	}
+	if task.cfg.DryRun || len(missing) == 0 {
+		return []versionedtx.LookupTableAccount{{Key: tableAddr, Addresses: table.Addresses}}, nil
+	}
+
+	instructions := make([]types.Instruction, 0, 2)
+	created := false
+	if tableAddr == (common.PublicKey{}) {
+		// the slot has to be one the runtime still keeps a hash of
+		slot, err := task.client.Load().GetSlot(context.Background(), client.GetSlotConfig{Commitment: client.CommitmentFinalized})
+		if err != nil {
+			return nil, err
+		}
+		var bump uint8
+		tableAddr, bump, err = lookuptable.DeriveLookupTableAddress(task.feePayerAccount.PublicKey, slot)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, lookuptable.CreateLookupTable(tableAddr, task.feePayerAccount.PublicKey,
+			task.feePayerAccount.PublicKey, slot, bump))
+		created = true
+	}
+	for start := 0; start < len(missing); start += lookupTableExtendBatch {
+		end := start + lookupTableExtendBatch
+		if end > len(missing) {
+			end = len(missing)
+		}
+		instructions = append(instructions, lookuptable.ExtendLookupTable(tableAddr, task.feePayerAccount.PublicKey,
+			task.feePayerAccount.PublicKey, missing[start:end]))
+
+		result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "LookupTable", era: stakeManager.LatestEra}, instructions)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("LookupTable send tx hash: %s, lookupTable: %s, extended: %d", result.Signature, tableAddr.ToBase58(), end-start)
+		if err := result.Err(); err != nil {
+			return nil, err
+		}
+		if created {
+			task.saveLookupTable(stakeManagerAddr, tableAddr)
+			created = false
+		}
+		instructions = instructions[:0]
+	}
+
+	table, err = task.rpcClient.GetAddressLookupTable(context.Background(), tableAddr.ToBase58())
+	if err != nil {
+		return nil, fmt.Errorf("read lookup table %s failed: %w", tableAddr.ToBase58(), err)
+	}
+	return []versionedtx.LookupTableAccount{{Key: tableAddr, Addresses: table.Addresses}}, nil
+}
+
+// loadLookupTable returns the lookup table kept for the stake manager, in the state store to survive restarts if enabled
+func (task *Task) loadLookupTable(stakeManagerAddr common.PublicKey) common.PublicKey {
+	if task.store == nil {
+		task.lookupTablesMu.Lock()
+		defer task.lookupTablesMu.Unlock()
+		return task.lookupTables[stakeManagerAddr]
+	}
+	state, err := task.store.Load(stakeManagerAddr.ToBase58())
+	if err != nil {
+		logrus.Warnf("load state of stakeManager %s failed: %s", stakeManagerAddr.ToBase58(), err)
+	}
+	if len(state.LookupTable) == 0 {
+		return common.PublicKey{}
+	}
+	return common.PublicKeyFromString(state.LookupTable)
+}
+
+func (task *Task) saveLookupTable(stakeManagerAddr, tableAddr common.PublicKey) {
+	if task.store == nil {
+		task.lookupTablesMu.Lock()
+		defer task.lookupTablesMu.Unlock()
+		if task.lookupTables == nil {
+			task.lookupTables = make(map[common.PublicKey]common.PublicKey)
+		}
+		task.lookupTables[stakeManagerAddr] = tableAddr
+		return
+	}
+	task.updateProgress(stakeManagerAddr, func(state *store.StakeManagerState) bool {
+		if state.LookupTable == tableAddr.ToBase58() {
+			return false
+		}
+		state.LookupTable = tableAddr.ToBase58()
+		return true
+	})
+}
@@ -0,0 +1,47 @@
+package task
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+)
+
+// recordStakeManagerStatus sets the stake manager gauges and health after a handling pass.
+// It is skipped without a http server, to save the rpc requests.
+func (task *Task) recordStakeManagerStatus(stakeManagerAddr common.PublicKey) {
+	if len(task.cfg.HttpListenAddress) == 0 {
+		return
+	}
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	if err != nil {
+		logrus.Debugf("record metrics of stakeManager %s failed: %s", stakeManagerAddr.ToBase58(), err)
+		return
+	}
+
+	task.health.setLatestEra(stakeManagerAddr, stakeManager.LatestEra)
+	label := stakeManagerAddr.ToBase58()
+	metrics.LatestEra.WithLabelValues(label).Set(float64(stakeManager.LatestEra))
+	metrics.Active.WithLabelValues(label).Set(float64(stakeManager.Active))
+	metrics.Rate.WithLabelValues(label).Set(float64(stakeManager.Rate))
+	metrics.NeedBond.WithLabelValues(label).Set(float64(stakeManager.EraProcessData.NeedBond))
+	metrics.NeedUnbond.WithLabelValues(label).Set(float64(stakeManager.EraProcessData.NeedUnbond))
+	metrics.PendingStakeAccounts.WithLabelValues(label).Set(float64(len(stakeManager.EraProcessData.PendingStakeAccounts)))
+	metrics.SplitAccounts.WithLabelValues(label).Set(float64(len(stakeManager.SplitAccounts)))
+}
+
+// recordStatus sets the epoch gauge and health, the fee payer balance is recorded by watchBalance
+func (task *Task) recordStatus() {
+	if len(task.cfg.HttpListenAddress) == 0 {
+		return
+	}
+	epochInfo, err := task.client.Load().GetEpochInfo(context.Background(), client.CommitmentFinalized)
+	if err != nil {
+		logrus.Debugf("record metrics of epoch failed: %s", err)
+	} else {
+		metrics.CurrentEpoch.Set(float64(epochInfo.Epoch))
+		task.health.setEpoch(uint64(epochInfo.Epoch))
+	}
+}
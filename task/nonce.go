@@ -0,0 +1,111 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/sysprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+)
+
+const (
+	defaultNonceTimeout   = 2 * time.Minute
+	nonceRebroadcastPolls = 10 // polls between rebroadcasts of a nonce tx not seen yet
+)
+
+// UseNonceAccounts makes txs use the durable nonce of one of the accounts instead of a recent blockhash, so a tx
+// stays valid until it lands or its nonce is advanced. The accounts must be nonce accounts of the fee payer.
+// A tx holds its account until it is resolved, so the accounts also bound the txs sent at once.
+func (s *TxSender) UseNonceAccounts(ctx context.Context, accounts []string) error {
+	if len(accounts) == 0 {
+		s.nonces = nil
+		return nil
+	}
+	nonces := make(chan common.PublicKey, len(accounts))
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		if seen[account] {
+			return fmt.Errorf("nonce account %s duplicated", account)
+		}
+		seen[account] = true
+		nonceAccount, err := s.rpcClient.GetNonceAccount(ctx, account)
+		if err != nil {
+			return fmt.Errorf("get nonce account %s failed: %w", account, err)
+		}
+		if nonceAccount.AuthorizedPubkey != s.feePayer.PublicKey {
+			return fmt.Errorf("nonce account %s authority %s is not the fee payer", account, nonceAccount.AuthorizedPubkey.ToBase58())
+		}
+		nonces <- common.PublicKeyFromString(account)
+	}
+	s.nonces = nonces
+	return nil
+}
+
+// acquireNonce takes a nonce account off the pool, waiting while all of them are held by other txs.
+// It returns the zero key if txs use a recent blockhash.
+func (s *TxSender) acquireNonce(ctx context.Context) (common.PublicKey, error) {
+	if s.nonces == nil {
+		return common.PublicKey{}, nil
+	}
+	select {
+	case <-ctx.Done():
+		return common.PublicKey{}, ctx.Err()
+	case nonceAccount := <-s.nonces:
+		return nonceAccount, nil
+	}
+}
+
+func (s *TxSender) releaseNonce(nonceAccount common.PublicKey) {
+	if s.nonces != nil && nonceAccount != (common.PublicKey{}) {
+		s.nonces <- nonceAccount
+	}
+}
+
+// expired tells whether a sent tx can no longer land: the block height passed the last valid one of its blockhash,
+// or its nonce was advanced, by the tx itself landing or by another tx.
+func (s *TxSender) expired(ctx context.Context, sent sentTx) (bool, error) {
+	if len(sent.nonceAccount) > 0 {
+		nonceAccount, err := s.rpcClient.GetNonceAccount(ctx, sent.nonceAccount)
+		if err != nil {
+			return false, err
+		}
+		return nonceAccount.Nonce.ToBase58() != sent.nonce, nil
+	}
+	blockHeight, err := s.client.Load().GetBlockHeight(ctx, client.GetBlockHeightConfig{Commitment: client.CommitmentConfirmed})
+	if err != nil {
+		return false, err
+	}
+	return blockHeight > sent.lastValidBlockHeight, nil
+}
+
+// invalidateNonce advances the nonce in a tx of its own, built with a recent blockhash, so a tx sent with the
+// current nonce can never land. It does not wait, the nonce moving tells the tx landed.
+func (s *TxSender) invalidateNonce(ctx context.Context, nonceAccount string) (string, error) {
+	res, err := s.client.Load().GetLatestBlockhash(ctx, client.GetLatestBlockhashConfig{
+		Commitment: client.CommitmentConfirmed,
+	})
+	if err != nil {
+		return "", fmt.Errorf("get latest blockhash failed: %w", err)
+	}
+	rawTx, err := types.CreateRawTransaction(types.CreateRawTransactionParam{
+		Instructions: []types.Instruction{
+			sysprog.AdvanceNonceAccount(common.PublicKeyFromString(nonceAccount), s.feePayer.PublicKey),
+		},
+		Signers:         []types.Account{s.feePayer},
+		FeePayer:        s.feePayer.PublicKey,
+		RecentBlockHash: res.Blockhash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("create tx failed: %w", err)
+	}
+	txHash, err := s.rpcClient.SendRawTransaction(ctx, rawTx)
+	if err != nil {
+		return "", fmt.Errorf("send tx failed: %w", err)
+	}
+	logrus.Debugf("nonce of %s advanced by tx %s", nonceAccount, txHash)
+	return txHash, nil
+}
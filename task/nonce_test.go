@@ -0,0 +1,112 @@
+package task
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+// newNonceTestEnv is newTestEnv with a state store and txs sent with the durable nonce of one account
+func newNonceTestEnv(t *testing.T) (*testEnv, common.PublicKey) {
+	env := newTestEnv(t)
+	stateStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+
+	nonceAccount := types.NewAccount().PublicKey
+	env.server.AddNonceAccount(nonceAccount, env.task.feePayerAccount.PublicKey)
+	if err := env.task.txSender.UseNonceAccounts(context.Background(), []string{nonceAccount.ToBase58()}); err != nil {
+		t.Fatal(err)
+	}
+	return env, nonceAccount
+}
+
+func TestUseNonceAccountsOfOthers(t *testing.T) {
+	env := newTestEnv(t)
+	nonceAccount := types.NewAccount().PublicKey
+	env.server.AddNonceAccount(nonceAccount, types.NewAccount().PublicKey)
+	if err := env.task.txSender.UseNonceAccounts(context.Background(), []string{nonceAccount.ToBase58()}); err == nil {
+		t.Fatal("nonce account of another authority accepted")
+	}
+}
+
+func TestNonceTxRebroadcast(t *testing.T) {
+	env, nonceAccount := newNonceTestEnv(t)
+
+	// the dropped tx stays valid and lands when rebroadcast
+	env.server.DropNext(1)
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_update_active", "era_update_rate",
+	})
+
+	state, err := env.task.store.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Txs) != 3 || len(state.PendingTxs()) != 0 {
+		t.Fatalf("recorded txs: %+v", state.Txs)
+	}
+	for _, tx := range state.Txs {
+		if tx.NonceAccount != nonceAccount.ToBase58() || tx.Status != store.TxStatusLanded {
+			t.Fatalf("recorded tx: %+v", tx)
+		}
+	}
+}
+
+func TestNonceTxGivenUp(t *testing.T) {
+	env, nonceAccount := newNonceTestEnv(t)
+	env.task.txSender.NonceTimeout = 0
+
+	// the dropped tx is given up by advancing its nonce, then resent with the next nonce
+	env.server.DropNext(1)
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_update_active", "era_update_rate",
+	})
+	state, err := env.task.store.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Txs) != 4 || state.Txs[0].Status != store.TxStatusNotLanded || len(state.PendingTxs()) != 0 {
+		t.Fatalf("recorded txs: %+v", state.Txs)
+	}
+
+	// a tx lost in a restart is given up on reconcile
+	nonce := env.server.Nonce(nonceAccount)
+	err = env.task.store.Update(env.stakeManager.ToBase58(), func(state *store.StakeManagerState) error {
+		state.AddTx(store.TxRecord{
+			Signature:    types.NewAccount().PublicKey.ToBase58(),
+			NonceAccount: nonceAccount.ToBase58(),
+			Nonce:        nonce.ToBase58(),
+			Status:       store.TxStatusPending,
+			SentAt:       time.Now().Add(-time.Hour),
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := env.task.reconcile(env.stakeManager); err == nil {
+		t.Fatal("lost tx not in flight until its nonce advances")
+	}
+	if env.server.Nonce(nonceAccount) == nonce {
+		t.Fatal("nonce not advanced")
+	}
+	if err := env.task.reconcile(env.stakeManager); err != nil {
+		t.Fatal(err)
+	}
+	state, err = env.task.store.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lost := state.Txs[len(state.Txs)-1]; lost.Status != store.TxStatusNotLanded {
+		t.Fatalf("lost tx: %+v", lost)
+	}
+}
@@ -0,0 +1,103 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/mockrpc"
+)
+
+// failures in the format anchor logs a program error in. The relay goes by the logged name, the codes only have to
+// match the error number of the log.
+var (
+	eraIsLatestFailure = mockrpc.ProgramFailure{Code: 0x1771, Logs: []string{
+		"Program log: Instruction: EraNew",
+		"Program log: AnchorError thrown in programs/lsd_program/src/era_new.rs:57. Error Code: EraIsLatest. Error Number: 6001. Error Message: Era is latest.",
+	}}
+	rateChangeOverLimitFailure = mockrpc.ProgramFailure{Code: 0x1775, Logs: []string{
+		"Program log: Instruction: EraUpdateRate",
+		"Program log: AnchorError thrown in programs/lsd_program/src/era_update_rate.rs:87. Error Code: RateChangeOverLimit. Error Number: 6005. Error Message: Rate change over limit.",
+	}}
+)
+
+type alertRecorder struct {
+	alerts chan alert.Alert
+}
+
+func (r *alertRecorder) Notify(ctx context.Context, a alert.Alert) error {
+	r.alerts <- a
+	return nil
+}
+
+func TestAlreadyProcessedTakenAsDone(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.server.FailNextWith("era_new", 1, eraIsLatestFailure)
+	handler, _ := env.task.handlerByName("EraNew")
+	if err := env.task.runHandler(env.stakeManager, handler); err != nil {
+		t.Fatalf("EraNew failed with EraIsLatest: %s, want taken as done", err)
+	}
+	if len(env.server.Instructions()) != 0 {
+		t.Fatalf("instructions landed: %v", env.server.Instructions())
+	}
+}
+
+func TestBareCodeRetried(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &alertRecorder{alerts: make(chan alert.Alert, 10)}
+	env.task.notifier = recorder
+
+	// without its log, the code is not known to be RateChangeOverLimit
+	env.server.FailNextWith("era_update_rate", 1, mockrpc.ProgramFailure{Code: rateChangeOverLimitFailure.Code})
+	if err := env.task.handleEra(nil); err == nil {
+		t.Fatal("handleEra succeeded, want era_update_rate failed")
+	}
+	if reason, halted := env.task.haltReason(env.stakeManager); halted {
+		t.Fatalf("halted on a bare code: %s", reason)
+	}
+	if err := env.task.handleEra(nil); err != nil {
+		t.Fatalf("handleEra retry failed: %s", err)
+	}
+	assertInstructions(t, env.server.Instructions(), []string{"era_new", "era_update_active", "era_update_rate"})
+}
+
+func TestRateChangeOverLimitHalts(t *testing.T) {
+	env := newTestEnv(t)
+	recorder := &alertRecorder{alerts: make(chan alert.Alert, 10)}
+	env.task.notifier = recorder
+
+	env.server.FailNextWith("era_update_rate", 1, rateChangeOverLimitFailure)
+	err := env.task.handleEra(nil)
+	if err == nil || !strings.Contains(err.Error(), "RateChangeOverLimit") {
+		t.Fatalf("handleEra err: %v, want RateChangeOverLimit", err)
+	}
+	select {
+	case a := <-recorder.alerts:
+		if a.Level != alert.LevelCritical || a.Title != "stake manager halted" {
+			t.Fatalf("alert: %+v", a)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("halt not alerted")
+	}
+
+	// nothing is sent for the stake manager until restart
+	if err := env.task.handleEra(nil); err != nil {
+		t.Fatalf("handleEra of halted stake manager failed: %s", err)
+	}
+	assertInstructions(t, env.server.Instructions(), []string{"era_new", "era_update_active"})
+	// the handling pass of a halted stake manager does not hide the halt
+	env.task.health.passed()
+	for _, readiness := range []bool{false, true} {
+		failures := env.task.health.check(1, 1800, 0, time.Hour, readiness)
+		if len(failures) != 1 || !strings.Contains(failures[0], env.stakeManager.ToBase58()+" halted") {
+			t.Fatalf("readiness %t failures: %v", readiness, failures)
+		}
+	}
+	sm := env.server.StakeManager(env.stakeManager)
+	if sm.LatestEra != 10 || sm.EraProcessData.NewActive == 0 {
+		t.Fatalf("after halt latest era: %d, new active: %d", sm.LatestEra, sm.EraProcessData.NewActive)
+	}
+}
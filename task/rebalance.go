@@ -0,0 +1,350 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+const defaultRebalanceMovesPerEra = 4
+
+// RebalanceMove redelegates Amount from StakeAccount, delegated to From, to a new stake account delegated to To
+type RebalanceMove struct {
+	StakeAccount common.PublicKey
+	From         common.PublicKey
+	To           common.PublicKey
+	Amount       uint64
+}
+
+// RebalanceLimits bounds the moves planned at once, MaxAmount 0 means no limit and MaxMoves 0 the default
+type RebalanceLimits struct {
+	MaxAmount uint64
+	MaxMoves  uint64
+	MinMove   uint64
+}
+
+type rebalanceAccount struct {
+	stakeAccount common.PublicKey
+	validator    common.PublicKey
+	stake        uint64
+	active       bool // only active stake can be redelegated
+}
+
+// PlanRebalance plans the moves bringing the stake of a stake manager's stake accounts closer to the target
+// distribution over validators: weights if set, validator -> weight, or an even split.
+// Other validators are targeted at 0, so the stake left on removed or low scored validators is moved off.
+func PlanRebalance(c *client.Client, stakeManager *lsdprog.StakeManager, validators []common.PublicKey, weights map[string]uint64, limits RebalanceLimits) ([]RebalanceMove, error) {
+	minDelegationAmount, err := c.GetMinDelegationAmount(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if limits.MaxMoves == 0 {
+		limits.MaxMoves = defaultRebalanceMovesPerEra
+	}
+	if limits.MinMove < minDelegationAmount {
+		limits.MinMove = minDelegationAmount
+	}
+
+	accounts := make([]rebalanceAccount, 0, len(stakeManager.StakeAccounts))
+	for _, stakeAccount := range stakeManager.StakeAccounts {
+		activation, err := c.GetStakeActivation(context.Background(), stakeAccount.ToBase58(), client.GetStakeActivationConfig{})
+		if err != nil {
+			return nil, err
+		}
+		accountInfo, err := c.GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		delegation := accountInfo.StakeAccount.Info.Stake.Delegation
+		accounts = append(accounts, rebalanceAccount{
+			stakeAccount: stakeAccount,
+			validator:    delegation.Voter,
+			stake:        uint64(delegation.Stake),
+			active:       activation.State == client.StakeActivationStateActive,
+		})
+	}
+
+	targets, err := rebalanceTargets(validators, weights, accounts)
+	if err != nil {
+		return nil, err
+	}
+	return planMoves(accounts, targets, limits), nil
+}
+
+// rebalanceTargets splits the total stake by weight, validators without weight are targeted at 0
+func rebalanceTargets(validators []common.PublicKey, weights map[string]uint64, accounts []rebalanceAccount) (map[common.PublicKey]uint64, error) {
+	total := uint64(0)
+	for _, account := range accounts {
+		total += account.stake
+	}
+
+	validatorWeights := make(map[common.PublicKey]uint64)
+	totalWeight := uint64(0)
+	for _, validator := range validators {
+		weight := uint64(1)
+		if len(weights) > 0 {
+			weight = weights[validator.ToBase58()]
+		}
+		validatorWeights[validator] = weight
+		totalWeight += weight
+	}
+	if totalWeight == 0 {
+		return nil, fmt.Errorf("no validator of the stake manager has a weight")
+	}
+
+	targets := make(map[common.PublicKey]uint64)
+	for validator, weight := range validatorWeights {
+		target := new(big.Int).SetUint64(total)
+		target.Mul(target, new(big.Int).SetUint64(weight))
+		target.Div(target, new(big.Int).SetUint64(totalWeight))
+		targets[validator] = target.Uint64()
+	}
+	return targets, nil
+}
+
+// planMoves repeatedly moves from the validator most over its target to the one most under it, taking the
+// largest unused active stake account of the source. A split leaving less than MinMove behind is shrunk to keep it.
+func planMoves(accounts []rebalanceAccount, targets map[common.PublicKey]uint64, limits RebalanceLimits) []RebalanceMove {
+	actual := make(map[common.PublicKey]uint64)
+	movable := make(map[common.PublicKey][]rebalanceAccount)
+	for _, account := range accounts {
+		actual[account.validator] += account.stake
+		if account.active {
+			movable[account.validator] = append(movable[account.validator], account)
+		}
+	}
+	for validator := range movable {
+		list := movable[validator]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].stake > list[j].stake })
+	}
+
+	// iterate in a fixed order, so the same state always gives the same plan
+	validators := make([]common.PublicKey, 0, len(actual)+len(targets))
+	seen := make(map[common.PublicKey]bool)
+	for _, m := range []map[common.PublicKey]uint64{actual, targets} {
+		for validator := range m {
+			if !seen[validator] {
+				seen[validator] = true
+				validators = append(validators, validator)
+			}
+		}
+	}
+	sort.Slice(validators, func(i, j int) bool { return validators[i].ToBase58() < validators[j].ToBase58() })
+
+	moves := make([]RebalanceMove, 0)
+	moved := uint64(0)
+	for uint64(len(moves)) < limits.MaxMoves {
+		var from, to common.PublicKey
+		maxSurplus, maxDeficit := uint64(0), uint64(0)
+		for _, validator := range validators {
+			if actual[validator] > targets[validator] && len(movable[validator]) > 0 && actual[validator]-targets[validator] > maxSurplus {
+				from, maxSurplus = validator, actual[validator]-targets[validator]
+			}
+			if _, targeted := targets[validator]; targeted && targets[validator] > actual[validator] && targets[validator]-actual[validator] > maxDeficit {
+				to, maxDeficit = validator, targets[validator]-actual[validator]
+			}
+		}
+
+		if maxSurplus == 0 || maxDeficit == 0 {
+			break
+		}
+
+		amount := maxSurplus
+		if maxDeficit < amount {
+			amount = maxDeficit
+		}
+		if limits.MaxAmount > 0 && limits.MaxAmount-moved < amount {
+			amount = limits.MaxAmount - moved
+		}
+		account := movable[from][0]
+		if amount > account.stake {
+			amount = account.stake
+		}
+		if remainder := account.stake - amount; remainder > 0 && remainder < limits.MinMove {
+			amount = account.stake - limits.MinMove
+			if account.stake < limits.MinMove {
+				amount = 0
+			}
+		}
+		if amount == 0 || amount < limits.MinMove {
+			break
+		}
+
+		moves = append(moves, RebalanceMove{StakeAccount: account.stakeAccount, From: from, To: to, Amount: amount})
+		movable[from] = movable[from][1:]
+		actual[from] -= amount
+		actual[to] += amount
+		moved += amount
+	}
+	return moves
+}
+
+// EraRebalance redelegates stake towards the target distribution once the era is processed,
+// within the per era limits of the Rebalance config.
+func (task *Task) EraRebalance(stakeManagerAddr common.PublicKey) error {
+	stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+	if err != nil {
+		return err
+	}
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseIdle {
+		return nil
+	}
+
+	cfg := task.cfg.Rebalance
+	limits := RebalanceLimits{MaxMoves: cfg.MaxMovesPerEra, MinMove: cfg.MinMove}
+	if limits.MaxMoves == 0 {
+		limits.MaxMoves = defaultRebalanceMovesPerEra
+	}
+	progress, err := task.rebalanceProgress(stakeManagerAddr, stakeManager.LatestEra)
+	if err != nil {
+		return err
+	}
+	if progress.Moves >= limits.MaxMoves {
+		return nil
+	}
+	limits.MaxMoves -= progress.Moves
+	if cfg.MaxAmountPerEra > 0 {
+		if progress.Amount >= cfg.MaxAmountPerEra {
+			return nil
+		}
+		limits.MaxAmount = cfg.MaxAmountPerEra - progress.Amount
+	}
+
+	validators, err := task.bondableValidators(stakeManager.Validators)
+	if err != nil {
+		return err
+	}
+	moves, err := PlanRebalance(task.client.Load(), stakeManager, validators, task.cfg.ValidatorWeights, limits)
+	if err != nil {
+		return err
+	}
+	if len(moves) == 0 {
+		return nil
+	}
+	if cfg.PlanOnly {
+		for _, move := range moves {
+			logrus.Infof("EraRebalance plan of stakeManager %s era %d: move %d from %s (stakeAccount %s) to %s",
+				stakeManagerAddr.ToBase58(), stakeManager.LatestEra, move.Amount, move.From.ToBase58(), move.StakeAccount.ToBase58(), move.To.ToBase58())
+		}
+		return nil
+	}
+
+	admin, exist := task.accountsMap[stakeManager.Admin.ToBase58()]
+	if !exist {
+		logrus.Warnf("EraRebalance of stakeManager %s skipped: admin %s not in keystore", stakeManagerAddr.ToBase58(), stakeManager.Admin.ToBase58())
+		return nil
+	}
+	stakePool, _, err := common.FindProgramAddress([][]byte{stakeManagerAddr.Bytes(), stakePoolSeed}, task.lsdProgramID)
+	if err != nil {
+		return err
+	}
+
+	for _, move := range moves {
+		if err := task.rebalanceMove(stakeManagerAddr, stakeManager.LatestEra, admin, stakePool, move); err != nil {
+			return err
+		}
+		task.recordRebalance(stakeManagerAddr, stakeManager.LatestEra, move.Amount)
+		if task.cfg.DryRun {
+			// nothing changed on chain, later moves were planned on the stake before this one
+			return nil
+		}
+	}
+	return nil
+}
+
+func (task *Task) rebalanceMove(stakeManagerAddr common.PublicKey, era uint64, admin types.Account, stakePool common.PublicKey, move RebalanceMove) error {
+	// only the new stake account is kept for a resend, a split account of a lost tx is never created
+	toStakeAccount, err := task.newStakeAccount(stakeManagerAddr, "EraRebalance", era)
+	if err != nil {
+		return err
+	}
+	splitStakeAccount := types.NewAccount()
+
+	result, err := task.sendTx(txMeta{stakeManager: stakeManagerAddr, handler: "EraRebalance", era: era, stakeAccount: &toStakeAccount}, []types.Instruction{
+		lsdprog.Redelegate(
+			task.lsdProgramID,
+			stakeManagerAddr,
+			admin.PublicKey,
+			move.To,
+			stakePool,
+			move.StakeAccount,
+			splitStakeAccount.PublicKey,
+			toStakeAccount.PublicKey,
+			task.feePayerAccount.PublicKey,
+			move.Amount,
+		),
+	}, admin, splitStakeAccount, toStakeAccount)
+	if err != nil {
+		return err
+	}
+
+	logrus.Infof("EraRebalance send tx hash: %s, amount: %d, from: %s, stakeAccount: %s, to: %s, toStakeAccount: %s",
+		result.Signature, move.Amount, move.From.ToBase58(), move.StakeAccount.ToBase58(), move.To.ToBase58(), toStakeAccount.PublicKey.ToBase58())
+	if err := result.Err(); err != nil {
+		_, errInside := task.client.Load().GetStakeAccountInfo(context.Background(), toStakeAccount.PublicKey.ToBase58())
+		if errInside == nil {
+			logrus.Info("EraRebalance success")
+			return nil
+		}
+		if errInside != client.ErrAccountNotFound {
+			return errInside
+		}
+		return err
+	}
+	logrus.Info("EraRebalance success")
+	return nil
+}
+
+// rebalanceProgress returns what was moved in the era, kept in the state store to survive restarts if enabled.
+// It fails if the store can not be read, moving on from no progress could go over the era limits.
+func (task *Task) rebalanceProgress(stakeManagerAddr common.PublicKey, era uint64) (store.RebalanceProgress, error) {
+	progress := store.RebalanceProgress{}
+	if task.store != nil {
+		state, err := task.store.Load(stakeManagerAddr.ToBase58())
+		if err != nil {
+			return store.RebalanceProgress{}, fmt.Errorf("load state of stakeManager %s failed: %w", stakeManagerAddr.ToBase58(), err)
+		}
+		progress = state.Rebalance
+	} else {
+		task.rebalanceMu.Lock()
+		progress = task.rebalanced[stakeManagerAddr]
+		task.rebalanceMu.Unlock()
+	}
+	if progress.Era != era {
+		return store.RebalanceProgress{Era: era}, nil
+	}
+	return progress, nil
+}
+
+func (task *Task) recordRebalance(stakeManagerAddr common.PublicKey, era, amount uint64) {
+	record := func(progress *store.RebalanceProgress) {
+		if progress.Era != era {
+			*progress = store.RebalanceProgress{Era: era}
+		}
+		progress.Amount += amount
+		progress.Moves++
+	}
+	if task.store == nil {
+		task.rebalanceMu.Lock()
+		if task.rebalanced == nil {
+			task.rebalanced = make(map[common.PublicKey]store.RebalanceProgress)
+		}
+		progress := task.rebalanced[stakeManagerAddr]
+		record(&progress)
+		task.rebalanced[stakeManagerAddr] = progress
+		task.rebalanceMu.Unlock()
+		return
+	}
+	task.updateProgress(stakeManagerAddr, func(state *store.StakeManagerState) bool {
+		record(&state.Rebalance)
+		return true
+	})
+}
@@ -0,0 +1,127 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+func TestPlanMoves(t *testing.T) {
+	a, b, c := common.PublicKey{1}, common.PublicKey{2}, common.PublicKey{3}
+	accounts := []rebalanceAccount{
+		{stakeAccount: common.PublicKey{11}, validator: a, stake: 6e9, active: true},
+		{stakeAccount: common.PublicKey{12}, validator: a, stake: 3e9, active: true},
+		{stakeAccount: common.PublicKey{13}, validator: c, stake: 3e9, active: true},
+		{stakeAccount: common.PublicKey{14}, validator: c, stake: 1e9, active: false},
+	}
+	// c was removed from the stake manager, its stake is to be split between a and b
+	targets, err := rebalanceTargets([]common.PublicKey{a, b}, nil, accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[a] != 6.5e9 || targets[b] != 6.5e9 {
+		t.Fatalf("targets: %v", targets)
+	}
+
+	cases := []struct {
+		name   string
+		limits RebalanceLimits
+		want   []RebalanceMove
+	}{
+		{"unlimited", RebalanceLimits{MaxMoves: 4, MinMove: 1e9}, []RebalanceMove{
+			{StakeAccount: common.PublicKey{13}, From: c, To: b, Amount: 3e9},
+			{StakeAccount: common.PublicKey{11}, From: a, To: b, Amount: 2.5e9},
+		}},
+		{"max moves", RebalanceLimits{MaxMoves: 1, MinMove: 1e9}, []RebalanceMove{
+			{StakeAccount: common.PublicKey{13}, From: c, To: b, Amount: 3e9},
+		}},
+		{"max amount", RebalanceLimits{MaxAmount: 4e9, MaxMoves: 4, MinMove: 1e9}, []RebalanceMove{
+			{StakeAccount: common.PublicKey{13}, From: c, To: b, Amount: 3e9},
+			{StakeAccount: common.PublicKey{11}, From: a, To: b, Amount: 1e9},
+		}},
+		{"min move", RebalanceLimits{MaxMoves: 4, MinMove: 3e9}, []RebalanceMove{
+			{StakeAccount: common.PublicKey{13}, From: c, To: b, Amount: 3e9},
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := planMoves(accounts, targets, tc.limits)
+			if len(got) != len(tc.want) {
+				t.Fatalf("moves: %+v, want: %+v", got, tc.want)
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Fatalf("move %d: %+v, want: %+v", i, got[i], tc.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEraRebalance(t *testing.T) {
+	env := newTestEnv(t)
+	admin := types.NewAccount()
+	newValidator := types.NewAccount().PublicKey
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) {
+		sm.LatestEra = 10
+		sm.Admin = admin.PublicKey
+		sm.Validators = append(sm.Validators, newValidator)
+	})
+	env.task.accountsMap = map[string]types.Account{admin.PublicKey.ToBase58(): admin}
+	env.task.cfg.Rebalance.Enabled = true
+	env.task.appendHandlers(env.task.EraRebalance)
+
+	// planning only leaves the stake where it is
+	env.task.cfg.Rebalance.PlanOnly = true
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), nil)
+
+	env.task.cfg.Rebalance.PlanOnly = false
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{"redelegate"})
+	sm := env.server.StakeManager(env.stakeManager)
+	if len(sm.StakeAccounts) != 2 {
+		t.Fatalf("stake accounts: %d, want: 2", len(sm.StakeAccounts))
+	}
+	moved, _ := env.server.StakeAccount(sm.StakeAccounts[1])
+	kept, _ := env.server.StakeAccount(env.stakeAccount)
+	if moved.Voter != newValidator || moved.Stake != 5e9 || kept.Stake != 5e9 {
+		t.Fatalf("moved: %+v, kept: %+v", moved, kept)
+	}
+
+	// balanced, nothing more to move
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{"redelegate"})
+}
+
+func TestRebalanceProgressStoreUnreadable(t *testing.T) {
+	env := newTestEnv(t)
+	dir := t.TempDir()
+	stateStore, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+	env.task.recordRebalance(env.stakeManager, 10, 5e9)
+	if progress, err := env.task.rebalanceProgress(env.stakeManager, 10); err != nil || progress.Moves != 1 || progress.Amount != 5e9 {
+		t.Fatalf("progress: %+v, err: %v", progress, err)
+	}
+
+	// the moves of the era are not known, no progress is made up
+	reopened, err := store.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = reopened
+	if err := os.WriteFile(filepath.Join(dir, env.stakeManager.ToBase58()+".json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if progress, err := env.task.rebalanceProgress(env.stakeManager, 10); err == nil {
+		t.Fatalf("progress %+v read from an unreadable state", progress)
+	}
+}
@@ -0,0 +1,324 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mr-tron/base58"
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
+)
+
+// txMeta tells the state store what a tx is sent for
+type txMeta struct {
+	stakeManager common.PublicKey
+	handler      string
+	era          uint64
+	stakeAccount *types.Account                   // created by the tx, if any
+	lookupTables []versionedtx.LookupTableAccount // sent as a v0 tx loading accounts from these, if any
+}
+
+// sendTx sends through the tx sender and records every signature in the state store,
+// so txs lost in a restart are reconciled before new ones are sent. In dry run it only logs the simulation.
+func (task *Task) sendTx(meta txMeta, instructions []types.Instruction, signers ...types.Account) (*TxResult, error) {
+	if task.cfg.DryRun {
+		result, err := task.txSender.SendVersioned(context.Background(), meta.lookupTables, instructions, signers...)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Infof("dry run %s of stakeManager %s era %d: %s, unitsConsumed: %d, err: %v, logs: %s",
+			meta.handler, meta.stakeManager.ToBase58(), meta.era, result.Status, result.UnitsConsumed, result.MetaErr, strings.Join(result.Logs, " | "))
+		return result, nil
+	}
+	if task.store == nil {
+		return task.txSender.SendVersioned(context.Background(), meta.lookupTables, instructions, signers...)
+	}
+
+	stakeManager := meta.stakeManager.ToBase58()
+	stakeAccount := ""
+	if meta.stakeAccount != nil {
+		stakeAccount = meta.stakeAccount.PublicKey.ToBase58()
+	}
+	ctx := withSentHook(context.Background(), func(sent sentTx) {
+		err := task.store.Update(stakeManager, func(state *store.StakeManagerState) error {
+			if meta.era > state.LatestEra {
+				state.LatestEra = meta.era
+			}
+			state.AddTx(store.TxRecord{
+				Signature:            sent.signature,
+				Handler:              meta.handler,
+				Era:                  meta.era,
+				LastValidBlockHeight: sent.lastValidBlockHeight,
+				NonceAccount:         sent.nonceAccount,
+				Nonce:                sent.nonce,
+				StakeAccount:         stakeAccount,
+				Status:               store.TxStatusPending,
+				SentAt:               sent.sentAt,
+			})
+			return nil
+		})
+		if err != nil {
+			logrus.Warnf("record tx %s of stakeManager %s failed: %s", sent.signature, stakeManager, err)
+		}
+	})
+
+	result, err := task.txSender.SendVersioned(ctx, meta.lookupTables, instructions, signers...)
+	if err != nil {
+		return result, err
+	}
+
+	err = task.store.Update(stakeManager, func(state *store.StakeManagerState) error {
+		for i, signature := range result.Signatures {
+			switch {
+			case result.Status == TxStatusLanded && i == len(result.Signatures)-1:
+				state.SetTxStatus(signature, store.TxStatusLanded)
+			case result.Status == TxStatusFailed && i == len(result.Signatures)-1:
+				state.SetTxStatus(signature, store.TxStatusFailed)
+			case i < len(result.Signatures)-1:
+				// resent because the blockhash expired
+				state.SetTxStatus(signature, store.TxStatusNotLanded)
+			}
+			// the last signature not landed may still finalize, it is left to reconcile
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("record tx %s of stakeManager %s failed: %s", result.Signature, stakeManager, err)
+	}
+	return result, nil
+}
+
+// newStakeAccount returns the stake account generated for the same handler and era before,
+// if the tx creating it did not land, or generates and records a new one.
+func (task *Task) newStakeAccount(stakeManagerAddr common.PublicKey, handler string, era uint64) (types.Account, error) {
+	if task.store == nil {
+		return types.NewAccount(), nil
+	}
+
+	stakeManager := stakeManagerAddr.ToBase58()
+	state, err := task.store.Load(stakeManager)
+	if err != nil {
+		return types.Account{}, err
+	}
+	for _, record := range state.StakeAccounts {
+		if record.Handler != handler || record.Era != era {
+			continue
+		}
+		privateKey, err := base58.Decode(record.PrivateKey)
+		if err != nil {
+			return types.Account{}, fmt.Errorf("decode stake account %s failed: %w", record.PublicKey, err)
+		}
+
+		// the tx may have landed unnoticed, when the state was lost or reconciled too late
+		_, err = task.client.Load().GetAccountInfo(context.Background(), record.PublicKey, client.GetAccountInfoConfig{
+			Encoding:  client.GetAccountInfoConfigEncodingBase64,
+			DataSlice: client.GetAccountInfoConfigDataSlice{},
+		})
+		if err == nil {
+			if err := task.store.Update(stakeManager, func(state *store.StakeManagerState) error {
+				state.RemoveStakeAccount(record.PublicKey)
+				return nil
+			}); err != nil {
+				return types.Account{}, err
+			}
+			continue
+		}
+		if err != client.ErrAccountNotFound {
+			return types.Account{}, err
+		}
+
+		logrus.Infof("reuse stake account %s of %s era %d", record.PublicKey, handler, era)
+		return types.AccountFromPrivateKeyBytes(privateKey), nil
+	}
+
+	account := types.NewAccount()
+	err = task.store.Update(stakeManager, func(state *store.StakeManagerState) error {
+		// accounts of past eras never landed, the era moved on without them
+		kept := state.StakeAccounts[:0]
+		for _, record := range state.StakeAccounts {
+			if record.Handler != handler || record.Era >= era {
+				kept = append(kept, record)
+			}
+		}
+		state.StakeAccounts = append(kept, store.StakeAccountRecord{
+			Handler:    handler,
+			Era:        era,
+			PublicKey:  account.PublicKey.ToBase58(),
+			PrivateKey: base58.Encode(account.PrivateKey),
+			CreatedAt:  time.Now(),
+		})
+		return nil
+	})
+	if err != nil {
+		return types.Account{}, err
+	}
+	return account, nil
+}
+
+// reconcile resolves the txs left pending, by a restart or a send error. It fails while any of them
+// may still land, so no new tx is sent on top of it.
+func (task *Task) reconcile(stakeManagerAddr common.PublicKey) error {
+	if task.store == nil {
+		return nil
+	}
+	stakeManager := stakeManagerAddr.ToBase58()
+	state, err := task.store.Load(stakeManager)
+	if err != nil {
+		return err
+	}
+	pending := state.PendingTxs()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	signatures := make([]string, len(pending))
+	for i, tx := range pending {
+		signatures[i] = tx.Signature
+	}
+	statuses, err := task.client.Load().GetSignatureStatuses(context.Background(), signatures)
+	if err != nil {
+		return err
+	}
+	blockHeight, err := task.client.Load().GetBlockHeight(context.Background(), client.GetBlockHeightConfig{Commitment: client.CommitmentConfirmed})
+	if err != nil {
+		return err
+	}
+
+	resolved := make(map[string]string)
+	inFlight := 0
+	for i, tx := range pending {
+		if i < len(statuses) && statuses[i].ConfirmationStatus != nil {
+			if *statuses[i].ConfirmationStatus != client.CommitmentFinalized {
+				inFlight++
+				continue
+			}
+			if statuses[i].Err == nil {
+				resolved[tx.Signature] = store.TxStatusLanded
+			} else {
+				resolved[tx.Signature] = store.TxStatusFailed
+			}
+			continue
+		}
+
+		if len(tx.NonceAccount) > 0 {
+			expired, err := task.txSender.expired(context.Background(), sentTx{nonceAccount: tx.NonceAccount, nonce: tx.Nonce})
+			if err != nil {
+				return err
+			}
+			if !expired {
+				// a nonce tx lost in a restart stays valid, it is given up by advancing the nonce
+				if time.Since(tx.SentAt) > task.txSender.NonceTimeout {
+					if _, err := task.txSender.invalidateNonce(context.Background(), tx.NonceAccount); err != nil {
+						return err
+					}
+					logrus.Warnf("advance nonce of %s to give up tx %s of stakeManager %s", tx.NonceAccount, tx.Signature, stakeManager)
+				}
+				inFlight++
+				continue
+			}
+			// the nonce moves with the tx landing, its status may have shown up since
+			landing, err := task.client.Load().GetSignatureStatuses(context.Background(), []string{tx.Signature})
+			if err != nil {
+				return err
+			}
+			if len(landing) > 0 && landing[0].ConfirmationStatus != nil {
+				inFlight++
+				continue
+			}
+		} else if blockHeight <= tx.LastValidBlockHeight {
+			inFlight++
+			continue
+		}
+		// out of the status cache, look it up in history
+		txInfo, err := task.client.Load().GetTransactionV2(context.Background(), tx.Signature)
+		switch {
+		case err == client.ErrTxNotFound:
+			resolved[tx.Signature] = store.TxStatusNotLanded
+		case err != nil:
+			return err
+		case txInfo.Meta.Err == nil:
+			resolved[tx.Signature] = store.TxStatusLanded
+		default:
+			resolved[tx.Signature] = store.TxStatusFailed
+		}
+	}
+
+	if len(resolved) > 0 {
+		err = task.store.Update(stakeManager, func(state *store.StakeManagerState) error {
+			for signature, status := range resolved {
+				state.SetTxStatus(signature, status)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for signature, status := range resolved {
+			logrus.Infof("reconcile tx %s of stakeManager %s: %s", signature, stakeManager, status)
+		}
+	}
+
+	if inFlight > 0 {
+		return fmt.Errorf("%d txs of stakeManager %s still in flight", inFlight, stakeManager)
+	}
+	return nil
+}
+
+// recordLastHandler records the handler a stake manager got to
+func (task *Task) recordLastHandler(stakeManagerAddr common.PublicKey, handler string) {
+	task.updateProgress(stakeManagerAddr, func(state *store.StakeManagerState) bool {
+		if state.LastHandler == handler {
+			return false
+		}
+		state.LastHandler = handler
+		return true
+	})
+}
+
+// recordRetry records the consecutive failures of a stake manager
+func (task *Task) recordRetry(stakeManagerAddr common.PublicKey, retry int) {
+	task.updateProgress(stakeManagerAddr, func(state *store.StakeManagerState) bool {
+		if state.Retry == retry {
+			return false
+		}
+		state.Retry = retry
+		return true
+	})
+}
+
+// updateProgress saves only if fn changed the state, as it runs after every handler
+func (task *Task) updateProgress(stakeManagerAddr common.PublicKey, fn func(state *store.StakeManagerState) bool) {
+	if task.store == nil {
+		return
+	}
+	state, err := task.store.Load(stakeManagerAddr.ToBase58())
+	if err == nil && !fn(&state) {
+		return
+	}
+	err = task.store.Update(stakeManagerAddr.ToBase58(), func(state *store.StakeManagerState) error {
+		fn(state)
+		return nil
+	})
+	if err != nil {
+		logrus.Warnf("record progress of stakeManager %s failed: %s", stakeManagerAddr.ToBase58(), err)
+	}
+}
+
+// loadRetry returns the consecutive failures of a stake manager before the restart
+func (task *Task) loadRetry(stakeManagerAddr common.PublicKey) int {
+	if task.store == nil {
+		return 0
+	}
+	state, err := task.store.Load(stakeManagerAddr.ToBase58())
+	if err != nil {
+		logrus.Warnf("load state of stakeManager %s failed: %s", stakeManagerAddr.ToBase58(), err)
+		return 0
+	}
+	return state.Retry
+}
@@ -2,18 +2,26 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stafiprotocol/solana-go-sdk/client"
 	"github.com/stafiprotocol/solana-go-sdk/common"
-	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
 	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/programerr"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
 	"github.com/stafiprotocol/solana-lsd-relay/pkg/utils"
 )
 
@@ -31,8 +39,37 @@ type Task struct {
 	feePayerAccount types.Account
 	entrustedMode   bool
 
-	client   *client.Client
-	handlers []Handler
+	client            atomic.Pointer[client.Client] // swapped for a new one as endpoint health changes, never mutated, see watchEndpoints
+	rpcClient         *rpc.Client
+	txSender          *TxSender
+	validatorSelector ValidatorSelector
+	handlers          []Handler
+
+	wsEndpoint string
+	wsAlive    atomic.Bool
+	trigger    *eventTrigger
+
+	httpServer *http.Server
+	health     *healthState
+
+	lowBalance    atomic.Bool
+	pauseHandlers map[string]bool
+
+	notifier alert.Notifier
+	workers  *workerPool
+	store    *store.Store
+
+	scores   scoreCache
+	watchdog validatorWatchdog
+
+	rebalanceMu sync.Mutex
+	rebalanced  map[common.PublicKey]store.RebalanceProgress // without the state store
+
+	lookupTablesMu sync.Mutex
+	lookupTables   map[common.PublicKey]common.PublicKey // stake manager -> lookup table, without the state store
+
+	haltMu sync.Mutex
+	halted map[common.PublicKey]string // stake manager -> why its handling stopped, until restart
 }
 
 type Handler struct {
@@ -46,12 +83,19 @@ func NewTask(cfg config.ConfigStart, accouts map[string]types.Account) *Task {
 		cfg:           cfg,
 		accountsMap:   accouts,
 		entrustedMode: true,
+		trigger:       newEventTrigger(),
+		health:        newHealthState(),
 	}
 	return s
 }
 
 func (task *Task) Start() error {
-	task.client = client.NewClient(task.cfg.EndpointList)
+	if len(task.cfg.HttpListenAddress) > 0 {
+		metrics.InstrumentDefaultTransport()
+	}
+	task.client.Store(client.NewClient(task.cfg.EndpointList))
+	task.rpcClient = rpc.NewClient(task.cfg.EndpointList)
+	configureRpcClient(task.rpcClient, task.cfg.Rpc)
 
 	lsdProgramID := common.PublicKeyFromString(task.cfg.LsdProgramID)
 	stackAccountPubkey := common.PublicKeyFromString(task.cfg.StackAddress)
@@ -61,21 +105,99 @@ func (task *Task) Start() error {
 		return fmt.Errorf("fee payer not exit in vault")
 	}
 
+	validatorSelector, err := NewValidatorSelector(task.cfg.ValidatorSelectStrategy, task.cfg.ValidatorWeights)
+	if err != nil {
+		return err
+	}
+	switch task.cfg.UnbondStrategy {
+	case "", UnbondStrategyLargest, UnbondStrategyWorstValidator, UnbondStrategyProportional:
+	default:
+		return fmt.Errorf("unknown unbond strategy: %s", task.cfg.UnbondStrategy)
+	}
+
 	task.lsdProgramID = lsdProgramID
 	task.stackAccountPubkey = stackAccountPubkey
 	task.feePayerAccount = feePayerAccount
+	txSender, err := NewTxSender(task.client.Load(), task.rpcClient, feePayerAccount, task.cfg.Fee)
+	if err != nil {
+		return err
+	}
+	if err := txSender.UseNonceAccounts(context.Background(), task.cfg.NonceAccounts); err != nil {
+		return err
+	}
+	txSender.DryRun = task.cfg.DryRun
+	task.txSender = txSender
+	task.validatorSelector = validatorSelector
 	if len(task.cfg.StakeManagerAddress) > 0 {
 		task.stakeManagerPubkey = common.PublicKeyFromString(task.cfg.StakeManagerAddress)
 		task.entrustedMode = false
 	}
 
+	if task.cfg.DryRun {
+		// a dry run shares the state dir and alert sinks of the live relay it validates, so it uses neither
+		logrus.Warn("dry run, txs are simulated instead of sent")
+	} else {
+		task.initNotifier()
+	}
+	if len(task.cfg.StateDir) > 0 && !task.cfg.DryRun {
+		stateStore, err := store.Open(task.cfg.StateDir)
+		if err != nil {
+			return err
+		}
+		task.store = stateStore
+	}
+	concurrency := task.cfg.Concurrency
+	if concurrency == 0 {
+		concurrency = defaultConcurrency
+	}
+	task.workers = newWorkerPool(int(concurrency))
+
+	task.wsEndpoint = task.cfg.WsEndpoint
+	if len(task.wsEndpoint) == 0 {
+		task.wsEndpoint = rpc.WsEndpoint(task.cfg.EndpointList[0])
+	}
+	task.txSender.WsEndpoint = task.wsEndpoint
+	task.txSender.LsdProgramID = task.lsdProgramID
+
 	task.appendHandlers(task.EraNew, task.EraSkipBond, task.EraBond, task.EraUnbond, task.EraUpdateActive, task.EraUpdateRate, task.EraMerge, task.EraWithdraw)
+	if task.cfg.Rebalance.Enabled {
+		task.appendHandlers(task.EraRebalance)
+	}
+	if err := task.initPauseHandlers(); err != nil {
+		return err
+	}
+	SafeGoWithRestart(task.watchBalance)
+	SafeGoWithRestart(task.watchEndpoints)
+	SafeGoWithRestart(task.watchValidators)
 	SafeGoWithRestart(task.handler)
+	SafeGoWithRestart(task.watchEvents)
+
+	if len(task.cfg.HttpListenAddress) > 0 {
+		mux := metrics.NewServeMux()
+		mux.Handle("/healthz", task.healthHandler(false))
+		mux.Handle("/readyz", task.healthHandler(true))
+		mux.Handle("/era", task.eraStateHandler())
+		task.httpServer = &http.Server{
+			Addr:    task.cfg.HttpListenAddress,
+			Handler: mux,
+		}
+		go func() {
+			logrus.Infof("http server listen on %s", task.cfg.HttpListenAddress)
+			if err := task.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Errorf("http server failed: %s", err)
+				utils.ShutdownRequestChannel <- struct{}{}
+			}
+		}()
+	}
 	return nil
 }
 
 func (task *Task) Stop() {
 	close(task.stop)
+	task.alertSync(alert.LevelWarn, "relay stopped", "relay is shutting down")
+	if task.httpServer != nil {
+		task.httpServer.Close()
+	}
 }
 
 func (s *Task) appendHandlers(handlers ...func(common.PublicKey) error) {
@@ -95,12 +217,23 @@ func (s *Task) appendHandlers(handlers ...func(common.PublicKey) error) {
 	}
 }
 
+// handler handles all stake managers at start, then the ones notified over websocket,
+// or all of them again when an epoch starts or the poll interval passes.
 func (s *Task) handler() {
 	logrus.Info("start handlers")
 	retry := 0
+	if !s.entrustedMode {
+		retry = s.loadRetry(s.stakeManagerPubkey)
+	}
+	var targets map[common.PublicKey]bool // nil means all
+	retryThreshold := int(s.cfg.Alert.RetryThreshold)
+	if retryThreshold == 0 {
+		retryThreshold = defaultAlertRetryThreshold
+	}
 
 	for {
 		if retry > 200 {
+			s.alertSync(alert.LevelCritical, "relay retry cap reached", "era handle failed %d times in a row, relay shuts down", retry)
 			utils.ShutdownRequestChannel <- struct{}{}
 			return
 		}
@@ -109,101 +242,191 @@ func (s *Task) handler() {
 			logrus.Info("task has stopped")
 			return
 		default:
-			err := s.handleEra()
+			err := s.handleEra(targets)
+			s.recordStatus()
 			if err != nil {
 				logrus.Warnf("era handle failed: %s, will retry.", err)
-				time.Sleep(time.Second * 6)
+				s.alert(alert.LevelWarn, "era handle failed", "%s", err)
 				retry++
+				if !s.entrustedMode {
+					s.recordRetry(s.stakeManagerPubkey, retry)
+				}
+				if retry == retryThreshold {
+					s.alert(alert.LevelCritical, "era handle keeps failing", "failed %d times in a row, last err: %s", retry, err)
+				}
+				time.Sleep(time.Second * 6)
 				continue
 			}
 
 			retry = 0
+			if !s.entrustedMode {
+				s.recordRetry(s.stakeManagerPubkey, retry)
+				// in entrusted mode handleEra only dispatches, the workers report how each stake manager went
+				s.health.passed()
+			}
 		}
 
-		time.Sleep(30 * time.Second)
+		var ok bool
+		targets, ok = s.waitEvent()
+		if !ok {
+			logrus.Info("task has stopped")
+			return
+		}
 	}
 }
 
-func (t *Task) handleEra() error {
+// handleEra dispatches the targeted entrusted stake managers to their workers, so one failing stake manager
+// does not hold the others back. In single stake manager mode it handles the stake manager in place.
+func (t *Task) handleEra(targets map[common.PublicKey]bool) error {
 	if t.entrustedMode {
-		stackAccount, err := t.client.GetLsdStack(context.Background(), t.stackAccountPubkey.ToBase58())
+		stackAccount, err := t.client.Load().GetLsdStack(context.Background(), t.stackAccountPubkey.ToBase58())
 		if err != nil {
 			return err
 		}
 
+		t.health.keepStakeManagers(stackAccount.EntrustedStakeManagers)
+		t.workers.keep(stackAccount.EntrustedStakeManagers)
+		if len(stackAccount.EntrustedStakeManagers) == 0 {
+			// nothing to handle, reading the stack is the pass
+			t.health.passed()
+		}
 		for _, stakeManager := range stackAccount.EntrustedStakeManagers {
-			for _, handler := range t.handlers {
-				funcName := handler.name
-				logrus.Debugf("stakeManager: %s, handler %s start...", stakeManager.ToBase58(), funcName)
-				err := handler.method(stakeManager)
-				if err != nil {
-					return fmt.Errorf("handler %s failed: %s, will retry", funcName, err)
-				}
-				logrus.Debugf("stakeManager: %s, handler %s end", stakeManager.ToBase58(), funcName)
+			if targets != nil && !targets[stakeManager] {
+				continue
 			}
+			t.dispatch(stakeManager)
 		}
-	} else {
-		for _, handler := range t.handlers {
-			funcName := handler.name
-			logrus.Debugf("handler %s start...", funcName)
-			err := handler.method(t.stakeManagerPubkey)
-			if err != nil {
-				return fmt.Errorf("handler %s failed: %s, will retry", funcName, err)
-			}
-			logrus.Debugf("handler %s end", funcName)
+		return nil
+	}
+
+	err := t.handleStakeManager(t.stakeManagerPubkey)
+	t.recordStakeManagerStatus(t.stakeManagerPubkey)
+	return err
+}
+
+// handleStakeManager runs the era handlers as the era state machine points them out until the era is idle,
+// then the handlers outside of era processing.
+func (t *Task) handleStakeManager(stakeManager common.PublicKey) error {
+	if reason, halted := t.haltReason(stakeManager); halted {
+		logrus.Warnf("stakeManager: %s halted, restart the relay once solved: %s", stakeManager.ToBase58(), reason)
+		return nil
+	}
+	if err := t.reconcile(stakeManager); err != nil {
+		return err
+	}
+	if err := t.handleEraPhases(stakeManager); err != nil {
+		return err
+	}
+
+	for _, handler := range t.handlers {
+		if isEraPhaseHandler(handler.name) {
+			continue
+		}
+		if t.paused(handler.name) {
+			logrus.Debugf("stakeManager: %s, handler %s paused on low fee payer balance", stakeManager.ToBase58(), handler.name)
+			continue
+		}
+		if err := t.runHandler(stakeManager, handler); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func isEmpty(data *lsdprog.EraProcessData) bool {
-	return data.NeedBond == 0 && data.NeedUnbond == 0 && data.NewActive == 0 && data.OldActive == 0 && len(data.PendingStakeAccounts) == 0
-}
+func (t *Task) handleEraPhases(stakeManager common.PublicKey) error {
+	var last *EraState
+	for {
+		state, err := t.eraState(stakeManager)
+		if err != nil {
+			return err
+		}
+		age, stuck := t.health.observeEraState(stakeManager, state, t.maxPhaseAge())
+		if stuck {
+			t.alert(alert.LevelCritical, "era stuck", "stakeManager %s stuck in era %d phase %s for %s: %s",
+				stakeManager.ToBase58(), state.Era, state.Phase, age.Truncate(time.Second), state.Reason)
+		}
 
-func needSkipBond(data *lsdprog.EraProcessData, minDelegationAmount uint64) bool {
-	return data.NeedBond > 0 && data.NeedBond < minDelegationAmount
-}
+		switch state.Phase {
+		case EraPhaseIdle:
+			return nil
+		case EraPhaseIllegal:
+			return fmt.Errorf("stakeManager %s era %d in illegal state: %s", stakeManager.ToBase58(), state.Era, state.Reason)
+		}
+		if last != nil && state.sameProgress(last) {
+			return fmt.Errorf("handler %s made no progress in era %d phase %s: %s", state.Handler, state.Era, state.Phase, state.Reason)
+		}
 
-func needBond(data *lsdprog.EraProcessData, minDelegationAmount uint64) bool {
-	return data.NeedBond >= minDelegationAmount
+		handler, exist := t.handlerByName(state.Handler)
+		if !exist {
+			return fmt.Errorf("handler %s of era phase %s not registered", state.Handler, state.Phase)
+		}
+		if t.paused(handler.name) {
+			logrus.Debugf("stakeManager: %s, era %d phase %s waits, handler %s paused on low fee payer balance",
+				stakeManager.ToBase58(), state.Era, state.Phase, handler.name)
+			return nil
+		}
+		logrus.Debugf("stakeManager: %s, era %d phase %s: %s", stakeManager.ToBase58(), state.Era, state.Phase, state.Reason)
+		if err := t.runHandler(stakeManager, handler); err != nil {
+			return err
+		}
+		if t.cfg.DryRun {
+			// nothing changed on chain, the same phase would come again
+			return nil
+		}
+		last = &state
+	}
 }
 
-func needUnbond(data *lsdprog.EraProcessData) bool {
-	return data.NeedUnbond > 0
+func (t *Task) runHandler(stakeManager common.PublicKey, handler Handler) error {
+	logrus.Debugf("stakeManager: %s, handler %s start...", stakeManager.ToBase58(), handler.name)
+	start := time.Now()
+	err := handler.method(stakeManager)
+	if errors.Is(err, programerr.ErrAlreadyProcessed) {
+		logrus.Infof("stakeManager: %s, handler %s: %s, taken as done", stakeManager.ToBase58(), handler.name, err)
+		err = nil
+	}
+	metrics.ObserveHandler(handler.name, start, err)
+	t.recordLastHandler(stakeManager, handler.name)
+	if errors.Is(err, programerr.ErrHalt) {
+		t.halt(stakeManager, fmt.Sprintf("handler %s failed: %s", handler.name, err))
+	}
+	if err != nil {
+		return fmt.Errorf("handler %s failed: %s, will retry", handler.name, err)
+	}
+	logrus.Debugf("stakeManager: %s, handler %s end", stakeManager.ToBase58(), handler.name)
+	return nil
 }
 
-func needUpdateActive(data *lsdprog.EraProcessData) bool {
-	return data.NeedUnbond == 0 && data.NeedBond == 0 && len(data.PendingStakeAccounts) > 0
+// halt stops handling the stake manager on an error retrying does not get past, as the rate change over limit.
+// It is alerted once and fails the health checks, handling resumes with a restart.
+func (t *Task) halt(stakeManager common.PublicKey, reason string) {
+	t.haltMu.Lock()
+	defer t.haltMu.Unlock()
+	if t.halted == nil {
+		t.halted = make(map[common.PublicKey]string)
+	}
+	if _, exist := t.halted[stakeManager]; exist {
+		return
+	}
+	t.halted[stakeManager] = reason
+	t.health.setHalted(stakeManager, reason)
+	logrus.Errorf("stakeManager: %s halted: %s", stakeManager.ToBase58(), reason)
+	t.alert(alert.LevelCritical, "stake manager halted", "stakeManager %s no longer handled until the relay restarts: %s",
+		stakeManager.ToBase58(), reason)
 }
 
-func needUpdateRate(data *lsdprog.EraProcessData) bool {
-	return data.NeedUnbond == 0 && data.NeedBond == 0 && len(data.PendingStakeAccounts) == 0 && data.NewActive != 0 && data.OldActive != 0
+func (t *Task) haltReason(stakeManager common.PublicKey) (string, bool) {
+	t.haltMu.Lock()
+	defer t.haltMu.Unlock()
+	reason, exist := t.halted[stakeManager]
+	return reason, exist
 }
 
-func (t *Task) waitTx(txHash string) error {
-	retry := 0
-	for {
-		if retry > 50 {
-			return fmt.Errorf("waitTx %s reach retry limit", txHash)
-		}
-
-		tx, err := t.client.GetTransactionV2(context.Background(), txHash)
-		if err != nil {
-			logrus.Debugf("query tx %s failed: %s", txHash, err.Error())
-			time.Sleep(time.Second * 6)
-			retry++
-			continue
+func (t *Task) handlerByName(name string) (Handler, bool) {
+	for _, handler := range t.handlers {
+		if handler.name == name {
+			return handler, true
 		}
-
-		if tx.Meta.Err != nil {
-			errString := ""
-			for _, log := range tx.Meta.LogMessages {
-				if strings.Contains(log, "Error") || strings.Contains(log, "error") {
-					errString += fmt.Sprintf(" log: %s", log)
-				}
-			}
-			return fmt.Errorf("meta err: %v, logs: %s", tx.Meta.Err, errString)
-		}
-		return nil
 	}
+	return Handler{}, false
 }
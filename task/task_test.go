@@ -0,0 +1,244 @@
+package task
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/mockrpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/store"
+)
+
+type testEnv struct {
+	server       *mockrpc.Server
+	task         *Task
+	stakeManager common.PublicKey
+	validator    common.PublicKey
+	stakeAccount common.PublicKey
+}
+
+// newTestEnv sets up a stake manager at era 9 in epoch 10, holding 10 SOL in one active stake account,
+// and a single stake manager mode task pointed at it. The task is not started, tests drive handleEra.
+func newTestEnv(t *testing.T) *testEnv {
+	lsdProgramID := types.NewAccount().PublicKey
+	server := mockrpc.New(lsdProgramID)
+	t.Cleanup(server.Close)
+
+	env := &testEnv{
+		server:       server,
+		stakeManager: types.NewAccount().PublicKey,
+		validator:    types.NewAccount().PublicKey,
+		stakeAccount: types.NewAccount().PublicKey,
+	}
+	stack := types.NewAccount().PublicKey
+	feePayer := types.NewAccount()
+
+	server.SetEpoch(10)
+	server.SetBalance(feePayer.PublicKey, 10e9)
+	server.AddStack(stack, lsdprog.Stack{Admin: types.NewAccount().PublicKey})
+	server.AddStakeManager(env.stakeManager, lsdprog.StakeManager{
+		Admin:         types.NewAccount().PublicKey,
+		Stack:         stack,
+		LsdTokenMint:  types.NewAccount().PublicKey,
+		LatestEra:     9,
+		Rate:          1e9,
+		Active:        10e9,
+		Validators:    []common.PublicKey{env.validator},
+		StakeAccounts: []common.PublicKey{env.stakeAccount},
+	})
+	server.AddStakeAccount(env.stakeAccount, mockrpc.StakeAccount{
+		Voter:             env.validator,
+		Stake:             10e9,
+		DeactivationEpoch: math.MaxUint64,
+	})
+
+	endpoints := []string{server.URL}
+	c := client.NewClient(endpoints)
+	rpcClient := rpc.NewClient(endpoints)
+	txSender, err := NewTxSender(c, rpcClient, feePayer, config.FeeConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txSender.PollInterval = time.Millisecond
+	txSender.LsdProgramID = lsdProgramID
+	validatorSelector, err := NewValidatorSelector("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.task = &Task{
+		stop:               make(chan struct{}),
+		lsdProgramID:       lsdProgramID,
+		stackAccountPubkey: stack,
+		stakeManagerPubkey: env.stakeManager,
+		feePayerAccount:    feePayer,
+		rpcClient:          rpcClient,
+		txSender:           txSender,
+		validatorSelector:  validatorSelector,
+		trigger:            newEventTrigger(),
+		health:             newHealthState(),
+	}
+	env.task.client.Store(c)
+	env.task.appendHandlers(env.task.EraNew, env.task.EraSkipBond, env.task.EraBond, env.task.EraUnbond,
+		env.task.EraUpdateActive, env.task.EraUpdateRate, env.task.EraMerge, env.task.EraWithdraw)
+	return env
+}
+
+func (env *testEnv) handleEra(t *testing.T) {
+	t.Helper()
+	if err := env.task.handleEra(nil); err != nil {
+		t.Fatalf("handleEra failed: %s", err)
+	}
+}
+
+func assertInstructions(t *testing.T, got, want []string) {
+	t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("instructions landed: %v, want: %v", got, want)
+	}
+}
+
+func assertEraEnded(t *testing.T, stakeManager *lsdprog.StakeManager, era uint64) {
+	t.Helper()
+	if stakeManager.LatestEra != era {
+		t.Fatalf("latest era: %d, want: %d", stakeManager.LatestEra, era)
+	}
+	if eraProcessPhase(&stakeManager.EraProcessData) != EraPhaseIdle {
+		t.Fatalf("era %d not ended: %+v", era, stakeManager.EraProcessData)
+	}
+}
+
+func TestEraLifecycle(t *testing.T) {
+	env := newTestEnv(t)
+
+	// era 10 bonds the staked 5 SOL to a new stake account
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) { sm.EraBond = 5e9 })
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_bond", "era_update_active", "era_update_active", "era_update_rate",
+	})
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if sm.Active != 15e9 || sm.Rate != 1e9 || len(sm.StakeAccounts) != 2 {
+		t.Fatalf("after bond active: %d, rate: %d, stake accounts: %d", sm.Active, sm.Rate, len(sm.StakeAccounts))
+	}
+	bonded, _ := env.server.StakeAccount(sm.StakeAccounts[1])
+	if bonded.Voter != env.validator || bonded.Stake != 5e9 {
+		t.Fatalf("bonded stake account: %+v", bonded)
+	}
+
+	// nothing to do until the next epoch
+	env.handleEra(t)
+	if got := len(env.server.Instructions()); got != 5 {
+		t.Fatalf("instructions landed in the same epoch: %d", got)
+	}
+
+	// era 11 earns rewards, unbonds 4 SOL from the largest account, then merges the two active accounts
+	env.server.AdvanceEpoch(1e8)
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) { sm.EraUnbond = 4e9 })
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions()[5:], []string{
+		"era_new", "era_unbond", "era_update_active", "era_update_active", "era_update_rate", "era_merge",
+	})
+	sm = env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 11)
+	if sm.Active != 111e8 || sm.Rate <= 1e9 {
+		t.Fatalf("after unbond active: %d, rate: %d", sm.Active, sm.Rate)
+	}
+	if len(sm.StakeAccounts) != 1 || len(sm.SplitAccounts) != 1 {
+		t.Fatalf("after merge stake accounts: %d, split accounts: %d", len(sm.StakeAccounts), len(sm.SplitAccounts))
+	}
+	split, _ := env.server.StakeAccount(sm.SplitAccounts[0])
+	if split.Stake != 4e9 {
+		t.Fatalf("split stake: %d", split.Stake)
+	}
+	splitAccount := sm.SplitAccounts[0]
+
+	// era 12 withdraws the split account once it is inactive
+	env.server.AdvanceEpoch(0)
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions()[11:], []string{
+		"era_new", "era_update_active", "era_update_rate", "era_withdraw",
+	})
+	sm = env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 12)
+	if len(sm.SplitAccounts) != 0 {
+		t.Fatalf("split accounts left: %d", len(sm.SplitAccounts))
+	}
+	if _, exist := env.server.StakeAccount(splitAccount); exist {
+		t.Fatal("withdrawn split account still exists")
+	}
+	if len(sm.EraRates) != 3 {
+		t.Fatalf("era rates: %d", len(sm.EraRates))
+	}
+}
+
+func TestEraSkipBond(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) { sm.EraBond = 1e8 })
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_skip_bond", "era_update_active", "era_update_rate",
+	})
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	if sm.EraBond != 1e8 || sm.Rate != 1e9 || len(sm.StakeAccounts) != 1 {
+		t.Fatalf("after skip bond era bond: %d, rate: %d, stake accounts: %d", sm.EraBond, sm.Rate, len(sm.StakeAccounts))
+	}
+}
+
+func TestHandlerFailureRetried(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) { sm.EraBond = 5e9 })
+	env.server.FailNext("era_bond", 1)
+	err := env.task.handleEra(nil)
+	if err == nil || !strings.Contains(err.Error(), "EraBond") {
+		t.Fatalf("handleEra err: %v, want EraBond failed", err)
+	}
+	sm := env.server.StakeManager(env.stakeManager)
+	if sm.LatestEra != 10 || sm.EraProcessData.NeedBond != 5e9 {
+		t.Fatalf("after failed bond latest era: %d, need bond: %d", sm.LatestEra, sm.EraProcessData.NeedBond)
+	}
+
+	// the next pass picks up where the failed one stopped
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_bond", "era_update_active", "era_update_active", "era_update_rate",
+	})
+	sm = env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+}
+
+func TestDroppedTxResent(t *testing.T) {
+	env := newTestEnv(t)
+	stateStore, err := store.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.task.store = stateStore
+
+	env.server.DropNext(1)
+	env.handleEra(t)
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_update_active", "era_update_rate",
+	})
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+
+	state, err := stateStore.Load(env.stakeManager.ToBase58())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Txs) != 4 || state.Txs[0].Status != store.TxStatusNotLanded || len(state.PendingTxs()) != 0 {
+		t.Fatalf("recorded txs: %+v", state.Txs)
+	}
+}
@@ -0,0 +1,558 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mr-tron/base58"
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/sysprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/computebudget"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/programerr"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/versionedtx"
+)
+
+const (
+	PriorityFeeModeStatic  = "static"
+	PriorityFeeModeDynamic = "dynamic"
+
+	defaultPriorityFeePercentile = 75
+
+	maxTxSize = 1232 // bytes of a serialized tx, the packet size less ip and udp headers
+
+	wsPollFactor  = 5                // while a signature is subscribed, polling is this many times slower
+	wsCallTimeout = 10 * time.Second // websocket dial and subscribe
+)
+
+type TxStatus string
+
+const (
+	TxStatusLanded    TxStatus = "landed"     // finalized without error
+	TxStatusFailed    TxStatus = "failed"     // finalized with error
+	TxStatusNotLanded TxStatus = "not_landed" // blockhash or nonce expired on every resend
+	TxStatusUnknown   TxStatus = "unknown"    // seen but not finalized within MaxPoll, it may still finalize
+	TxStatusSimulated TxStatus = "simulated"  // dry run, simulated without error
+)
+
+var (
+	ErrTxFailed    = errors.New("tx failed")
+	ErrTxNotLanded = errors.New("tx not landed")
+	ErrTxUnknown   = errors.New("tx outcome unknown")
+	ErrTxSimulate  = errors.New("tx simulation failed")
+)
+
+// TxResult is the outcome of a sent tx. Signature is the last one sent,
+// Signatures keeps every signature sent, one for each blockhash used.
+type TxResult struct {
+	Signature  string
+	Signatures []string
+	Status     TxStatus
+	Slot       uint64
+	MetaErr    interface{}
+	Logs       []string
+	ProgramErr *programerr.Error // MetaErr decoded, set if failed
+
+	Simulated     bool   // dry run, not sent
+	UnitsConsumed uint64 // dry run only
+
+	programs []common.PublicKey // of the instructions of the last tx sent, to decode its error
+}
+
+// Err returns nil if the tx landed, or an error wrapping ErrTxFailed/ErrTxNotLanded/ErrTxUnknown.
+func (r *TxResult) Err() error {
+	switch r.Status {
+	case TxStatusLanded, TxStatusSimulated:
+		return nil
+	case TxStatusFailed:
+		errString := ""
+		for _, log := range r.Logs {
+			if strings.Contains(log, "Error") || strings.Contains(log, "error") {
+				errString += fmt.Sprintf(" log: %s", log)
+			}
+		}
+		var decoded error = r.ProgramErr
+		if r.ProgramErr == nil {
+			decoded = fmt.Errorf("meta err: %v", r.MetaErr)
+		}
+		if r.ProgramErr != nil && len(r.ProgramErr.Message) != 0 {
+			// the error is known, the logs add nothing
+			errString = ""
+		} else {
+			errString = fmt.Sprintf(", logs: %s", errString)
+		}
+		if r.Simulated {
+			return fmt.Errorf("%w: %w%s", ErrTxSimulate, decoded, errString)
+		}
+		return fmt.Errorf("%w: %s %w%s", ErrTxFailed, r.Signature, decoded, errString)
+	case TxStatusUnknown:
+		return fmt.Errorf("%w: %s", ErrTxUnknown, r.Signature)
+	default:
+		return fmt.Errorf("%w: %s", ErrTxNotLanded, strings.Join(r.Signatures, ","))
+	}
+}
+
+// sentTx identifies a sent tx and how long it may land: a blockhash tx until the block height passes
+// lastValidBlockHeight, a durable nonce tx until the nonce of nonceAccount moves off nonce.
+type sentTx struct {
+	signature            string
+	lastValidBlockHeight uint64
+	nonceAccount         string
+	nonce                string
+	sentAt               time.Time
+}
+
+// sentHook is called on each tx right before it is sent
+type sentHook func(sent sentTx)
+
+type sentHookKey struct{}
+
+func withSentHook(ctx context.Context, hook sentHook) context.Context {
+	return context.WithValue(ctx, sentHookKey{}, hook)
+}
+
+// TxSender builds, signs, sends and confirms txs paid by the fee payer.
+// A tx whose blockhash expired before landing is rebuilt with a fresh blockhash, priority fee and signatures.
+// With nonce accounts, see UseNonceAccounts, the blockhash is a durable nonce instead.
+// With WsEndpoint, a tx is confirmed by its signature subscription, and by polling its status if that breaks.
+type TxSender struct {
+	client    atomic.Pointer[client.Client] // see SetClient
+	rpcClient *rpc.Client
+	feePayer  types.Account
+	fee       config.FeeConfig
+	nonces    chan common.PublicKey // nonce accounts not held by a tx, nil if txs use a recent blockhash
+
+	wsMu       sync.Mutex
+	ws         *rpc.WsClient // shared by the subscriptions of all txs, redialed once broken
+	wsDialedAt time.Time
+
+	MaxResend    int
+	PollInterval time.Duration
+	MaxPoll      int              // polls allowed after a tx is seen, before it finalizes
+	NonceTimeout time.Duration    // a nonce tx not seen for so long is given up by advancing its nonce
+	WsEndpoint   string           // signatures are subscribed on it, only polled if empty
+	LsdProgramID common.PublicKey // its custom errors are decoded by the lsd program error table
+	DryRun       bool             // simulate instead of sending
+}
+
+func NewTxSender(c *client.Client, rpcClient *rpc.Client, feePayer types.Account, fee config.FeeConfig) (*TxSender, error) {
+	switch fee.PriorityFeeMode {
+	case "":
+		fee.PriorityFeeMode = PriorityFeeModeStatic
+	case PriorityFeeModeStatic, PriorityFeeModeDynamic:
+	default:
+		return nil, fmt.Errorf("unknown priority fee mode: %s", fee.PriorityFeeMode)
+	}
+	if fee.PriorityFeePercentile == 0 {
+		fee.PriorityFeePercentile = defaultPriorityFeePercentile
+	}
+	if fee.PriorityFeePercentile > 100 {
+		return nil, fmt.Errorf("priority fee percentile %d over 100", fee.PriorityFeePercentile)
+	}
+
+	s := &TxSender{
+		rpcClient:    rpcClient,
+		feePayer:     feePayer,
+		fee:          fee,
+		MaxResend:    3,
+		PollInterval: 3 * time.Second,
+		MaxPoll:      50,
+		NonceTimeout: defaultNonceTimeout,
+	}
+	s.client.Store(c)
+	return s, nil
+}
+
+// SetClient replaces the sdk client txs are built and confirmed with
+func (s *TxSender) SetClient(c *client.Client) {
+	s.client.Store(c)
+}
+
+// Send returns an error only if the tx could not be built or sent,
+// the landing outcome is reported by the result, see TxResult.Err.
+func (s *TxSender) Send(ctx context.Context, instructions []types.Instruction, signers ...types.Account) (*TxResult, error) {
+	return s.SendVersioned(ctx, nil, instructions, signers...)
+}
+
+// SendVersioned is Send building a v0 tx that loads accounts from lookupTables, a legacy tx if there are none
+func (s *TxSender) SendVersioned(ctx context.Context, lookupTables []versionedtx.LookupTableAccount, instructions []types.Instruction, signers ...types.Account) (*TxResult, error) {
+	nonceAccount, err := s.acquireNonce(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseNonce(nonceAccount)
+
+	result := &TxResult{Status: TxStatusNotLanded}
+	for i := 0; i <= s.MaxResend; i++ {
+		sent := sentTx{}
+		blockhash := ""
+		txInstructions := make([]types.Instruction, 0, len(instructions)+3)
+		if nonceAccount != (common.PublicKey{}) {
+			nonce, err := s.rpcClient.GetNonceAccount(ctx, nonceAccount.ToBase58())
+			if err != nil {
+				return nil, fmt.Errorf("get nonce account %s failed: %w", nonceAccount.ToBase58(), err)
+			}
+			sent.nonceAccount, sent.nonce = nonceAccount.ToBase58(), nonce.Nonce.ToBase58()
+			blockhash = sent.nonce
+			// the runtime takes a tx for a nonce tx only if advancing the nonce is its first instruction
+			txInstructions = append(txInstructions, sysprog.AdvanceNonceAccount(nonceAccount, s.feePayer.PublicKey))
+		} else {
+			res, err := s.client.Load().GetLatestBlockhash(ctx, client.GetLatestBlockhashConfig{
+				Commitment: client.CommitmentConfirmed,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("get latest blockhash failed: %w", err)
+			}
+			if res.Blockhash == "" {
+				return nil, fmt.Errorf("get latest blockhash failed: blockhash empty")
+			}
+			blockhash, sent.lastValidBlockHeight = res.Blockhash, res.LatestValidBlockHeight
+		}
+
+		txInstructions = append(txInstructions, s.computeBudgetInstructions(ctx, instructions)...)
+		txInstructions = append(txInstructions, instructions...)
+		rawTx, err := s.createRawTx(txInstructions, signers, blockhash, lookupTables)
+		if err != nil {
+			return nil, fmt.Errorf("create tx failed: %w", err)
+		}
+		result.programs = result.programs[:0]
+		for _, instruction := range txInstructions {
+			result.programs = append(result.programs, instruction.ProgramID)
+		}
+
+		if s.DryRun {
+			return s.simulate(ctx, rawTx, result)
+		}
+
+		// the fee payer signature, leading the raw tx after a one byte signature count, identifies the tx.
+		// It is handed to the hook before sending, so a crash while sending can not lose it.
+		sent.signature, sent.sentAt = base58.Encode(rawTx[1:65]), time.Now()
+		if hook, ok := ctx.Value(sentHookKey{}).(sentHook); ok {
+			hook(sent)
+		}
+		// subscribed before sending, so a tx landing at once is not missed
+		sub := s.subscribeSignature(ctx, sent.signature)
+		txHash, err := s.rpcClient.SendRawTransaction(ctx, rawTx)
+		if err != nil {
+			s.unsubscribe(sub)
+			return nil, fmt.Errorf("send tx failed: %w", err)
+		}
+		metrics.TxSent.Inc()
+		result.Signature = txHash
+		result.Signatures = append(result.Signatures, txHash)
+		logrus.Debugf("tx %s sent, lastValidBlockHeight: %d, nonceAccount: %s", txHash, sent.lastValidBlockHeight, sent.nonceAccount)
+
+		expired, err := s.wait(ctx, sent, rawTx, sub, result)
+		if err != nil {
+			return result, err
+		}
+		if !expired {
+			metrics.TxResults.WithLabelValues(string(result.Status)).Inc()
+			return result, nil
+		}
+		logrus.Warnf("tx %s expired before landing, will resend", txHash)
+	}
+	metrics.TxResults.WithLabelValues(string(result.Status)).Inc()
+	return result, nil
+}
+
+// simulate fills the result as if the tx was sent, Status is TxStatusSimulated or TxStatusFailed.
+func (s *TxSender) simulate(ctx context.Context, rawTx []byte, result *TxResult) (*TxResult, error) {
+	sim, err := s.rpcClient.SimulateTransaction(ctx, rawTx)
+	if err != nil {
+		return nil, fmt.Errorf("simulate tx failed: %w", err)
+	}
+	result.Simulated = true
+	result.Signature = base58.Encode(rawTx[1:65])
+	result.Signatures = append(result.Signatures, result.Signature)
+	result.Logs = sim.Logs
+	result.UnitsConsumed = sim.UnitsConsumed
+	if sim.Err != nil {
+		result.Status = TxStatusFailed
+		result.MetaErr = sim.Err
+		result.ProgramErr = s.decoder().Decode(sim.Err, sim.Logs, result.programs)
+	} else {
+		result.Status = TxStatusSimulated
+	}
+	return result, nil
+}
+
+// wait takes the outcome from the signature subscription, if any, and polls the signature until it finalizes or
+// expires, wsPollFactor times slower while subscribed. A blockhash tx expires once the block height passes its
+// lastValidBlockHeight. A nonce tx never expires on its own: it is rebroadcast while not seen, and given up
+// after NonceTimeout by advancing its nonce.
+func (s *TxSender) wait(ctx context.Context, sent sentTx, rawTx []byte, sub *rpc.Subscription, result *TxResult) (bool, error) {
+	txHash := sent.signature
+	seenPoll, unseenPoll := 0, 0
+	expiredSeen := false
+	giveUpAt := sent.sentAt.Add(s.NonceTimeout)
+
+	var notifications <-chan json.RawMessage
+	pollInterval := s.PollInterval
+	if sub != nil {
+		notifications = sub.C
+		pollInterval = s.PollInterval * wsPollFactor
+		defer func() {
+			// still subscribed unless notified or the connection broke
+			if notifications != nil {
+				s.unsubscribe(sub)
+			}
+		}()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case raw, ok := <-notifications:
+			notifications = nil
+			pollInterval = s.PollInterval
+			if !ok {
+				logrus.Debugf("signature subscription of tx %s broken, poll instead", txHash)
+				continue
+			}
+			// the node drops a signature subscription once it notifies
+			sub.Close()
+			notification := rpc.SignatureNotification{}
+			if err := json.Unmarshal(raw, &notification); err != nil {
+				logrus.Debugf("decode signature notification of tx %s failed: %s", txHash, err.Error())
+				continue
+			}
+			s.finalized(ctx, txHash, notification.Context.Slot, notification.Value.Err, result)
+			return false, nil
+		case <-time.After(pollInterval):
+		}
+
+		statuses, err := s.client.Load().GetSignatureStatuses(ctx, []string{txHash})
+		if err != nil {
+			logrus.Debugf("query tx %s status failed: %s", txHash, err.Error())
+			continue
+		}
+
+		if len(statuses) == 0 || statuses[0].ConfirmationStatus == nil {
+			expired, err := s.expired(ctx, sent)
+			if err != nil {
+				logrus.Debugf("check tx %s expiry failed: %s", txHash, err.Error())
+				continue
+			}
+			// the nonce moves with the tx landing, its status may show up a poll later
+			if expired && (len(sent.nonceAccount) == 0 || expiredSeen) {
+				return true, nil
+			}
+			expiredSeen = expired
+			if expired || len(sent.nonceAccount) == 0 {
+				continue
+			}
+
+			unseenPoll++
+			if unseenPoll%nonceRebroadcastPolls == 0 {
+				if _, err := s.rpcClient.SendRawTransaction(ctx, rawTx); err != nil {
+					logrus.Debugf("rebroadcast tx %s failed: %s", txHash, err.Error())
+				}
+			}
+			if time.Now().After(giveUpAt) {
+				logrus.Warnf("tx %s not seen in %s, advance nonce of %s to give it up", txHash, s.NonceTimeout, sent.nonceAccount)
+				if _, err := s.invalidateNonce(ctx, sent.nonceAccount); err != nil {
+					logrus.Warnf("advance nonce of %s failed: %s", sent.nonceAccount, err)
+				}
+				giveUpAt = time.Now().Add(s.NonceTimeout)
+			}
+			continue
+		}
+
+		status := statuses[0]
+		if *status.ConfirmationStatus != client.CommitmentFinalized {
+			seenPoll++
+			if seenPoll > s.MaxPoll {
+				result.Status = TxStatusUnknown
+				return false, nil
+			}
+			continue
+		}
+		s.finalized(ctx, txHash, status.Slot, status.Err, result)
+		return false, nil
+	}
+}
+
+// finalized fills the result of a finalized tx, with the logs and the decoded error if it failed
+func (s *TxSender) finalized(ctx context.Context, txHash string, slot uint64, txErr interface{}, result *TxResult) {
+	result.Slot = slot
+	if txErr == nil {
+		result.Status = TxStatusLanded
+		return
+	}
+
+	result.Status = TxStatusFailed
+	result.MetaErr = txErr
+	tx, err := s.client.Load().GetTransactionV2(ctx, txHash)
+	if err != nil {
+		logrus.Debugf("query tx %s failed: %s", txHash, err.Error())
+	} else {
+		result.Logs = tx.Meta.LogMessages
+	}
+	result.ProgramErr = s.decoder().Decode(txErr, result.Logs, result.programs)
+}
+
+func (s *TxSender) decoder() programerr.Decoder {
+	return programerr.Decoder{LsdProgramID: s.LsdProgramID}
+}
+
+// subscribeSignature subscribes to the finalization of a tx on the shared websocket connection, dialed if there is
+// none. It returns nil if WsEndpoint is not set or the endpoint is down, the tx is then only polled.
+func (s *TxSender) subscribeSignature(ctx context.Context, signature string) *rpc.Subscription {
+	if len(s.WsEndpoint) == 0 {
+		return nil
+	}
+	s.wsMu.Lock()
+	if s.ws != nil {
+		select {
+		case <-s.ws.Done():
+			s.ws = nil
+		default:
+		}
+	}
+	// a down endpoint is dialed again only after wsRedialInterval, not on every tx
+	if s.ws == nil && time.Since(s.wsDialedAt) >= wsRedialInterval {
+		s.wsDialedAt = time.Now()
+		dialCtx, cancel := context.WithTimeout(ctx, wsCallTimeout)
+		ws, err := rpc.DialWs(dialCtx, s.WsEndpoint)
+		cancel()
+		if err != nil {
+			logrus.Warnf("dial websocket %s failed: %s, txs are polled", s.WsEndpoint, err)
+		} else {
+			s.ws = ws
+		}
+	}
+	ws := s.ws
+	s.wsMu.Unlock()
+	if ws == nil {
+		return nil
+	}
+
+	subCtx, cancel := context.WithTimeout(ctx, wsCallTimeout)
+	defer cancel()
+	sub, err := ws.SignatureSubscribe(subCtx, signature, string(client.CommitmentFinalized))
+	if err != nil {
+		logrus.Debugf("subscribe tx %s failed: %s, poll instead", signature, err)
+		return nil
+	}
+	return sub
+}
+
+func (s *TxSender) unsubscribe(sub *rpc.Subscription) {
+	if sub == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wsCallTimeout)
+	defer cancel()
+	if err := sub.Unsubscribe(ctx); err != nil {
+		logrus.Debugf("unsubscribe signature failed: %s", err)
+	}
+}
+
+// Fits tells whether a tx of the instructions, as SendVersioned builds it, stays within the tx size limit
+func (s *TxSender) Fits(lookupTables []versionedtx.LookupTableAccount, instructions []types.Instruction, signers ...types.Account) bool {
+	txInstructions := make([]types.Instruction, 0, len(instructions)+3)
+	if s.nonces != nil {
+		// any nonce account takes the same room
+		txInstructions = append(txInstructions, sysprog.AdvanceNonceAccount(common.PublicKey{1}, s.feePayer.PublicKey))
+	}
+	priorityFee := s.fee.PriorityFee
+	if s.fee.PriorityFeeMode == PriorityFeeModeDynamic && priorityFee == 0 {
+		priorityFee = 1
+	}
+	txInstructions = append(txInstructions, s.budgetInstructions(priorityFee)...)
+	rawTx, err := s.createRawTx(append(txInstructions, instructions...), signers, common.PublicKey{}.ToBase58(), lookupTables)
+	return err == nil && len(rawTx) <= maxTxSize
+}
+
+// createRawTx signs a tx paid by the fee payer, v0 if there are lookup tables
+func (s *TxSender) createRawTx(instructions []types.Instruction, signers []types.Account, blockhash string, lookupTables []versionedtx.LookupTableAccount) ([]byte, error) {
+	if len(lookupTables) > 0 {
+		return versionedtx.CreateRawTransaction(versionedtx.CreateRawTransactionParam{
+			Instructions:    instructions,
+			Signers:         append([]types.Account{s.feePayer}, signers...),
+			FeePayer:        s.feePayer.PublicKey,
+			RecentBlockHash: blockhash,
+			LookupTables:    lookupTables,
+		})
+	}
+	return types.CreateRawTransaction(types.CreateRawTransactionParam{
+		Instructions:    instructions,
+		Signers:         append([]types.Account{s.feePayer}, signers...),
+		FeePayer:        s.feePayer.PublicKey,
+		RecentBlockHash: blockhash,
+	})
+}
+
+func (s *TxSender) computeBudgetInstructions(ctx context.Context, instructions []types.Instruction) []types.Instruction {
+	priorityFee := s.fee.PriorityFee
+	if s.fee.PriorityFeeMode == PriorityFeeModeDynamic {
+		priorityFee = s.dynamicPriorityFee(ctx, instructions)
+	}
+	return s.budgetInstructions(priorityFee)
+}
+
+func (s *TxSender) budgetInstructions(priorityFee uint64) []types.Instruction {
+	budgetInstructions := make([]types.Instruction, 0, 2)
+	if s.fee.ComputeUnitLimit > 0 {
+		budgetInstructions = append(budgetInstructions, computebudget.SetComputeUnitLimit(s.fee.ComputeUnitLimit))
+	}
+	if priorityFee > 0 {
+		budgetInstructions = append(budgetInstructions, computebudget.SetComputeUnitPrice(priorityFee))
+	}
+	return budgetInstructions
+}
+
+// dynamicPriorityFee takes the configured percentile of recent fees paid on the writable accounts of the tx,
+// bounded by PriorityFee below and MaxPriorityFee above. It falls back to PriorityFee if the fees can not be fetched.
+func (s *TxSender) dynamicPriorityFee(ctx context.Context, instructions []types.Instruction) uint64 {
+	accountExist := make(map[string]bool)
+	accounts := make([]string, 0)
+	for _, instruction := range instructions {
+		for _, account := range instruction.Accounts {
+			if !account.IsWritable || account.IsSigner {
+				continue
+			}
+			if !accountExist[account.PubKey.ToBase58()] {
+				accountExist[account.PubKey.ToBase58()] = true
+				accounts = append(accounts, account.PubKey.ToBase58())
+			}
+		}
+	}
+
+	recentFees, err := s.rpcClient.GetRecentPrioritizationFees(ctx, accounts)
+	if err != nil {
+		logrus.Warnf("get recent prioritization fees failed: %s, use priority fee %d", err, s.fee.PriorityFee)
+		return s.fee.PriorityFee
+	}
+	if len(recentFees) == 0 {
+		return s.fee.PriorityFee
+	}
+
+	fees := make([]uint64, 0, len(recentFees))
+	for _, recentFee := range recentFees {
+		fees = append(fees, recentFee.PrioritizationFee)
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+
+	priorityFee := fees[(uint64(len(fees))-1)*s.fee.PriorityFeePercentile/100]
+	if priorityFee < s.fee.PriorityFee {
+		priorityFee = s.fee.PriorityFee
+	}
+	if s.fee.MaxPriorityFee > 0 && priorityFee > s.fee.MaxPriorityFee {
+		priorityFee = s.fee.MaxPriorityFee
+	}
+	return priorityFee
+}
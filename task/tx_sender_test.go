@@ -0,0 +1,52 @@
+package task
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// handleEraWithin is handleEra failing the test if it takes longer than timeout
+func (env *testEnv) handleEraWithin(t *testing.T, timeout time.Duration) error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() { done <- env.task.handleEra(nil) }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		t.Fatalf("handleEra not done in %s", timeout)
+		return nil
+	}
+}
+
+func TestTxConfirmedBySubscription(t *testing.T) {
+	env := newTestEnv(t)
+	env.task.txSender.WsEndpoint = env.server.WsURL
+	// polling would never get to the status, only the subscription can confirm
+	env.task.txSender.PollInterval = time.Hour
+
+	if err := env.handleEraWithin(t, 10*time.Second); err != nil {
+		t.Fatalf("handleEra failed: %s", err)
+	}
+	assertInstructions(t, env.server.Instructions(), []string{
+		"era_new", "era_update_active", "era_update_rate",
+	})
+
+	// a failed tx is notified with its error, the logs are read after
+	env.server.AdvanceEpoch(0)
+	env.server.FailNext("era_new", 1)
+	err := env.handleEraWithin(t, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), ErrTxFailed.Error()) || !strings.Contains(err.Error(), "injected failure") {
+		t.Fatalf("handleEra err: %v", err)
+	}
+
+	// with the websocket down, txs are polled
+	env.server.CloseWs()
+	env.task.txSender.PollInterval = time.Millisecond
+	if err := env.handleEraWithin(t, 10*time.Second); err != nil {
+		t.Fatalf("handleEra failed: %s", err)
+	}
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 11)
+}
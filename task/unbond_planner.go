@@ -0,0 +1,131 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/stafiprotocol/solana-go-sdk/client"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+)
+
+const (
+	UnbondStrategyLargest        = "largest"
+	UnbondStrategyWorstValidator = "worst_validator"
+	UnbondStrategyProportional   = "proportional"
+)
+
+type unbondCandidate struct {
+	stakeAccount common.PublicKey
+	validator    common.PublicKey
+	stake        uint64
+}
+
+// planUnbond picks active stake accounts in the order of the unbond strategy until they cover NeedUnbond.
+// era_unbond splits min(NeedUnbond, stake) from the given account, so the plan decides accounts, not amounts.
+func (task *Task) planUnbond(stakeManager *lsdprog.StakeManager) ([]unbondCandidate, error) {
+	candidates := make([]unbondCandidate, 0)
+	for _, stakeAccount := range stakeManager.StakeAccounts {
+		activation, err := task.client.Load().GetStakeActivation(
+			context.Background(),
+			stakeAccount.ToBase58(),
+			client.GetStakeActivationConfig{})
+		if err != nil {
+			return nil, err
+		}
+		if activation.State != client.StakeActivationStateActive {
+			continue
+		}
+
+		accountInfo, err := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		delegation := accountInfo.StakeAccount.Info.Stake.Delegation
+		candidates = append(candidates, unbondCandidate{
+			stakeAccount: stakeAccount,
+			validator:    delegation.Voter,
+			stake:        uint64(delegation.Stake),
+		})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no active stake account to unbond")
+	}
+
+	// largest first is the base order of every strategy
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].stake > candidates[j].stake
+	})
+
+	switch task.cfg.UnbondStrategy {
+	case "", UnbondStrategyLargest:
+	case UnbondStrategyWorstValidator:
+		validators := make([]common.PublicKey, 0, len(candidates))
+		for _, candidate := range candidates {
+			validators = append(validators, candidate.validator)
+		}
+		ranks, err := task.validatorRanks(stakeManager.Validators, validators)
+		if err != nil {
+			return nil, err
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return ranks[candidates[i].validator] < ranks[candidates[j].validator]
+		})
+	case UnbondStrategyProportional:
+		candidates = proportionalOrder(candidates)
+	default:
+		return nil, fmt.Errorf("unknown unbond strategy: %s", task.cfg.UnbondStrategy)
+	}
+
+	// stake on validators flagged by the watchdog goes first whatever the strategy
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return task.watchdog.isFlagged(candidates[i].validator) && !task.watchdog.isFlagged(candidates[j].validator)
+	})
+
+	plan := make([]unbondCandidate, 0)
+	planned := uint64(0)
+	for _, candidate := range candidates {
+		if planned >= stakeManager.EraProcessData.NeedUnbond {
+			break
+		}
+		plan = append(plan, candidate)
+		planned += candidate.stake
+	}
+	return plan, nil
+}
+
+// proportionalOrder draws each time from the validator holding the most remaining stake,
+// so that unbonding is taken from validators in line with their share of stake.
+func proportionalOrder(candidates []unbondCandidate) []unbondCandidate {
+	remaining := make(map[common.PublicKey]uint64)
+	queues := make(map[common.PublicKey][]unbondCandidate)
+	validators := make([]common.PublicKey, 0)
+	for _, candidate := range candidates {
+		if _, exist := queues[candidate.validator]; !exist {
+			validators = append(validators, candidate.validator)
+		}
+		remaining[candidate.validator] += candidate.stake
+		queues[candidate.validator] = append(queues[candidate.validator], candidate)
+	}
+
+	ordered := make([]unbondCandidate, 0, len(candidates))
+	for len(ordered) < len(candidates) {
+		var selected common.PublicKey
+		found := false
+		for _, validator := range validators {
+			if len(queues[validator]) == 0 {
+				continue
+			}
+			if !found || remaining[validator] > remaining[selected] {
+				selected = validator
+				found = true
+			}
+		}
+		next := queues[selected][0]
+		queues[selected] = queues[selected][1:]
+		remaining[selected] -= next.stake
+		ordered = append(ordered, next)
+	}
+	return ordered
+}
@@ -0,0 +1,237 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+const (
+	defaultScoreMaxCommission = 100
+	defaultScoreCreditEpochs  = 5
+
+	scoreCacheTTL = 5 * time.Minute
+)
+
+// ValidatorScore is how well a validator serves stakers, Score 0 to 1 is the product of its vote credits
+// relative to the best validator of the cluster, the share of rewards it leaves to stakers and its produced blocks ratio.
+type ValidatorScore struct {
+	Validator      string  `json:"validator"`
+	Identity       string  `json:"identity"`
+	Found          bool    `json:"found"` // in the vote accounts of the cluster
+	Delinquent     bool    `json:"delinquent"`
+	Commission     uint8   `json:"commission"`
+	Credits        uint64  `json:"credits"` // average of the recent completed epochs
+	MaxCredits     uint64  `json:"maxCredits"`
+	LeaderSlots    uint64  `json:"leaderSlots"`
+	BlocksProduced uint64  `json:"blocksProduced"`
+	SkipRate       float64 `json:"skipRate"`
+	ActivatedStake uint64  `json:"activatedStake"`
+	Score          float64 `json:"score"`
+	Reason         string  `json:"reason,omitempty"` // why the score is 0
+}
+
+// ScoreValidators scores validators from the current vote accounts and block production of the cluster
+func ScoreValidators(rpcClient *rpc.Client, validators []common.PublicKey, cfg config.ScoreConfig) ([]ValidatorScore, error) {
+	voteAccounts, err := rpcClient.GetVoteAccounts(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	blockProduction, err := rpcClient.GetBlockProduction(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return scoreValidators(validators, voteAccounts, blockProduction, cfg), nil
+}
+
+func scoreValidators(validators []common.PublicKey, voteAccounts rpc.GetVoteAccountsResponse, blockProduction rpc.BlockProduction, cfg config.ScoreConfig) []ValidatorScore {
+	maxCommission := cfg.MaxCommission
+	if maxCommission == 0 {
+		maxCommission = defaultScoreMaxCommission
+	}
+	creditEpochs := int(cfg.CreditEpochs)
+	if creditEpochs == 0 {
+		creditEpochs = defaultScoreCreditEpochs
+	}
+
+	maxCredits := uint64(0)
+	for i := range voteAccounts.Current {
+		if credits := voteAccounts.Current[i].RecentEpochCredits(creditEpochs); credits > maxCredits {
+			maxCredits = credits
+		}
+	}
+	byVote := make(map[string]rpc.VoteAccount)
+	delinquent := make(map[string]bool)
+	for _, voteAccount := range voteAccounts.Current {
+		byVote[voteAccount.VotePubkey] = voteAccount
+	}
+	for _, voteAccount := range voteAccounts.Delinquent {
+		byVote[voteAccount.VotePubkey] = voteAccount
+		delinquent[voteAccount.VotePubkey] = true
+	}
+
+	scores := make([]ValidatorScore, 0, len(validators))
+	for _, validator := range validators {
+		score := ValidatorScore{Validator: validator.ToBase58(), MaxCredits: maxCredits}
+		voteAccount, exist := byVote[score.Validator]
+		if !exist {
+			score.Reason = "vote account not found"
+			scores = append(scores, score)
+			continue
+		}
+		score.Found = true
+		score.Identity = voteAccount.NodePubkey
+		score.Delinquent = delinquent[score.Validator]
+		score.Commission = voteAccount.Commission
+		score.Credits = voteAccount.RecentEpochCredits(creditEpochs)
+		score.ActivatedStake = voteAccount.ActivatedStake
+		if production, exist := blockProduction.ByIdentity[voteAccount.NodePubkey]; exist {
+			score.LeaderSlots, score.BlocksProduced = production[0], production[1]
+		}
+		if score.LeaderSlots > 0 && score.BlocksProduced <= score.LeaderSlots {
+			score.SkipRate = float64(score.LeaderSlots-score.BlocksProduced) / float64(score.LeaderSlots)
+		}
+
+		switch {
+		case score.Delinquent:
+			score.Reason = "delinquent"
+		case uint64(score.Commission) > maxCommission:
+			score.Reason = fmt.Sprintf("commission %d%% above %d%%", score.Commission, maxCommission)
+		case maxCredits == 0:
+			score.Reason = "no vote credits in the cluster"
+		default:
+			score.Score = float64(score.Credits) / float64(maxCredits) *
+				float64(100-score.Commission) / 100 *
+				(1 - score.SkipRate)
+		}
+		scores = append(scores, score)
+	}
+	return scores
+}
+
+// scoreCache keeps the scores for a while, handlers ask for them on every pass
+type scoreCache struct {
+	mu              sync.Mutex
+	at              time.Time
+	voteAccounts    rpc.GetVoteAccountsResponse
+	blockProduction rpc.BlockProduction
+}
+
+// validatorScores scores validators, reusing the vote accounts and block production fetched within scoreCacheTTL
+func (task *Task) validatorScores(validators []common.PublicKey) (map[common.PublicKey]ValidatorScore, error) {
+	task.scores.mu.Lock()
+	defer task.scores.mu.Unlock()
+	if time.Since(task.scores.at) > scoreCacheTTL {
+		voteAccounts, err := task.rpcClient.GetVoteAccounts(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		blockProduction, err := task.rpcClient.GetBlockProduction(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		task.scores.voteAccounts, task.scores.blockProduction, task.scores.at = voteAccounts, blockProduction, time.Now()
+	}
+
+	scores := make(map[common.PublicKey]ValidatorScore, len(validators))
+	for i, score := range scoreValidators(validators, task.scores.voteAccounts, task.scores.blockProduction, task.cfg.Score) {
+		scores[validators[i]] = score
+	}
+	return scores, nil
+}
+
+// EligibleValidators drops validators scored below MinScore, or keeps all if none is left so bonding goes on
+func EligibleValidators(rpcClient *rpc.Client, validators []common.PublicKey, cfg config.ScoreConfig) ([]common.PublicKey, error) {
+	if cfg.MinScore <= 0 {
+		return validators, nil
+	}
+	scores, err := ScoreValidators(rpcClient, validators, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return eligibleByScore(validators, scores, cfg.MinScore), nil
+}
+
+func (task *Task) eligibleValidators(validators []common.PublicKey) ([]common.PublicKey, error) {
+	if task.cfg.Score.MinScore <= 0 {
+		return validators, nil
+	}
+	scores, err := task.validatorScores(validators)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]ValidatorScore, 0, len(validators))
+	for _, validator := range validators {
+		list = append(list, scores[validator])
+	}
+	return eligibleByScore(validators, list, task.cfg.Score.MinScore), nil
+}
+
+// eligibleByScore keeps the validators scored at least minScore, scores are in the order of validators
+func eligibleByScore(validators []common.PublicKey, scores []ValidatorScore, minScore float64) []common.PublicKey {
+	eligible := make([]common.PublicKey, 0, len(validators))
+	for i, validator := range validators {
+		if scores[i].Score >= minScore {
+			eligible = append(eligible, validator)
+		}
+	}
+	if len(eligible) == 0 {
+		return validators
+	}
+	return eligible
+}
+
+// validatorRanks orders validators from worst to best by score, validators out of the stake manager's list
+// rank worst so their stake goes first, then validators without a vote account.
+func (task *Task) validatorRanks(stakeManagerValidators, validators []common.PublicKey) (map[common.PublicKey]int, error) {
+	listed := make(map[common.PublicKey]bool)
+	seen := make(map[common.PublicKey]bool)
+	all := make([]common.PublicKey, 0, len(stakeManagerValidators)+len(validators))
+	for _, validator := range stakeManagerValidators {
+		listed[validator] = true
+	}
+	for _, list := range [][]common.PublicKey{stakeManagerValidators, validators} {
+		for _, validator := range list {
+			if !seen[validator] {
+				seen[validator] = true
+				all = append(all, validator)
+			}
+		}
+	}
+	scores, err := task.validatorScores(all)
+	if err != nil {
+		return nil, err
+	}
+	return rankValidators(all, listed, scores), nil
+}
+
+// rankValidators ranks validators from 0, the worst. Ties are broken by address, so the order does not
+// depend on the order validators come in.
+func rankValidators(validators []common.PublicKey, listed map[common.PublicKey]bool, scores map[common.PublicKey]ValidatorScore) map[common.PublicKey]int {
+	ordered := append([]common.PublicKey{}, validators...)
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+		if listed[a] != listed[b] {
+			return !listed[a]
+		}
+		if scores[a].Found != scores[b].Found {
+			return !scores[a].Found
+		}
+		if scores[a].Score != scores[b].Score {
+			return scores[a].Score < scores[b].Score
+		}
+		return bytes.Compare(a.Bytes(), b.Bytes()) < 0
+	})
+	ranks := make(map[common.PublicKey]int, len(ordered))
+	for i, validator := range ordered {
+		ranks[validator] = i
+	}
+	return ranks
+}
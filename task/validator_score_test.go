@@ -0,0 +1,75 @@
+package task
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+func TestScoreValidators(t *testing.T) {
+	best, good, greedy, down, gone := common.PublicKey{1}, common.PublicKey{2}, common.PublicKey{3}, common.PublicKey{4}, common.PublicKey{5}
+	// credits of epochs 7 and 8 are averaged, epoch 9 is in progress
+	credits := func(perEpoch uint64) [][]uint64 {
+		return [][]uint64{{7, perEpoch, 0}, {8, 2 * perEpoch, perEpoch}, {9, 2*perEpoch + 1, 2 * perEpoch}}
+	}
+	voteAccounts := rpc.GetVoteAccountsResponse{
+		Current: []rpc.VoteAccount{
+			{VotePubkey: best.ToBase58(), NodePubkey: "best", EpochCredits: credits(400)},
+			{VotePubkey: good.ToBase58(), NodePubkey: "good", Commission: 10, EpochCredits: credits(300)},
+			{VotePubkey: greedy.ToBase58(), NodePubkey: "greedy", Commission: 90, EpochCredits: credits(400)},
+		},
+		Delinquent: []rpc.VoteAccount{
+			{VotePubkey: down.ToBase58(), NodePubkey: "down", EpochCredits: credits(400)},
+		},
+	}
+	blockProduction := rpc.BlockProduction{ByIdentity: map[string][2]uint64{"good": {100, 80}}}
+
+	scores := scoreValidators([]common.PublicKey{best, good, greedy, down, gone}, voteAccounts, blockProduction, config.ScoreConfig{MaxCommission: 50})
+	want := []float64{1, 0.75 * 0.9 * 0.8, 0, 0, 0}
+	for i, score := range scores {
+		if math.Abs(score.Score-want[i]) > 1e-9 {
+			t.Fatalf("score of %s: %f (%s), want: %f", score.Validator, score.Score, score.Reason, want[i])
+		}
+	}
+	if scores[1].Credits != 300 || scores[1].SkipRate != 0.2 {
+		t.Fatalf("good validator: %+v", scores[1])
+	}
+	if !scores[3].Delinquent || scores[4].Found {
+		t.Fatalf("down: %+v, gone: %+v", scores[3], scores[4])
+	}
+
+	eligible := eligibleByScore([]common.PublicKey{best, good, greedy, down, gone}, scores, 0.5)
+	if len(eligible) != 2 || eligible[0] != best || eligible[1] != good {
+		t.Fatalf("eligible: %v", eligible)
+	}
+}
+
+func TestRankValidators(t *testing.T) {
+	unlisted, gone, goneToo, down, weak, strong := common.PublicKey{6}, common.PublicKey{5}, common.PublicKey{2}, common.PublicKey{4}, common.PublicKey{3}, common.PublicKey{1}
+	listed := map[common.PublicKey]bool{gone: true, goneToo: true, down: true, weak: true, strong: true}
+	scores := map[common.PublicKey]ValidatorScore{
+		unlisted: {Found: true, Score: 0.9},
+		gone:     {Reason: "vote account not found"},
+		goneToo:  {Reason: "vote account not found"},
+		down:     {Found: true, Delinquent: true},
+		weak:     {Found: true, Score: 0.5},
+		strong:   {Found: true, Score: 0.9},
+	}
+	want := []common.PublicKey{unlisted, goneToo, gone, down, weak, strong}
+
+	// validators without a vote account rank below those scored 0, whatever order they come in
+	for _, validators := range [][]common.PublicKey{
+		{strong, weak, down, gone, goneToo, unlisted},
+		{goneToo, unlisted, down, strong, gone, weak},
+	} {
+		ranks := rankValidators(validators, listed, scores)
+		for rank, validator := range want {
+			if ranks[validator] != rank {
+				t.Fatalf("rank of %s: %d, want: %d", validator.ToBase58(), ranks[validator], rank)
+			}
+		}
+	}
+}
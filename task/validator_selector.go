@@ -0,0 +1,235 @@
+package task
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+)
+
+const (
+	ValidatorSelectStrategyFirst       = "first"
+	ValidatorSelectStrategyRoundRobin  = "round_robin"
+	ValidatorSelectStrategyLeastStaked = "least_staked"
+	ValidatorSelectStrategyWeighted    = "weighted"
+	ValidatorSelectStrategyEven        = "even"
+	ValidatorSelectStrategyScore       = "score"
+)
+
+// SelectInput holds what a ValidatorSelector needs to pick the validator of an era bond.
+type SelectInput struct {
+	Era        uint64
+	Validators []common.PublicKey
+	Stakes     map[common.PublicKey]uint64 // validator -> delegated stake
+	Scores     map[common.PublicKey]ValidatorScore
+	BondAmount uint64
+}
+
+// ValidatorSelector decides which validator receives the bond of an era.
+// EraBond delegates the whole NeedBond to one validator, so strategies spread stake across eras.
+type ValidatorSelector interface {
+	Select(input *SelectInput) (common.PublicKey, error)
+	NeedStakes() bool
+	NeedScores() bool
+}
+
+func NewValidatorSelector(strategy string, weights map[string]uint64) (ValidatorSelector, error) {
+	switch strategy {
+	case "", ValidatorSelectStrategyFirst:
+		return &firstSelector{}, nil
+	case ValidatorSelectStrategyRoundRobin:
+		return &roundRobinSelector{}, nil
+	case ValidatorSelectStrategyLeastStaked:
+		return &leastStakedSelector{}, nil
+	case ValidatorSelectStrategyWeighted:
+		if len(weights) == 0 {
+			return nil, fmt.Errorf("validator weights empty")
+		}
+		w := make(map[common.PublicKey]uint64)
+		for validator, weight := range weights {
+			w[common.PublicKeyFromString(validator)] = weight
+		}
+		return &weightedSelector{weights: w}, nil
+	case ValidatorSelectStrategyEven:
+		return &weightedSelector{}, nil
+	case ValidatorSelectStrategyScore:
+		return &scoreSelector{}, nil
+	default:
+		return nil, fmt.Errorf("unknown validator select strategy: %s", strategy)
+	}
+}
+
+// firstSelector always uses the first validator
+type firstSelector struct{}
+
+func (s *firstSelector) Select(input *SelectInput) (common.PublicKey, error) {
+	if len(input.Validators) == 0 {
+		return common.PublicKey{}, fmt.Errorf("no validators")
+	}
+	return input.Validators[0], nil
+}
+
+func (s *firstSelector) NeedStakes() bool {
+	return false
+}
+
+func (s *firstSelector) NeedScores() bool {
+	return false
+}
+
+// roundRobinSelector rotates validators by era, so no local state is needed across restarts
+type roundRobinSelector struct{}
+
+func (s *roundRobinSelector) Select(input *SelectInput) (common.PublicKey, error) {
+	if len(input.Validators) == 0 {
+		return common.PublicKey{}, fmt.Errorf("no validators")
+	}
+	return input.Validators[input.Era%uint64(len(input.Validators))], nil
+}
+
+func (s *roundRobinSelector) NeedStakes() bool {
+	return false
+}
+
+func (s *roundRobinSelector) NeedScores() bool {
+	return false
+}
+
+// leastStakedSelector picks the validator with the least delegated stake
+type leastStakedSelector struct{}
+
+func (s *leastStakedSelector) Select(input *SelectInput) (common.PublicKey, error) {
+	if len(input.Validators) == 0 {
+		return common.PublicKey{}, fmt.Errorf("no validators")
+	}
+	selected := input.Validators[0]
+	for _, validator := range input.Validators[1:] {
+		if input.Stakes[validator] < input.Stakes[selected] {
+			selected = validator
+		}
+	}
+	return selected, nil
+}
+
+func (s *leastStakedSelector) NeedStakes() bool {
+	return true
+}
+
+func (s *leastStakedSelector) NeedScores() bool {
+	return false
+}
+
+// weightedSelector picks the validator furthest below its target share once the bond lands.
+// Empty weights mean every validator has the same target share.
+type weightedSelector struct {
+	weights map[common.PublicKey]uint64
+}
+
+func (s *weightedSelector) Select(input *SelectInput) (common.PublicKey, error) {
+	weights := make(map[common.PublicKey]uint64)
+	totalWeight := uint64(0)
+	totalStake := input.BondAmount
+	for _, validator := range input.Validators {
+		weight := uint64(1)
+		if s.weights != nil {
+			weight = s.weights[validator]
+		}
+		weights[validator] = weight
+		totalWeight += weight
+		totalStake += input.Stakes[validator]
+	}
+	if totalWeight == 0 {
+		return common.PublicKey{}, fmt.Errorf("no validator with weight")
+	}
+
+	var selected common.PublicKey
+	maxDeficit := float64(0)
+	found := false
+	for _, validator := range input.Validators {
+		if weights[validator] == 0 {
+			continue
+		}
+		target := float64(totalStake) * float64(weights[validator]) / float64(totalWeight)
+		deficit := target - float64(input.Stakes[validator])
+		if !found || deficit > maxDeficit {
+			selected = validator
+			maxDeficit = deficit
+			found = true
+		}
+	}
+	return selected, nil
+}
+
+func (s *weightedSelector) NeedStakes() bool {
+	return true
+}
+
+func (s *weightedSelector) NeedScores() bool {
+	return false
+}
+
+// scoreSelector picks the validator with the best score
+type scoreSelector struct{}
+
+func (s *scoreSelector) Select(input *SelectInput) (common.PublicKey, error) {
+	if len(input.Validators) == 0 {
+		return common.PublicKey{}, fmt.Errorf("no validators")
+	}
+	selected := input.Validators[0]
+	for _, validator := range input.Validators[1:] {
+		if input.Scores[validator].Score > input.Scores[selected].Score {
+			selected = validator
+		}
+	}
+	return selected, nil
+}
+
+func (s *scoreSelector) NeedStakes() bool {
+	return false
+}
+
+func (s *scoreSelector) NeedScores() bool {
+	return true
+}
+
+// validatorStakes sums the delegated stake of stake manager's stake accounts per validator
+func (task *Task) validatorStakes(stakeManager *lsdprog.StakeManager) (map[common.PublicKey]uint64, error) {
+	stakes := make(map[common.PublicKey]uint64)
+	for _, stakeAccount := range stakeManager.StakeAccounts {
+		accountInfo, err := task.client.Load().GetStakeAccountInfo(context.Background(), stakeAccount.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		delegation := accountInfo.StakeAccount.Info.Stake.Delegation
+		stakes[delegation.Voter] += uint64(delegation.Stake)
+	}
+	return stakes, nil
+}
+
+func (task *Task) selectBondValidator(stakeManager *lsdprog.StakeManager) (common.PublicKey, error) {
+	validators, err := task.bondableValidators(stakeManager.Validators)
+	if err != nil {
+		return common.PublicKey{}, err
+	}
+	input := SelectInput{
+		Era:        stakeManager.LatestEra,
+		Validators: validators,
+		BondAmount: stakeManager.EraProcessData.NeedBond,
+	}
+	if task.validatorSelector.NeedStakes() {
+		stakes, err := task.validatorStakes(stakeManager)
+		if err != nil {
+			return common.PublicKey{}, err
+		}
+		input.Stakes = stakes
+	}
+	if task.validatorSelector.NeedScores() {
+		scores, err := task.validatorScores(validators)
+		if err != nil {
+			return common.PublicKey{}, err
+		}
+		input.Scores = scores
+	}
+	return task.validatorSelector.Select(&input)
+}
@@ -0,0 +1,202 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+const (
+	defaultWatchdogFlagCommission   = 100
+	defaultWatchdogDelinquentChecks = 3
+	defaultWatchdogCheckInterval    = 60 // seconds
+)
+
+// validatorWatchdog flags validators that are delinquent or take (nearly) all rewards as commission.
+// Flagged validators get no bond, are rebalanced off and their stake is unbonded first.
+type validatorWatchdog struct {
+	mu         sync.RWMutex
+	delinquent map[common.PublicKey]uint64 // consecutive checks seen delinquent
+	missing    map[common.PublicKey]uint64 // consecutive checks the vote account was not found
+	flagged    map[common.PublicKey]string // validator -> reason
+}
+
+// update flags the watched validators from the vote accounts, it returns the validators newly flagged and cleared
+func (w *validatorWatchdog) update(watched []common.PublicKey, voteAccounts rpc.GetVoteAccountsResponse, cfg config.WatchdogConfig) (map[common.PublicKey]string, []common.PublicKey) {
+	flagCommission := cfg.FlagCommission
+	if flagCommission == 0 {
+		flagCommission = defaultWatchdogFlagCommission
+	}
+	delinquentChecks := cfg.DelinquentChecks
+	if delinquentChecks == 0 {
+		delinquentChecks = defaultWatchdogDelinquentChecks
+	}
+
+	current := make(map[common.PublicKey]rpc.VoteAccount)
+	delinquent := make(map[common.PublicKey]rpc.VoteAccount)
+	for _, voteAccount := range voteAccounts.Current {
+		current[common.PublicKeyFromString(voteAccount.VotePubkey)] = voteAccount
+	}
+	for _, voteAccount := range voteAccounts.Delinquent {
+		delinquent[common.PublicKeyFromString(voteAccount.VotePubkey)] = voteAccount
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	checks := make(map[common.PublicKey]uint64)
+	missing := make(map[common.PublicKey]uint64)
+	flagged := make(map[common.PublicKey]string)
+	for _, validator := range watched {
+		if _, exist := flagged[validator]; exist {
+			continue
+		}
+		voteAccount, exist := current[validator]
+		if !exist {
+			if voteAccount, exist = delinquent[validator]; !exist {
+				// a node may leave an account out of one response, it is debounced as delinquency is
+				missing[validator] = w.missing[validator] + 1
+				if missing[validator] >= delinquentChecks {
+					flagged[validator] = fmt.Sprintf("vote account not found in %d checks", missing[validator])
+				}
+				continue
+			}
+			checks[validator] = w.delinquent[validator] + 1
+			if checks[validator] >= delinquentChecks {
+				flagged[validator] = fmt.Sprintf("delinquent in %d checks, last vote %d", checks[validator], voteAccount.LastVote)
+				continue
+			}
+		}
+		if uint64(voteAccount.Commission) >= flagCommission {
+			flagged[validator] = fmt.Sprintf("commission %d%%", voteAccount.Commission)
+		}
+	}
+
+	newlyFlagged := make(map[common.PublicKey]string)
+	for validator, reason := range flagged {
+		if _, exist := w.flagged[validator]; !exist {
+			newlyFlagged[validator] = reason
+		}
+	}
+	cleared := make([]common.PublicKey, 0)
+	for validator := range w.flagged {
+		if _, exist := flagged[validator]; !exist {
+			cleared = append(cleared, validator)
+		}
+	}
+	w.delinquent = checks
+	w.missing = missing
+	w.flagged = flagged
+	return newlyFlagged, cleared
+}
+
+func (w *validatorWatchdog) isFlagged(validator common.PublicKey) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, exist := w.flagged[validator]
+	return exist
+}
+
+// watchValidators checks the validators of the handled stake managers every CheckInterval
+func (task *Task) watchValidators() {
+	interval := time.Duration(task.cfg.Watchdog.CheckInterval) * time.Second
+	if interval == 0 {
+		interval = defaultWatchdogCheckInterval * time.Second
+	}
+	for {
+		if err := task.checkValidators(); err != nil {
+			logrus.Warnf("check validators failed: %s", err)
+		}
+
+		select {
+		case <-task.stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (task *Task) checkValidators() error {
+	watched, err := task.watchedValidators()
+	if err != nil {
+		return err
+	}
+	voteAccounts, err := task.rpcClient.GetVoteAccounts(context.Background())
+	if err != nil {
+		return err
+	}
+
+	newlyFlagged, cleared := task.watchdog.update(watched, voteAccounts, task.cfg.Watchdog)
+	for validator, reason := range newlyFlagged {
+		logrus.Errorf("validator %s flagged: %s, no bond until cleared and its stake unbonded first", validator.ToBase58(), reason)
+		task.alert(alert.LevelCritical, "validator flagged "+validator.ToBase58(), "validator %s flagged: %s, no bond until cleared and its stake unbonded first",
+			validator.ToBase58(), reason)
+	}
+	for _, validator := range cleared {
+		logrus.Infof("validator %s cleared", validator.ToBase58())
+		task.alert(alert.LevelInfo, "validator cleared "+validator.ToBase58(), "validator %s no longer delinquent or over the commission threshold", validator.ToBase58())
+	}
+	for _, validator := range watched {
+		flagged := 0.0
+		if task.watchdog.isFlagged(validator) {
+			flagged = 1
+		}
+		metrics.ValidatorFlagged.WithLabelValues(validator.ToBase58()).Set(flagged)
+	}
+	return nil
+}
+
+// watchedValidators are the validators of the handled stake managers
+func (task *Task) watchedValidators() ([]common.PublicKey, error) {
+	stakeManagers := []common.PublicKey{task.stakeManagerPubkey}
+	if task.entrustedMode {
+		stackAccount, err := task.client.Load().GetLsdStack(context.Background(), task.stackAccountPubkey.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		stakeManagers = stackAccount.EntrustedStakeManagers
+	}
+
+	seen := make(map[common.PublicKey]bool)
+	validators := make([]common.PublicKey, 0)
+	for _, stakeManagerAddr := range stakeManagers {
+		stakeManager, err := task.client.Load().GetLsdStakeManager(context.Background(), stakeManagerAddr.ToBase58())
+		if err != nil {
+			return nil, err
+		}
+		for _, validator := range stakeManager.Validators {
+			if !seen[validator] {
+				seen[validator] = true
+				validators = append(validators, validator)
+			}
+		}
+	}
+	return validators, nil
+}
+
+// bondableValidators are the validators a stake manager may bond or rebalance to: not flagged by the watchdog
+// and scored at least MinScore. If none is left all validators are kept, so the era is not stuck on bonding.
+func (task *Task) bondableValidators(validators []common.PublicKey) ([]common.PublicKey, error) {
+	eligible, err := task.eligibleValidators(validators)
+	if err != nil {
+		return nil, err
+	}
+	unflagged := make([]common.PublicKey, 0, len(eligible))
+	for _, validator := range eligible {
+		if !task.watchdog.isFlagged(validator) {
+			unflagged = append(unflagged, validator)
+		}
+	}
+	if len(unflagged) == 0 {
+		logrus.Warnf("all %d validators flagged or scored low, keep using them", len(validators))
+		return validators, nil
+	}
+	return unflagged, nil
+}
@@ -0,0 +1,90 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-go-sdk/lsdprog"
+	"github.com/stafiprotocol/solana-go-sdk/types"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/config"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/rpc"
+)
+
+func TestValidatorWatchdogUpdate(t *testing.T) {
+	down, greedy, gone := common.PublicKey{1}, common.PublicKey{2}, common.PublicKey{3}
+	watched := []common.PublicKey{down, greedy, gone}
+	cfg := config.WatchdogConfig{FlagCommission: 90, DelinquentChecks: 2}
+	w := validatorWatchdog{}
+
+	voteAccounts := rpc.GetVoteAccountsResponse{
+		Current:    []rpc.VoteAccount{{VotePubkey: greedy.ToBase58(), Commission: 90}},
+		Delinquent: []rpc.VoteAccount{{VotePubkey: down.ToBase58()}},
+	}
+	newlyFlagged, _ := w.update(watched, voteAccounts, cfg)
+	if len(newlyFlagged) != 1 || !w.isFlagged(greedy) || w.isFlagged(gone) || w.isFlagged(down) {
+		t.Fatalf("first check flagged: %v", newlyFlagged)
+	}
+	// a vote account missing is debounced as delinquency is
+	newlyFlagged, _ = w.update(watched, voteAccounts, cfg)
+	if len(newlyFlagged) != 2 || !w.isFlagged(down) || !w.isFlagged(gone) {
+		t.Fatalf("second check flagged: %v", newlyFlagged)
+	}
+
+	// all back to normal
+	voteAccounts = rpc.GetVoteAccountsResponse{Current: []rpc.VoteAccount{
+		{VotePubkey: down.ToBase58()}, {VotePubkey: greedy.ToBase58(), Commission: 5}, {VotePubkey: gone.ToBase58()},
+	}}
+	newlyFlagged, cleared := w.update(watched, voteAccounts, cfg)
+	if len(newlyFlagged) != 0 || len(cleared) != 3 || w.isFlagged(down) || w.isFlagged(greedy) || w.isFlagged(gone) {
+		t.Fatalf("newly flagged: %v, cleared: %v", newlyFlagged, cleared)
+	}
+}
+
+func TestMissingVoteAccountDebounced(t *testing.T) {
+	gone := common.PublicKey{3}
+	cfg := config.WatchdogConfig{DelinquentChecks: 3}
+	w := validatorWatchdog{}
+	found := rpc.GetVoteAccountsResponse{Current: []rpc.VoteAccount{{VotePubkey: gone.ToBase58()}}}
+
+	// missing from single responses now and then is not flagged
+	for _, voteAccounts := range []rpc.GetVoteAccountsResponse{{}, {}, found, {}, {}} {
+		w.update([]common.PublicKey{gone}, voteAccounts, cfg)
+		if w.isFlagged(gone) {
+			t.Fatal("validator flagged before missing in 3 checks in a row")
+		}
+	}
+	newlyFlagged, _ := w.update([]common.PublicKey{gone}, rpc.GetVoteAccountsResponse{}, cfg)
+	if newlyFlagged[gone] != "vote account not found in 3 checks" {
+		t.Fatalf("newly flagged: %v", newlyFlagged)
+	}
+}
+
+func TestFlaggedValidatorNotBonded(t *testing.T) {
+	env := newTestEnv(t)
+	backup := types.NewAccount().PublicKey
+	// another stake manager registers the vote account of backup
+	env.server.AddStakeManager(types.NewAccount().PublicKey, lsdprog.StakeManager{Validators: []common.PublicKey{backup}})
+	env.server.UpdateStakeManager(env.stakeManager, func(sm *lsdprog.StakeManager) {
+		sm.Validators = append(sm.Validators, backup)
+		sm.EraBond = 5e9
+	})
+
+	// the first validator, bonded to by the first strategy, goes delinquent
+	env.server.SetDelinquent(env.validator, true)
+	for i := 0; i < defaultWatchdogDelinquentChecks; i++ {
+		if err := env.task.checkValidators(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !env.task.watchdog.isFlagged(env.validator) || env.task.watchdog.isFlagged(backup) {
+		t.Fatal("delinquent validator not flagged")
+	}
+
+	env.handleEra(t)
+	sm := env.server.StakeManager(env.stakeManager)
+	assertEraEnded(t, &sm, 10)
+	bonded, _ := env.server.StakeAccount(sm.StakeAccounts[1])
+	if bonded.Voter != backup {
+		t.Fatalf("bonded to %s, want: %s", bonded.Voter.ToBase58(), backup.ToBase58())
+	}
+}
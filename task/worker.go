@@ -0,0 +1,155 @@
+package task
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stafiprotocol/solana-go-sdk/common"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/alert"
+	"github.com/stafiprotocol/solana-lsd-relay/pkg/metrics"
+)
+
+const (
+	defaultConcurrency = 4
+	workerBaseBackoff  = 6 * time.Second
+	workerMaxBackoff   = 5 * time.Minute
+)
+
+// stakeManagerWorker keeps the retry state of one entrusted stake manager
+type stakeManagerWorker struct {
+	running     bool
+	rerun       bool // dispatched again while running
+	retry       int
+	nextAttempt time.Time // zero unless backing off
+}
+
+type workerPool struct {
+	mu      sync.Mutex
+	workers map[common.PublicKey]*stakeManagerWorker
+	sem     chan struct{}
+}
+
+func newWorkerPool(concurrency int) *workerPool {
+	return &workerPool{
+		workers: make(map[common.PublicKey]*stakeManagerWorker),
+		sem:     make(chan struct{}, concurrency),
+	}
+}
+
+// keep drops idle workers of stake managers no longer entrusted
+func (p *workerPool) keep(stakeManagers []common.PublicKey) {
+	keep := make(map[common.PublicKey]bool, len(stakeManagers))
+	for _, stakeManager := range stakeManagers {
+		keep[stakeManager] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for stakeManager, w := range p.workers {
+		if !keep[stakeManager] && !w.running {
+			delete(p.workers, stakeManager)
+			metrics.StakeManagerFailures.DeleteLabelValues(stakeManager.ToBase58())
+		}
+	}
+}
+
+// dispatch starts the worker of a stake manager, or makes it run once more if it is running.
+// A stake manager backing off is left to the retry timer.
+func (t *Task) dispatch(stakeManager common.PublicKey) {
+	p := t.workers
+	p.mu.Lock()
+	w, exist := p.workers[stakeManager]
+	if !exist {
+		w = &stakeManagerWorker{retry: t.loadRetry(stakeManager)}
+		p.workers[stakeManager] = w
+	}
+	if w.running {
+		w.rerun = true
+		p.mu.Unlock()
+		return
+	}
+	if time.Now().Before(w.nextAttempt) {
+		p.mu.Unlock()
+		return
+	}
+	w.running = true
+	p.mu.Unlock()
+
+	SafeGo(func() {
+		t.runWorker(stakeManager, w)
+	})
+}
+
+func (t *Task) runWorker(stakeManager common.PublicKey, w *stakeManagerWorker) {
+	p := t.workers
+	defer func() {
+		if r := recover(); r != nil {
+			p.mu.Lock()
+			w.running = false
+			p.mu.Unlock()
+			panic(r)
+		}
+	}()
+
+	for {
+		select {
+		case p.sem <- struct{}{}:
+		case <-t.stop:
+			p.mu.Lock()
+			w.running = false
+			p.mu.Unlock()
+			return
+		}
+		err := t.handleStakeManager(stakeManager)
+		<-p.sem
+		t.recordStakeManagerStatus(stakeManager)
+		t.health.workerDone(stakeManager, err)
+
+		p.mu.Lock()
+		if err != nil {
+			w.retry++
+			backoff := workerBaseBackoff << (w.retry - 1)
+			if w.retry > 10 || backoff > workerMaxBackoff {
+				backoff = workerMaxBackoff
+			}
+			w.nextAttempt = time.Now().Add(backoff)
+			time.AfterFunc(backoff, func() {
+				t.trigger.fire(&stakeManager)
+			})
+		} else {
+			w.retry = 0
+			w.nextAttempt = time.Time{}
+		}
+		retry := w.retry
+		rerun := w.rerun && err == nil
+		w.rerun = false
+		if !rerun {
+			w.running = false
+		}
+		p.mu.Unlock()
+
+		metrics.StakeManagerFailures.WithLabelValues(stakeManager.ToBase58()).Set(float64(retry))
+		t.recordRetry(stakeManager, retry)
+		if err != nil {
+			t.reportWorkerFailure(stakeManager, retry, err)
+		}
+		if !rerun {
+			return
+		}
+	}
+}
+
+func (t *Task) reportWorkerFailure(stakeManager common.PublicKey, retry int, err error) {
+	logrus.Warnf("stakeManager %s handle failed %d times in a row: %s", stakeManager.ToBase58(), retry, err)
+	t.alert(alert.LevelWarn, fmt.Sprintf("stakeManager %s handle failed", stakeManager.ToBase58()), "%s", err)
+
+	retryThreshold := int(t.cfg.Alert.RetryThreshold)
+	if retryThreshold == 0 {
+		retryThreshold = defaultAlertRetryThreshold
+	}
+	if retry == retryThreshold {
+		t.alert(alert.LevelCritical, fmt.Sprintf("stakeManager %s handle keeps failing", stakeManager.ToBase58()),
+			"failed %d times in a row, last err: %s", retry, err)
+	}
+}